@@ -1,4 +1,5 @@
 import six
+import time
 
 
 class TestClass(object):
@@ -21,9 +22,274 @@ class TestClass(object):
     def predict(self, data):
         return 'predict called'
 
+    def predict_batch(self, data):
+        return ['predict called'] * len(data)
+
+    def slow_predict_batch(self, data):
+        time.sleep(0.3)
+        return ['slow predict called'] * len(data)
+
+    def predict_proba(self, data):
+        return [0.1, 0.4, 0.4, 0.1]
+
     def save(self, filepath, *args, **kwargs):
         with open(filepath, 'w') as f:
             six.moves.cPickle.dump(self, f)
 
     def confirm_to_call_fit(self):
         return self.cnt
+
+    def feature_importances(self):
+        return [0.25, 0.75]
+
+    def evaluate(self, data):
+        return {'loss': 0.25, 'count': len(data)}
+
+    def score(self, data):
+        return 1.0 / len(data)
+
+    def add(self, a, b):
+        return a + b
+
+    def transform(self, data):
+        return [data, data * 2]
+
+    def embed(self, data):
+        return [0.5, 0.5]
+
+    def saliency(self, x):
+        return [abs(v) for v in x]
+
+    def empty_cache(self):
+        return 'cache released'
+
+    def to_onnx(self, path):
+        with open(path, 'w') as f:
+            f.write('onnx')
+
+    def __repr__(self):
+        return 'TestClass(cnt={})'.format(self.cnt)
+
+
+class MetricsClass(TestClass):
+
+    @staticmethod
+    def create():
+        self = MetricsClass()
+        self.cnt = 0
+        return self
+
+    def fit(self, data):
+        self.cnt += 1
+        return {'loss': 0.5, 'accuracy': 0.8, 'count': len(data)}
+
+
+class TupleMetricsClass(TestClass):
+
+    @staticmethod
+    def create():
+        self = TupleMetricsClass()
+        self.cnt = 0
+        return self
+
+    def fit(self, data):
+        self.cnt += 1
+        return (0.5, 0.8)
+
+
+class ValidationClass(TestClass):
+
+    @staticmethod
+    def create():
+        self = ValidationClass()
+        self.cnt = 0
+        return self
+
+    def fit(self, data):
+        self.cnt += 1
+        return {'val_accuracy': data[0]}
+
+
+class MinimalClass(object):
+
+    @staticmethod
+    def create():
+        return MinimalClass()
+
+    def fit(self, data):
+        return 'fit called'
+
+    def predict(self, data):
+        return 'predict called'
+
+
+class EchoClass(object):
+
+    @staticmethod
+    def create():
+        return EchoClass()
+
+    def fit(self, data):
+        if 'crash' in data:
+            raise ValueError('crash')
+        return 'fit called'
+
+    def predict(self, data):
+        return data
+
+    def supports_sparse(self):
+        return True
+
+
+class RecordClass(object):
+
+    @staticmethod
+    def create():
+        self = RecordClass()
+        self.fitted = []
+        return self
+
+    def fit(self, data):
+        self.fitted = data
+        return 'fit called'
+
+    def predict(self, data):
+        return data
+
+    def last_fit(self):
+        return self.fitted
+
+
+class OverlapClass(object):
+
+    @staticmethod
+    def create():
+        self = OverlapClass()
+        self.fitting = 0
+        self.overlaps = 0
+        return self
+
+    def fit(self, data):
+        self.fitting += 1
+        if self.fitting > 1:
+            self.overlaps += 1
+        # sleep releases the GIL so that other calls can run meanwhile.
+        time.sleep(0.002)
+        self.fitting -= 1
+        return 'fit called'
+
+    def predict(self, data):
+        if self.fitting > 0:
+            self.overlaps += 1
+        time.sleep(0.001)
+        return 'predict called'
+
+    def count_overlaps(self):
+        return self.overlaps
+
+
+class PartialClass(object):
+
+    @staticmethod
+    def create():
+        self = PartialClass()
+        self.fits = 0
+        self.partial_fits = 0
+        return self
+
+    def fit(self, data):
+        self.fits += 1
+        return 'fit called'
+
+    def partial_fit(self, data):
+        self.partial_fits += 1
+        return 'partial_fit called'
+
+    def counts(self):
+        return [self.fits, self.partial_fits]
+
+    def forward(self, data):
+        return 'forward called'
+
+
+class KwargsClass(object):
+
+    @staticmethod
+    def create(lr=0.1, **kwargs):
+        self = KwargsClass()
+        self.lr = lr
+        return self
+
+    def fit(self, data):
+        return 'fit called'
+
+    def predict(self, data):
+        return self.lr
+
+    def set_params(self, params):
+        self.lr = params['lr']
+
+    def get_params(self):
+        return {'lr': self.lr}
+
+
+class VectorClass(object):
+
+    @staticmethod
+    def create(output=None, **kwargs):
+        self = VectorClass()
+        self.output = output
+        return self
+
+    def fit(self, data):
+        return 'fit called'
+
+    def predict(self, data):
+        return self.output
+
+
+class DoubleBufferClass(TestClass):
+
+    @staticmethod
+    def create():
+        self = DoubleBufferClass()
+        self.cnt = 0
+        self.w = 0
+        return self
+
+    def fit(self, data):
+        self.cnt += 1
+        self.w += len(data)
+        return 'fit called'
+
+    def predict(self, data):
+        return self.w
+
+    def get_weights(self):
+        return self.w
+
+    def set_weights(self, w):
+        self.w = w
+
+    def predict_proba(self, data):
+        return [self.w, 1]
+
+    def score(self, data):
+        return self.w
+
+
+class FlakyClass(TestClass):
+
+    @staticmethod
+    def create():
+        self = FlakyClass()
+        self.cnt = 0
+        self.failures = 2
+        return self
+
+    def fit(self, data):
+        if self.failures > 0:
+            self.failures -= 1
+            raise RuntimeError('CUDA out of memory')
+        self.cnt += 1
+        return 'fit called'
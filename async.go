@@ -0,0 +1,251 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	overflowBlock      = "block"
+	overflowDropOldest = "drop_oldest_batch"
+	overflowDropNewest = "drop_newest_batch"
+	overflowSample     = "sample"
+)
+
+func validateOverflowPolicy(p string) error {
+	switch p {
+	case overflowBlock, overflowDropOldest, overflowDropNewest, overflowSample:
+		return nil
+	default:
+		return fmt.Errorf("overflow_policy must be one of '%v', '%v', '%v', and '%v': %v",
+			overflowBlock, overflowDropOldest, overflowDropNewest, overflowSample, p)
+	}
+}
+
+// fitQueue is a bounded queue of batches trained by the fit goroutine of
+// async_fit.
+type fitQueue struct {
+	m       sync.Mutex
+	cond    *sync.Cond
+	batches [][]data.Value
+	size    int
+	closed  bool
+
+	// policy is overflow_policy. dropped is the number of tuples dropped by
+	// it.
+	policy  string
+	dropped int64
+	rand    *rand.Rand
+
+	// taken is the number of batches taken by Write, and consumed is the
+	// number of them trained or dropped. They're used to wait for batches
+	// taken before a given time to be trained.
+	taken    int64
+	consumed int64
+}
+
+func newFitQueue(size int, policy string) *fitQueue {
+	q := &fitQueue{
+		size:   size,
+		policy: policy,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	q.cond = sync.NewCond(&q.m)
+	return q
+}
+
+// push adds batch to the queue. When the queue is full, it blocks or drops a
+// batch according to overflow_policy. The batch is discarded when the queue
+// has been closed.
+func (q *fitQueue) push(ctx *core.Context, batch []data.Value) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if !q.closed && len(q.batches) >= q.size {
+		switch q.policy {
+		case overflowDropOldest:
+			q.dropped += int64(len(q.batches[0]))
+			q.batches[0] = nil
+			q.batches = q.batches[1:]
+			q.consume()
+		case overflowDropNewest:
+			q.dropped += int64(len(batch))
+			q.consume()
+			return
+		case overflowSample:
+			// Each of the queued batches and the new one is kept with the
+			// same probability.
+			i := q.rand.Intn(len(q.batches) + 1)
+			if i == len(q.batches) {
+				q.dropped += int64(len(batch))
+				q.consume()
+				return
+			}
+			q.dropped += int64(len(q.batches[i]))
+			q.batches = append(q.batches[:i], q.batches[i+1:]...)
+			q.consume()
+		default:
+			for !q.closed && len(q.batches) >= q.size {
+				q.cond.Wait()
+			}
+		}
+	}
+	if q.closed {
+		ctx.Log().WithField("bucket_size", len(batch)).
+			Warn("pymlstate discarded a batch pushed after the fit queue was closed")
+		q.consume()
+		return
+	}
+	q.batches = append(q.batches, batch)
+	q.cond.Broadcast()
+}
+
+// pop removes the oldest batch from the queue. It blocks while the queue is
+// empty, and returns false when the queue is closed and empty.
+func (q *fitQueue) pop() ([]data.Value, bool) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	for !q.closed && len(q.batches) == 0 {
+		q.cond.Wait()
+	}
+	if len(q.batches) == 0 {
+		return nil, false
+	}
+	b := q.batches[0]
+	q.batches[0] = nil
+	q.batches = q.batches[1:]
+	q.cond.Broadcast()
+	return b, true
+}
+
+// reserve records that a batch is taken to be pushed. It's called while
+// holding the lock of the state so that wait also waits for the batch being
+// pushed without the lock.
+func (q *fitQueue) reserve() {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.taken++
+}
+
+// done records that a popped batch has been trained.
+func (q *fitQueue) done() {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.consume()
+}
+
+// consume records that a batch has been trained or dropped. The caller must
+// hold q.m.
+func (q *fitQueue) consume() {
+	q.consumed++
+	q.cond.Broadcast()
+}
+
+// wait blocks until batches taken before the call are trained or dropped.
+// Batches taken after the call aren't waited for, so that it returns even
+// while tuples keep being written.
+func (q *fitQueue) wait() {
+	q.m.Lock()
+	defer q.m.Unlock()
+	n := q.taken
+	for q.consumed < n {
+		q.cond.Wait()
+	}
+}
+
+// close makes pop return false once the remaining batches are consumed.
+func (q *fitQueue) close() {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *fitQueue) len() int {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return len(q.batches)
+}
+
+// droppedTuples returns the number of tuples dropped by overflow_policy.
+func (q *fitQueue) droppedTuples() int64 {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return q.dropped
+}
+
+// takeBatch takes the full bucket as a batch for the fit goroutine, which is
+// started when it isn't running. The feature dimension is recorded here
+// because the goroutine cannot update the state. The caller must hold the
+// write lock.
+func (s *State) takeBatch(ctx *core.Context) (*fitQueue, []data.Value, error) {
+	if s.fitQueue == nil {
+		size := s.params.FitQueueSize
+		if size <= 0 {
+			size = 1
+		}
+		s.fitQueue = newFitQueue(size, s.params.OverflowPolicy)
+		s.fitDone = make(chan struct{})
+		go s.fitLoop(ctx, s.fitQueue, s.fitDone)
+	}
+
+	s.fitQueue.reserve()
+	batch := make([]data.Value, len(s.bucket))
+	copy(batch, s.bucket)
+	s.recordFeatureDim(ctx, batch)
+	if s.params.BatchSize > 1 {
+		s.bucket = s.bucket[:0]
+	} else {
+		s.bucket = nil
+	}
+	return s.fitQueue, batch, nil
+}
+
+// fitLoop trains the model with batches in q until q is closed.
+func (s *State) fitLoop(ctx *core.Context, q *fitQueue, done chan<- struct{}) {
+	defer close(done)
+	for {
+		batch, ok := q.pop()
+		if !ok {
+			return
+		}
+		s.rwm.RLock()
+		_, err := s.fit(ctx, batch)
+		s.rwm.RUnlock()
+		q.done()
+		if err != nil {
+			ctx.ErrLog(err).WithField("bucket_size", len(batch)).
+				Error("pymlstate's asynchronous training failed")
+		}
+	}
+}
+
+// drainFitQueue waits until the fit goroutine trains all batches which have
+// been taken by Write, including ones not pushed to the queue yet. It must be
+// called without holding the lock because the goroutine needs the read lock.
+func (s *State) drainFitQueue() {
+	s.rwm.RLock()
+	q := s.fitQueue
+	s.rwm.RUnlock()
+	if q != nil {
+		q.wait()
+	}
+}
+
+// stopAsyncFit stops the fit goroutine after it trains all queued batches.
+// Subsequent Write calls train the model synchronously. It must be called
+// without holding the lock.
+func (s *State) stopAsyncFit() {
+	s.rwm.Lock()
+	q, done := s.fitQueue, s.fitDone
+	s.asyncStopped = true
+	s.rwm.Unlock()
+	if q == nil {
+		return
+	}
+	q.close()
+	<-done
+}
@@ -0,0 +1,182 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestFitQueue(t *testing.T) {
+	ctx := core.NewContext(&core.ContextConfig{})
+	Convey("Given a fit queue", t, func() {
+		q := newFitQueue(1, overflowBlock)
+
+		Convey("When push a batch to a full queue", func() {
+			q.push(ctx, []data.Value{data.Int(1)})
+			pushed := make(chan struct{})
+			go func() {
+				q.push(ctx, []data.Value{data.Int(2)})
+				close(pushed)
+			}()
+
+			Convey("Then it should block until a batch is popped", func() {
+				blocked := true
+				select {
+				case <-pushed:
+					blocked = false
+				case <-time.After(10 * time.Millisecond):
+				}
+				So(blocked, ShouldBeTrue)
+				b, ok := q.pop()
+				So(ok, ShouldBeTrue)
+				So(b, ShouldResemble, []data.Value{data.Int(1)})
+				<-pushed
+				So(q.len(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When wait for a taken batch", func() {
+			q.reserve()
+			waited := make(chan struct{})
+			go func() {
+				q.wait()
+				close(waited)
+			}()
+
+			Convey("Then it should block until the batch is trained", func() {
+				q.push(ctx, []data.Value{data.Int(1)})
+				_, ok := q.pop()
+				So(ok, ShouldBeTrue)
+				blocked := true
+				select {
+				case <-waited:
+					blocked = false
+				case <-time.After(10 * time.Millisecond):
+				}
+				So(blocked, ShouldBeTrue)
+				q.done()
+				<-waited
+			})
+		})
+
+		Convey("When close the queue having a batch", func() {
+			q.push(ctx, []data.Value{data.Int(1)})
+			q.close()
+
+			Convey("Then the remaining batch should be popped before it ends", func() {
+				_, ok := q.pop()
+				So(ok, ShouldBeTrue)
+				_, ok = q.pop()
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestFitQueueOverflowPolicy(t *testing.T) {
+	ctx := core.NewContext(&core.ContextConfig{})
+	Convey("Given full fit queues", t, func() {
+		newQueue := func(policy string) *fitQueue {
+			q := newFitQueue(2, policy)
+			q.push(ctx, []data.Value{data.Int(1)})
+			q.push(ctx, []data.Value{data.Int(2), data.Int(2)})
+			return q
+		}
+
+		Convey("When push a batch with drop_oldest_batch", func() {
+			q := newQueue(overflowDropOldest)
+			q.push(ctx, []data.Value{data.Int(3)})
+			Convey("Then the oldest batch should be dropped", func() {
+				So(q.batches, ShouldResemble, [][]data.Value{
+					{data.Int(2), data.Int(2)},
+					{data.Int(3)},
+				})
+				So(q.droppedTuples(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When push a batch with drop_newest_batch", func() {
+			q := newQueue(overflowDropNewest)
+			q.push(ctx, []data.Value{data.Int(3)})
+			Convey("Then the new batch should be dropped", func() {
+				So(q.len(), ShouldEqual, 2)
+				So(q.batches[1], ShouldResemble, []data.Value{data.Int(2), data.Int(2)})
+				So(q.droppedTuples(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When push batches with sample", func() {
+			q := newQueue(overflowSample)
+			for i := 0; i < 10; i++ {
+				q.push(ctx, []data.Value{data.Int(3)})
+			}
+			Convey("Then the queue should keep its size without blocking", func() {
+				So(q.len(), ShouldEqual, 2)
+				So(q.droppedTuples(), ShouldBeGreaterThanOrEqualTo, 10)
+			})
+		})
+	})
+}
+
+func TestPyMLStateAsyncFit(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with async_fit", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:    2,
+			AsyncFit:     true,
+			FitQueueSize: 2,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+
+		Convey("When write tuples and terminate it", func() {
+			for i := 0; i < 6; i++ {
+				So(s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(i)}}), ShouldBeNil)
+			}
+			So(s.Terminate(ctx), ShouldBeNil)
+
+			Convey("Then all queued batches should be trained", func() {
+				So(s.stats.snapshot()["batches"], ShouldEqual, data.Int(3))
+			})
+		})
+
+		Convey("When write tuples and flush it", func() {
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			for i := 0; i < 5; i++ {
+				So(s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(i)}}), ShouldBeNil)
+			}
+			_, err := s.Flush(ctx)
+			So(err, ShouldBeNil)
+
+			Convey("Then queued batches should be trained before it returns", func() {
+				So(s.stats.snapshot()["batches"], ShouldEqual, data.Int(3))
+				So(s.fitQueue.len(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When write tuples and quiesce it", func() {
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			for i := 0; i < 5; i++ {
+				So(s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(i)}}), ShouldBeNil)
+			}
+			So(s.Quiesce(ctx), ShouldBeNil)
+
+			Convey("Then queued batches should be trained before it returns", func() {
+				So(s.stats.snapshot()["batches"], ShouldEqual, data.Int(3))
+				So(s.fitQueue.len(), ShouldEqual, 0)
+			})
+		})
+	})
+}
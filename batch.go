@@ -0,0 +1,147 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"time"
+)
+
+// PredictBatch applies the model to samples by one call of `predict_batch`
+// method, or the method given by predict_batch_method, which receives a list
+// of samples and must return a list of predictions in the same order. Each
+// sample is converted in the same way as Predict, and the call is subject to
+// predict_timeout and retries in the same way. Calling Python once per batch
+// greatly reduces the overhead of cgo and the GIL compared to calling Predict
+// for each sample.
+//
+// When feedback is enabled, all samples in the batch receive the prediction
+// retained before the batch, and the prediction of the last sample is
+// retained after it, because samples are predicted at once.
+func (s *State) PredictBatch(ctx *core.Context, samples []data.Value) (data.Array, error) {
+	return s.predictBatch(ctx, samples, -1)
+}
+
+// predictBatch is the implementation of PredictBatch. timeout overrides
+// predict_timeout unless it's negative.
+func (s *State) predictBatch(ctx *core.Context, samples []data.Value, timeout time.Duration) (
+	data.Array, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	if len(samples) == 0 {
+		return data.Array{}, nil
+	}
+	if timeout < 0 {
+		timeout = s.params.PredictTimeout
+	}
+
+	inputs := samples
+	if s.feedback != nil {
+		inputs = make([]data.Value, len(samples))
+		for i, dt := range samples {
+			var err error
+			if inputs[i], err = s.feedback.apply(dt); err != nil {
+				return nil, err
+			}
+		}
+	}
+	converted, arg, err := s.convertBatch(inputs)
+	if err != nil {
+		return nil, err
+	}
+	if s.drift != nil {
+		for _, v := range converted {
+			s.drift.observePrediction(v)
+		}
+	}
+
+	method := s.predictBatchMethod()
+	res, err := s.callWithRetry(func() (data.Value, error) {
+		return s.timeouts.callWithTimeout(timeout, &s.timeouts.predict, method,
+			func() (data.Value, error) {
+				return s.callServing(method, arg)
+			})
+	})
+	if err != nil && isMissingAttribute(err) {
+		err = &notSupportedError{feature: "batch prediction", method: method}
+	}
+	var preds data.Array
+	if err == nil {
+		preds, err = checkBatchPredictions(method, res, len(samples))
+	}
+	s.traceBatch(ctx, samples, err)
+	if err != nil {
+		return nil, err
+	}
+	if s.feedback != nil {
+		s.feedback.record(preds[len(preds)-1])
+	}
+	return preds, nil
+}
+
+// checkBatchPredictions validates a result of the batch prediction method.
+func checkBatchPredictions(method string, res data.Value, n int) (data.Array, error) {
+	preds, err := data.AsArray(res)
+	if err != nil {
+		return nil, fmt.Errorf("%v must return an array: %v", method, err)
+	}
+	if len(preds) != n {
+		return nil, fmt.Errorf("%v returned %v predictions for %v samples",
+			method, len(preds), n)
+	}
+	return preds, nil
+}
+
+// traceBatch logs the result of a batch prediction for each traced sample in
+// the same way as Predict.
+func (s *State) traceBatch(ctx *core.Context, samples []data.Value, err error) {
+	for _, dt := range samples {
+		traceID, traced := s.traceID(dt)
+		if !traced {
+			continue
+		}
+		if err != nil {
+			ctx.ErrLog(err).WithField("trace_id", traceID).
+				Warn("pymlstate's prediction failed")
+		} else {
+			ctx.Log().WithField("trace_id", traceID).
+				Debug("pymlstate predicted")
+		}
+	}
+}
+
+// predictBatchMethod returns the name of the method called by PredictBatch.
+// Empty PredictBatchMethod means "predict_batch".
+func (s *State) predictBatchMethod() string {
+	if s.params.PredictBatchMethod == "" {
+		return "predict_batch"
+	}
+	return s.params.PredictBatchMethod
+}
+
+// PredictBatch applies the model to an array of samples at once and returns
+// an array of predictions, e.g. for samples in a window. Each prediction is
+// formatted and attached with the id in the same way as pymlstate_predict.
+// The Python class must define `predict_batch` method or the method given by
+// predict_batch_method. See State.PredictBatch for details.
+func PredictBatch(ctx *core.Context, stateName string, samples []data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	preds, err := s.PredictBatch(ctx, samples)
+	if err != nil {
+		return nil, err
+	}
+	res := make(data.Array, len(preds))
+	for i, p := range preds {
+		if p, err = s.formatPrediction(p); err != nil {
+			return nil, err
+		}
+		if res[i], err = s.attachID(samples[i], p); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
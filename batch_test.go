@@ -0,0 +1,119 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestPyMLStatePredictBatch(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate having predict_batch", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize: 1,
+			IDField:   "id",
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("predict_batch_test", "pymlstate", s), ShouldBeNil)
+		Reset(func() {
+			ctx.SharedStates.Remove("predict_batch_test")
+			s.Terminate(ctx)
+		})
+
+		Convey("When predict an array of samples", func() {
+			res, err := PredictBatch(ctx, "predict_batch_test", []data.Value{
+				data.Map{"id": data.Int(1), "data": data.Int(1)},
+				data.Map{"id": data.Int(2), "data": data.Int(2)},
+			})
+
+			Convey("Then a prediction of each sample should be returned in order", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Array{
+					data.Map{"id": data.Int(1), "prediction": data.String("predict called")},
+					data.Map{"id": data.Int(2), "prediction": data.String("predict called")},
+				})
+			})
+		})
+
+		Convey("When predict an empty array", func() {
+			res, err := PredictBatch(ctx, "predict_batch_test", nil)
+
+			Convey("Then an empty array should be returned", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Array{})
+			})
+		})
+	})
+
+	Convey("Given a pymlstate with predict_batch_method and predict_timeout", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		newState := func(timeout time.Duration) *State {
+			s, err := New(baseParams, &MLParams{
+				BatchSize:          1,
+				PredictBatchMethod: "slow_predict_batch",
+				PredictTimeout:     timeout,
+			}, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				for i := 0; i < 100 && s.timeouts.checkOutstanding() != nil; i++ {
+					time.Sleep(10 * time.Millisecond)
+				}
+				s.Terminate(ctx)
+			})
+			return s
+		}
+
+		Convey("When the method returns in time", func() {
+			s := newState(5 * time.Second)
+			res, err := s.PredictBatch(ctx, []data.Value{data.Int(1)})
+
+			Convey("Then the configured method should be called", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Array{data.String("slow predict called")})
+			})
+		})
+
+		Convey("When the method doesn't return in time", func() {
+			s := newState(10 * time.Millisecond)
+			_, err := s.PredictBatch(ctx, []data.Value{data.Int(1)})
+
+			Convey("Then it should time out", func() {
+				So(err, ShouldNotBeNil)
+				So(s.Status()["predict_timeouts"], ShouldEqual, data.Int(1))
+			})
+		})
+	})
+
+	Convey("Given a pymlstate not having predict_batch", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "PartialClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When predict an array of samples", func() {
+			_, err := s.PredictBatch(ctx, []data.Value{data.Int(1)})
+			Convey("Then it should fail as not supported", func() {
+				So(isNotSupported(err), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,93 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+const (
+	saveBestModeMax = "max"
+	saveBestModeMin = "min"
+)
+
+func validateSaveBest(saveBest bool, mode, path string) error {
+	switch mode {
+	case saveBestModeMax, saveBestModeMin:
+	default:
+		return fmt.Errorf("save_best_mode must be '%v' or '%v': %v",
+			saveBestModeMax, saveBestModeMin, mode)
+	}
+	if saveBest && path == "" {
+		return fmt.Errorf("save_best requires save_model_path")
+	}
+	return nil
+}
+
+// bestTracker keeps the best value of the metric monitored by save_best. It
+// has its own lock because fit is called while holding the read lock of
+// State, and the lock is held while saving so that concurrent fits don't
+// write the file at the same time.
+type bestTracker struct {
+	m     sync.Mutex
+	found bool
+	value float64
+	step  int64
+}
+
+// saveIfBest saves the state to save_model_path when the monitored metric in
+// metrics improved. step is the number of batches the model has been trained
+// with. Results not having the metric are ignored. The caller must hold the
+// lock of the state.
+func (s *State) saveIfBest(ctx *core.Context, metrics data.Value, step int64) {
+	m, err := data.AsMap(metrics)
+	if err != nil {
+		return
+	}
+	v, ok := m[s.params.SaveBestMetric]
+	if !ok {
+		return
+	}
+	f, err := data.ToFloat(v)
+	if err != nil {
+		ctx.ErrLog(err).WithField("metric", s.params.SaveBestMetric).
+			Warn("pymlstate cannot monitor a non-numeric metric for save_best")
+		return
+	}
+
+	b := &s.best
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.found {
+		if s.params.SaveBestMode == saveBestModeMin && f >= b.value ||
+			s.params.SaveBestMode != saveBestModeMin && f <= b.value {
+			return
+		}
+	}
+	if err := s.saveFile(ctx, s.params.SaveModelPath); err != nil {
+		ctx.ErrLog(err).WithField("path", s.params.SaveModelPath).
+			Error("pymlstate cannot save the best model")
+		return
+	}
+	b.found = true
+	b.value = f
+	b.step = step
+}
+
+// status returns the best value and the step at which it was achieved. Both
+// are null until a model is saved.
+func (b *bestTracker) status() data.Map {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if !b.found {
+		return data.Map{
+			"best_metric": data.Null{},
+			"best_step":   data.Null{},
+		}
+	}
+	return data.Map{
+		"best_metric": data.Float(b.value),
+		"best_step":   data.Int(b.step),
+	}
+}
@@ -0,0 +1,93 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPyMLStateSaveBest(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with save_best", t, func() {
+		dir, err := ioutil.TempDir("", "pymlstate_best")
+		So(err, ShouldBeNil)
+		path := filepath.Join(dir, "best.state")
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "ValidationClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:      1,
+			SaveBest:       true,
+			SaveBestMetric: "val_accuracy",
+			SaveBestMode:   saveBestModeMax,
+			SaveModelPath:  path,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+			os.RemoveAll(dir)
+		})
+		fit := func(acc float64) {
+			_, err := s.Fit(ctx, []data.Value{data.Float(acc)})
+			So(err, ShouldBeNil)
+		}
+		fitCount := func() data.Value {
+			f, err := os.Open(path)
+			So(err, ShouldBeNil)
+			defer f.Close()
+			st, err := (&StateCreator{}).LoadState(ctx, f, data.Map{})
+			So(err, ShouldBeNil)
+			defer st.Terminate(ctx)
+			cnt, err := st.(*State).base.Call("confirm_to_call_fit")
+			So(err, ShouldBeNil)
+			return cnt
+		}
+
+		Convey("When the metric doesn't improve", func() {
+			fit(0.5)
+			fit(0.3)
+			Convey("Then the best model should be kept", func() {
+				So(fitCount(), ShouldEqual, data.Int(1))
+				st := s.Status()
+				So(st["best_metric"], ShouldEqual, data.Float(0.5))
+				So(st["best_step"], ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When the metric improves", func() {
+			fit(0.5)
+			fit(0.3)
+			fit(0.7)
+			Convey("Then the best model should be overwritten", func() {
+				So(fitCount(), ShouldEqual, data.Int(3))
+				st := s.Status()
+				So(st["best_metric"], ShouldEqual, data.Float(0.7))
+				So(st["best_step"], ShouldEqual, data.Int(3))
+			})
+		})
+	})
+
+	Convey("Given parameters of save_best", t, func() {
+		Convey("When save_model_path isn't given", func() {
+			err := validateSaveBest(true, saveBestModeMax, "")
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When save_best_mode is invalid", func() {
+			err := validateSaveBest(false, "avg", "")
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
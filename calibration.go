@@ -0,0 +1,110 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+)
+
+var (
+	labelPath = data.MustCompilePath("label")
+)
+
+// Calibration computes a reliability diagram and the expected calibration
+// error (ECE) of probabilities returned by `predict_proba` method. Each row
+// must be a `data.Map` having "data" and "label" fields, which are the same
+// fields used by Write and the MNIST example. "label" is the index of the
+// correct class.
+//
+// It returns a `data.Map` having "bins" and "ece". "bins" is an array of maps
+// having "lower", "upper", "count", "confidence", and "accuracy" of each
+// confidence bin.
+func (s *State) Calibration(ctx *core.Context, rows []data.Value, bins int) (data.Value, error) {
+	if bins <= 0 {
+		return nil, fmt.Errorf("bins must be greater than 0")
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("rows must not be empty")
+	}
+
+	counts := make([]int, bins)
+	confSums := make([]float64, bins)
+	corrects := make([]int, bins)
+	for i, r := range rows {
+		m, err := data.AsMap(r)
+		if err != nil {
+			return nil, fmt.Errorf("row %v isn't a map: %v", i, err)
+		}
+		dt, err := m.Get(datPath)
+		if err != nil {
+			return nil, fmt.Errorf("row %v doesn't have data: %v", i, err)
+		}
+		l, err := m.Get(labelPath)
+		if err != nil {
+			return nil, fmt.Errorf("row %v doesn't have label: %v", i, err)
+		}
+		label, err := data.ToInt(l)
+		if err != nil {
+			return nil, fmt.Errorf("label of row %v isn't an integer: %v", i, err)
+		}
+
+		proba, err := s.predictProba(ctx, dt)
+		if err != nil {
+			return nil, err
+		}
+		pred := argmax(proba)
+		if pred < 0 {
+			return nil, fmt.Errorf("predict_proba returned an empty array")
+		}
+		conf := proba[pred]
+		b := int(conf * float64(bins))
+		if b >= bins {
+			b = bins - 1
+		} else if b < 0 {
+			b = 0
+		}
+		counts[b]++
+		confSums[b] += conf
+		if int64(pred) == label {
+			corrects[b]++
+		}
+	}
+
+	ece := 0.0
+	res := make(data.Array, bins)
+	for b := 0; b < bins; b++ {
+		bin := data.Map{
+			"lower": data.Float(float64(b) / float64(bins)),
+			"upper": data.Float(float64(b+1) / float64(bins)),
+			"count": data.Int(counts[b]),
+		}
+		if counts[b] == 0 {
+			bin["confidence"] = data.Null{}
+			bin["accuracy"] = data.Null{}
+		} else {
+			conf := confSums[b] / float64(counts[b])
+			acc := float64(corrects[b]) / float64(counts[b])
+			bin["confidence"] = data.Float(conf)
+			bin["accuracy"] = data.Float(acc)
+			ece += float64(counts[b]) / float64(len(rows)) * math.Abs(acc-conf)
+		}
+		res[b] = bin
+	}
+	return data.Map{
+		"bins": res,
+		"ece":  data.Float(ece),
+	}, nil
+}
+
+// Calibration computes calibration metrics of the model over rows. The model
+// must have `predict_proba` method. See State.Calibration for details.
+func Calibration(ctx *core.Context, stateName string, rows []data.Value, bins int) (
+	data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Calibration(ctx, rows, bins)
+}
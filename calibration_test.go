@@ -0,0 +1,62 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateCalibration(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate having predict_proba", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When compute calibration", func() {
+			// predict_proba always returns [0.1, 0.4, 0.4, 0.1], so the
+			// predicted class is 1 with confidence 0.4.
+			rows := []data.Value{
+				data.Map{"data": data.Int(0), "label": data.Int(1)},
+				data.Map{"data": data.Int(0), "label": data.Int(2)},
+			}
+			v, err := s.Calibration(ctx, rows, 5)
+			So(err, ShouldBeNil)
+			res, err := data.AsMap(v)
+			So(err, ShouldBeNil)
+
+			Convey("Then all rows should fall in the same bin", func() {
+				bins, err := data.AsArray(res["bins"])
+				So(err, ShouldBeNil)
+				So(len(bins), ShouldEqual, 5)
+				bin, err := data.AsMap(bins[2])
+				So(err, ShouldBeNil)
+				So(bin["count"], ShouldEqual, data.Int(2))
+				So(bin["accuracy"], ShouldEqual, data.Float(0.5))
+			})
+
+			Convey("Then ECE should be the gap between accuracy and confidence", func() {
+				ece, err := data.AsFloat(res["ece"])
+				So(err, ShouldBeNil)
+				So(ece, ShouldAlmostEqual, 0.1, 1e-9)
+			})
+		})
+
+		Convey("When compute calibration with a row without label", func() {
+			_, err := s.Calibration(ctx, []data.Value{data.Map{"data": data.Int(0)}}, 5)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,106 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"os"
+	"sync"
+	"time"
+)
+
+func validateCheckpoint(interval time.Duration, keep int, path string) error {
+	if interval < 0 {
+		return fmt.Errorf("checkpoint_interval must not be negative")
+	}
+	if keep <= 0 {
+		return fmt.Errorf("checkpoint_keep must be greater than 0")
+	}
+	if interval > 0 && path == "" {
+		return fmt.Errorf("checkpoint_interval requires checkpoint_path")
+	}
+	return nil
+}
+
+// checkpointer keeps when the last periodic checkpoint was saved. It has its
+// own lock because fit is called while holding the read lock of State, and
+// the lock is held while saving so that concurrent fits don't rotate files at
+// the same time.
+type checkpointer struct {
+	m     sync.Mutex
+	last  time.Time
+	saved int64
+}
+
+// checkpointIfDue saves the state to checkpoint_path when checkpoint_interval
+// has passed since the last checkpoint. Older checkpoints are rotated so that
+// the last checkpoint_keep checkpoints are retained. A failure is logged and
+// doesn't stop training. The caller must hold the lock of the state.
+func (s *State) checkpointIfDue(ctx *core.Context) {
+	c := &s.checkpoint
+	c.m.Lock()
+	defer c.m.Unlock()
+	now := time.Now()
+	if !c.last.IsZero() && now.Sub(c.last) < s.params.CheckpointInterval {
+		return
+	}
+
+	// The new checkpoint is saved before rotation so that the existing ones
+	// are kept when saving fails.
+	path := s.params.CheckpointPath
+	next := path + ".next"
+	if err := s.saveFile(ctx, next); err != nil {
+		ctx.ErrLog(err).WithField("path", path).
+			Error("pymlstate cannot save a checkpoint")
+		return
+	}
+	if err := rotateFiles(path, s.params.CheckpointKeep); err != nil {
+		ctx.ErrLog(err).WithField("path", path).
+			Error("pymlstate cannot rotate checkpoints")
+		os.Remove(next)
+		return
+	}
+	if err := os.Rename(next, path); err != nil {
+		ctx.ErrLog(err).WithField("path", path).
+			Error("pymlstate cannot save a checkpoint")
+		return
+	}
+	c.last = now
+	c.saved++
+}
+
+// rotateFiles renames path to path.1, path.1 to path.2, and so on, so that
+// path can be written without losing keep-1 older files. The oldest file is
+// removed. Missing files are skipped.
+func rotateFiles(path string, keep int) error {
+	name := func(i int) string {
+		if i == 0 {
+			return path
+		}
+		return fmt.Sprintf("%v.%v", path, i)
+	}
+	if err := os.Remove(name(keep - 1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := keep - 2; i >= 0; i-- {
+		if err := os.Rename(name(i), name(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// status returns the number of periodic checkpoints saved and when the last
+// one was saved, which is null before the first checkpoint.
+func (c *checkpointer) status() data.Map {
+	c.m.Lock()
+	defer c.m.Unlock()
+	m := data.Map{
+		"checkpoints":        data.Int(c.saved),
+		"last_checkpoint_at": data.Null{},
+	}
+	if !c.last.IsZero() {
+		m["last_checkpoint_at"] = data.Timestamp(c.last)
+	}
+	return m
+}
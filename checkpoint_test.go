@@ -0,0 +1,102 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotateFiles(t *testing.T) {
+	Convey("Given rotated files", t, func() {
+		dir, err := ioutil.TempDir("", "pymlstate_rotate")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "model.state")
+		So(ioutil.WriteFile(path, []byte("2"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(path+".1", []byte("1"), 0644), ShouldBeNil)
+
+		Convey("When rotate them keeping 2 files", func() {
+			So(rotateFiles(path, 2), ShouldBeNil)
+			Convey("Then the oldest file should be removed", func() {
+				_, err := os.Stat(path)
+				So(os.IsNotExist(err), ShouldBeTrue)
+				b, err := ioutil.ReadFile(path + ".1")
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "2")
+			})
+		})
+	})
+}
+
+func TestPyMLStateCheckpointInterval(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with checkpoint_interval", t, func() {
+		dir, err := ioutil.TempDir("", "pymlstate_checkpoint")
+		So(err, ShouldBeNil)
+		path := filepath.Join(dir, "model.state")
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:          1,
+			CheckpointPath:     path,
+			CheckpointInterval: time.Millisecond,
+			CheckpointKeep:     2,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+			os.RemoveAll(dir)
+		})
+
+		Convey("When fit several times", func() {
+			for i := 0; i < 3; i++ {
+				_, err := s.Fit(ctx, []data.Value{data.Int(i)})
+				So(err, ShouldBeNil)
+				time.Sleep(2 * time.Millisecond)
+			}
+
+			Convey("Then the last checkpoints should be retained", func() {
+				_, err := os.Stat(path)
+				So(err, ShouldBeNil)
+				_, err = os.Stat(path + ".1")
+				So(err, ShouldBeNil)
+				_, err = os.Stat(path + ".2")
+				So(os.IsNotExist(err), ShouldBeTrue)
+				So(s.Status()["checkpoints"], ShouldEqual, data.Int(3))
+			})
+
+			Convey("Then the latest checkpoint should be loadable", func() {
+				f, err := os.Open(path)
+				So(err, ShouldBeNil)
+				defer f.Close()
+				c := &StateCreator{}
+				l, err := c.LoadState(ctx, f, data.Map{})
+				So(err, ShouldBeNil)
+				So(l.Terminate(ctx), ShouldBeNil)
+			})
+		})
+
+		Convey("When create it without checkpoint_path", func() {
+			_, err := New(baseParams, &MLParams{
+				BatchSize:          1,
+				CheckpointInterval: time.Second,
+				CheckpointKeep:     1,
+			}, data.Map{})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
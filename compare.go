@@ -0,0 +1,62 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// compare applies both models to each row and returns the agreement rate and
+// the indices of rows on which their outputs differ. Outputs of the two models
+// must have the same type so that they can be compared.
+func compare(ctx *core.Context, a, b model, rows []data.Value) (data.Value, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("rows must not be empty")
+	}
+
+	disagreements := data.Array{}
+	for i, r := range rows {
+		va, err := a.Predict(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := b.Predict(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		if va.Type() != vb.Type() {
+			return nil, fmt.Errorf("outputs for row %v aren't comparable: %v and %v",
+				i, va.Type(), vb.Type())
+		}
+		if !data.Equal(va, vb) {
+			disagreements = append(disagreements, data.Int(i))
+		}
+	}
+
+	agreed := len(rows) - len(disagreements)
+	return data.Map{
+		"agreement_rate": data.Float(float64(agreed) / float64(len(rows))),
+		"disagreements":  disagreements,
+	}, nil
+}
+
+// Compare applies two states to the same rows and reports how much their
+// predictions agree, e.g. to validate a new model against a baseline. Each
+// row is passed to predict as it is.
+//
+// It returns a `data.Map` having "agreement_rate", which is the ratio of rows
+// on which both states return the same output, and "disagreements", which is
+// an array of the indices of the other rows.
+func Compare(ctx *core.Context, stateA, stateB string, rows []data.Value) (
+	data.Value, error) {
+	a, err := lookupModel(ctx, stateA)
+	if err != nil {
+		return nil, err
+	}
+	b, err := lookupModel(ctx, stateB)
+	if err != nil {
+		return nil, err
+	}
+
+	return compare(ctx, a, b, rows)
+}
@@ -0,0 +1,67 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateCompare(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a constant pymlstate and an echoing pymlstate", t, func() {
+		newState := func(className string) *State {
+			baseParams := &pystate.BaseParams{
+				ModulePath: "./",
+				ModuleName: "_test_pymlstate",
+				ClassName:  className,
+			}
+			s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+			So(err, ShouldBeNil)
+			return s
+		}
+		c := newState("TestClass")
+		e := newState("EchoClass")
+		Reset(func() {
+			c.Terminate(ctx)
+			e.Terminate(ctx)
+		})
+
+		Convey("When compare them over rows", func() {
+			rows := []data.Value{
+				data.String("predict called"),
+				data.String("a"),
+				data.String("predict called"),
+				data.String("b"),
+			}
+			v, err := compare(ctx, c, e, rows)
+			So(err, ShouldBeNil)
+			res, err := data.AsMap(v)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should report the agreement rate", func() {
+				So(res["agreement_rate"], ShouldEqual, data.Float(0.5))
+			})
+
+			Convey("Then it should report disagreeing indices", func() {
+				So(res["disagreements"], ShouldResemble, data.Array{data.Int(1), data.Int(3)})
+			})
+		})
+
+		Convey("When compare them over rows producing different types", func() {
+			_, err := compare(ctx, c, e, []data.Value{data.Int(1)})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When compare them over empty rows", func() {
+			_, err := compare(ctx, c, e, nil)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
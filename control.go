@@ -0,0 +1,145 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"time"
+)
+
+const (
+	pausePolicyBuffer = "buffer"
+	pausePolicyDrop   = "drop"
+)
+
+// defaultDeferredMaxBucketSize is max_bucket_size applied when fit_on_write is
+// false and max_bucket_size isn't given, so that the bucket doesn't grow
+// without bound until it's flushed.
+const defaultDeferredMaxBucketSize = 10000
+
+func validatePausePolicy(p string) error {
+	switch p {
+	case pausePolicyBuffer, pausePolicyDrop:
+		return nil
+	default:
+		return fmt.Errorf("pause_policy must be '%v' or '%v': %v",
+			pausePolicyBuffer, pausePolicyDrop, p)
+	}
+}
+
+// Pause stops training via Write. While the state is paused, Write buffers or
+// drops tuples according to pause_policy.
+func (s *State) Pause(ctx *core.Context) error {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.checkTermination(); err != nil {
+		return err
+	}
+	s.paused = true
+	return nil
+}
+
+// Resume restarts training via Write. It also restarts training stopped by
+// early_stopping_patience. Tuples buffered while the state was
+// paused are trained in batches of batch_train_size. Tuples fewer than
+// batch_train_size remain in the bucket. When fit_on_write is false, buffered
+// tuples remain in the bucket until it's flushed by pymlstate_flush or
+// max_flush_interval.
+func (s *State) Resume(ctx *core.Context) error {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.checkTermination(); err != nil {
+		return err
+	}
+	s.paused = false
+	if s.early != nil {
+		s.early.reset()
+	}
+	if s.params.DeferFit {
+		s.rescheduleFlush(ctx)
+		return nil
+	}
+	return s.fitFullBatches(ctx)
+}
+
+// bufferWhilePaused stores dataSet to the bucket without training. dataSet is
+// dropped when pause_policy is "drop" or the bucket already has
+// max_bucket_size tuples.
+func (s *State) bufferWhilePaused(dataSet data.Value) {
+	if s.params.PausePolicy == pausePolicyDrop {
+		s.dropped++
+		return
+	}
+	s.buffer(dataSet)
+}
+
+// buffer stores dataSet to the bucket without training. dataSet is dropped
+// when the bucket already has max_bucket_size tuples.
+func (s *State) buffer(dataSet data.Value) {
+	values := []data.Value{dataSet}
+	if s.params.BatchSize <= 1 && dataSet.Type() == data.TypeArray {
+		values, _ = data.AsArray(dataSet)
+	}
+	for _, v := range values {
+		if s.params.MaxBucketSize > 0 && len(s.bucket) >= s.params.MaxBucketSize {
+			s.dropped++
+			continue
+		}
+		if len(s.bucket) == 0 {
+			s.bucketSince = time.Now()
+		}
+		s.bucket = append(s.bucket, v)
+	}
+	s.recomputeBucketBytes()
+}
+
+// fitFullBatches trains the model with tuples in the bucket in batches of
+// batch_train_size. A flush of the remaining tuples is scheduled when
+// max_flush_interval is given, because no following Write starts a new
+// bucket which would schedule it. The caller must hold the write lock.
+func (s *State) fitFullBatches(ctx *core.Context) error {
+	defer func() {
+		s.recomputeBucketBytes()
+		s.rescheduleFlush(ctx)
+	}()
+	size := s.params.BatchSize
+	if size <= 0 {
+		size = 1
+	}
+
+	n := 0
+	for ; len(s.bucket)-n >= size; n += size {
+		if _, err := s.fit(ctx, s.bucket[n:n+size]); err != nil {
+			s.bucket = append(s.bucket[:0], s.bucket[n+size:]...)
+			ctx.ErrLog(err).WithField("bucket_size", size).
+				Error("pymlstate's training of buffered tuples failed")
+			return err
+		}
+	}
+	s.bucket = append(s.bucket[:0], s.bucket[n:]...)
+	return nil
+}
+
+// Pause stops training of the state via INSERT INTO. It returns NULL.
+func Pause(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Pause(ctx); err != nil {
+		return nil, err
+	}
+	return data.Null{}, nil
+}
+
+// Resume restarts training of the state paused by Pause. It returns NULL.
+func Resume(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Resume(ctx); err != nil {
+		return nil, err
+	}
+	return data.Null{}, nil
+}
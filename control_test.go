@@ -0,0 +1,110 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStatePauseAndResume(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate for pause test", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		mlParams := &MLParams{
+			BatchSize:     2,
+			PausePolicy:   pausePolicyBuffer,
+			MaxBucketSize: 4,
+		}
+		s, err := New(baseParams, mlParams, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+		write := func(n int) {
+			for i := 0; i < n; i++ {
+				tu := &core.Tuple{
+					Data: data.Map{
+						"data": data.Int(i),
+					},
+				}
+				So(s.Write(ctx, tu), ShouldBeNil)
+			}
+		}
+
+		Convey("When write tuples while paused", func() {
+			So(s.Pause(ctx), ShouldBeNil)
+			write(5)
+			Convey("Then fit should not be called", func() {
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, 0)
+				So(len(s.bucket), ShouldEqual, 4)
+				So(s.Status()["paused"], ShouldEqual, data.True)
+				So(s.Status()["dropped_tuples"], ShouldEqual, data.Int(1))
+			})
+
+			Convey("And when resume", func() {
+				So(s.Resume(ctx), ShouldBeNil)
+				Convey("Then buffered tuples should be trained in batches", func() {
+					cnt, err := s.base.Call("confirm_to_call_fit")
+					So(err, ShouldBeNil)
+					So(cnt, ShouldEqual, 2)
+					So(len(s.bucket), ShouldEqual, 0)
+					So(s.Status()["paused"], ShouldEqual, data.False)
+				})
+			})
+		})
+
+		Convey("When write tuples while paused with drop policy", func() {
+			s.params.PausePolicy = pausePolicyDrop
+			So(s.Pause(ctx), ShouldBeNil)
+			write(3)
+			Convey("Then all tuples should be dropped", func() {
+				So(len(s.bucket), ShouldEqual, 0)
+				So(s.Status()["dropped_tuples"], ShouldEqual, data.Int(3))
+			})
+		})
+
+		Convey("When write tuples with fit_on_write disabled", func() {
+			s.params.DeferFit = true
+			write(5)
+			Convey("Then fit should not be called", func() {
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, 0)
+				So(len(s.bucket), ShouldEqual, 4)
+				So(s.Status()["fit_on_write"], ShouldEqual, data.False)
+				So(s.Status()["dropped_tuples"], ShouldEqual, data.Int(1))
+			})
+
+			Convey("And when flush", func() {
+				_, err := s.Flush(ctx)
+				So(err, ShouldBeNil)
+				Convey("Then buffered tuples should be trained at once", func() {
+					cnt, err := s.base.Call("confirm_to_call_fit")
+					So(err, ShouldBeNil)
+					So(cnt, ShouldEqual, 1)
+					So(len(s.bucket), ShouldEqual, 0)
+				})
+			})
+
+			Convey("And when pause and resume", func() {
+				So(s.Pause(ctx), ShouldBeNil)
+				So(s.Resume(ctx), ShouldBeNil)
+				Convey("Then buffered tuples should not be trained", func() {
+					cnt, err := s.base.Call("confirm_to_call_fit")
+					So(err, ShouldBeNil)
+					So(cnt, ShouldEqual, 0)
+					So(len(s.bucket), ShouldEqual, 4)
+				})
+			})
+		})
+	})
+}
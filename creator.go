@@ -7,10 +7,76 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"io"
+	"time"
 )
 
 var (
 	batchTrainSizePath = data.MustCompilePath("batch_train_size")
+	saveMaxBytesPath   = data.MustCompilePath("save_max_bytes")
+	featureOrderPath   = data.MustCompilePath("feature_order")
+	predHistSizePath   = data.MustCompilePath("prediction_history_size")
+	workerIDPath       = data.MustCompilePath("worker_id")
+	featureClipMinPath = data.MustCompilePath("feature_clip_min")
+	featureClipMaxPath = data.MustCompilePath("feature_clip_max")
+	rejectNaNPath      = data.MustCompilePath("reject_nan_features")
+	pausePolicyPath    = data.MustCompilePath("pause_policy")
+	maxBucketSizePath  = data.MustCompilePath("max_bucket_size")
+	reprMaxLengthPath  = data.MustCompilePath("repr_max_length")
+	predictFormatPath  = data.MustCompilePath("predict_format")
+	enforceFeatDimPath = data.MustCompilePath("enforce_feature_dim")
+	nullHandlingPath   = data.MustCompilePath("null_handling")
+	driftMonitorPath   = data.MustCompilePath("drift_monitor")
+	driftWindowPath    = data.MustCompilePath("drift_window")
+	feedbackPath       = data.MustCompilePath("feedback")
+	feedbackKeyPath    = data.MustCompilePath("feedback_key")
+	onnxExportPath     = data.MustCompilePath("onnx_export_method")
+	fitOnWritePath     = data.MustCompilePath("fit_on_write")
+	traceFieldPath     = data.MustCompilePath("trace_field")
+	checkpointPathPath = data.MustCompilePath("checkpoint_path")
+	checkpointIntPath  = data.MustCompilePath("checkpoint_interval")
+	checkpointKeepPath = data.MustCompilePath("checkpoint_keep")
+	maxFlushIntPath    = data.MustCompilePath("max_flush_interval")
+	flushOnTermPath    = data.MustCompilePath("flush_on_terminate")
+	fitMethodPath      = data.MustCompilePath("fit_method")
+	predictMethodPath  = data.MustCompilePath("predict_method")
+	predictBatchPath   = data.MustCompilePath("predict_batch_method")
+	constructorArgPath = data.MustCompilePath("constructor_args")
+	asyncFitPath       = data.MustCompilePath("async_fit")
+	fitQueueSizePath   = data.MustCompilePath("fit_queue_size")
+	overflowPolicyPath = data.MustCompilePath("overflow_policy")
+	maxBatchBytesPath  = data.MustCompilePath("max_batch_bytes")
+	sparseThreshPath   = data.MustCompilePath("sparse_threshold")
+	lazyInitPath       = data.MustCompilePath("lazy_init")
+	metricsPosPath     = data.MustCompilePath("metrics_positions")
+	metricsPath        = data.MustCompilePath("metrics")
+	fitEventBufferPath = data.MustCompilePath("fit_event_buffer")
+	esPatiencePath     = data.MustCompilePath("early_stopping_patience")
+	esMinDeltaPath     = data.MustCompilePath("early_stopping_min_delta")
+	esMetricPath       = data.MustCompilePath("early_stopping_metric")
+	doubleBufferPath   = data.MustCompilePath("double_buffer")
+	warmupSamplePath   = data.MustCompilePath("warmup_sample")
+	fitTimeoutPath     = data.MustCompilePath("fit_timeout")
+	predictTimeoutPath = data.MustCompilePath("predict_timeout")
+	retryMaxPath       = data.MustCompilePath("retry_max_attempts")
+	retryBackoffPath   = data.MustCompilePath("retry_backoff")
+	retryErrorsPath    = data.MustCompilePath("retry_errors")
+	partialFitPath     = data.MustCompilePath("partial_fit")
+	replayBufferPath   = data.MustCompilePath("replay_buffer")
+	replayDumpPath     = data.MustCompilePath("replay_dump_path")
+	predictAsScorePath = data.MustCompilePath("predict_as_scores")
+	classNamesPath     = data.MustCompilePath("class_names")
+	numClassesPath     = data.MustCompilePath("num_classes")
+	saveBestPath       = data.MustCompilePath("save_best")
+	saveBestMetricPath = data.MustCompilePath("save_best_metric")
+	saveBestModePath   = data.MustCompilePath("save_best_mode")
+	saveModelPathPath  = data.MustCompilePath("save_model_path")
+	dedupKeyPath       = data.MustCompilePath("dedup_key")
+	dedupWindowPath    = data.MustCompilePath("dedup_window")
+	onInvalidMetPath   = data.MustCompilePath("on_invalid_metrics")
+	outputsPath        = data.MustCompilePath("outputs")
+	normalizeProbaPath = data.MustCompilePath("normalize_proba")
+	idFieldPath        = data.MustCompilePath("id_field")
+	idRequiredPath     = data.MustCompilePath("id_required")
 )
 
 // StateCreator is used by BQL to create or load Multiple Layer Classification
@@ -22,14 +88,92 @@ var _ udf.UDSLoader = &StateCreator{}
 
 // CreateState creates `core.SharedState`. Some parameters are from pystate
 // package. See the document of pystate.BaseParams for details. pymlstate has
-// its own parameters, which is defined at MLParams.
+// its own parameters, which is defined at MLParams. Other parameters are
+// passed to the Python constructor as keyword arguments.
+//
+// constructor_args is a map whose entries are also passed to the Python
+// constructor as keyword arguments, e.g. constructor_args = {"lr": 0.01,
+// "gpu": 0}, so that hyperparameters can be grouped apart from parameters of
+// pymlstate. A key given both in it and as a parameter results in an error.
+//
+// worker_id is validated to be a string or an integer and passed to the
+// Python constructor as it is, so that a model can know which worker it is,
+// e.g. to set its rank in distributed training. Coordination among workers
+// is the responsibility of the Python class.
+//
+// A LifecycleObserver registered by SetLifecycleObserver is notified of the
+// result.
 func (c *StateCreator) CreateState(ctx *core.Context, params data.Map) (
 	core.SharedState, error) {
+	name := observedName(params)
+	s, err := c.createState(ctx, params)
+	notifyCreate(name, err)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *StateCreator) createState(ctx *core.Context, params data.Map) (
+	*State, error) {
 	bp, err := pystate.ExtractBaseParams(params, true)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := validateWorkerID(params); err != nil {
+		return nil, err
+	}
+
+	mp, err := extractMLParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mergeConstructorArgs(params); err != nil {
+		return nil, err
+	}
+	return New(bp, mp, params)
+}
+
+// mergeConstructorArgs moves entries of constructor_args to params so that
+// they're passed to the Python constructor as keyword arguments.
+func mergeConstructorArgs(params data.Map) error {
+	ca, err := params.Get(constructorArgPath)
+	if err != nil {
+		return nil
+	}
+	args, err := data.AsMap(ca)
+	if err != nil {
+		return fmt.Errorf("constructor_args must be a map: %v", err)
+	}
+	delete(params, "constructor_args")
+	for k, v := range args {
+		if _, ok := params[k]; ok {
+			return fmt.Errorf("'%v' is given both in constructor_args and as a parameter", k)
+		}
+		params[k] = v
+	}
+	return nil
+}
+
+func validateWorkerID(params data.Map) error {
+	w, err := params.Get(workerIDPath)
+	if err != nil {
+		return nil
+	}
+	switch w.Type() {
+	case data.TypeString, data.TypeInt:
+		return nil
+	default:
+		return fmt.Errorf("worker_id must be a string or an integer: %v", w.Type())
+	}
+}
+
+// extractMLParams extracts MLParams from params. Parameters used by MLParams
+// are removed from params so that the remaining ones can be passed to the
+// Python constructor.
+func extractMLParams(params data.Map) (*MLParams, error) {
 	batchSize := 1
 	if bs, err := params.Get(batchTrainSizePath); err == nil {
 		var batchSize64 int64
@@ -43,7 +187,755 @@ func (c *StateCreator) CreateState(ctx *core.Context, params data.Map) (
 		delete(params, "batch_train_size")
 	}
 
-	return New(bp, &MLParams{BatchSize: batchSize}, params)
+	saveMaxBytes := 0
+	if smb, err := params.Get(saveMaxBytesPath); err == nil {
+		var saveMaxBytes64 int64
+		if saveMaxBytes64, err = data.AsInt(smb); err != nil {
+			return nil, err
+		}
+		if saveMaxBytes64 < 0 {
+			return nil, fmt.Errorf("save_max_bytes must not be negative")
+		}
+		saveMaxBytes = int(saveMaxBytes64)
+		delete(params, "save_max_bytes")
+	}
+
+	var featureOrder []string
+	if fo, err := params.Get(featureOrderPath); err == nil {
+		arr, err := data.AsArray(fo)
+		if err != nil {
+			return nil, err
+		}
+		if len(arr) == 0 {
+			return nil, fmt.Errorf("feature_order must not be empty")
+		}
+		featureOrder = make([]string, len(arr))
+		for i, v := range arr {
+			if featureOrder[i], err = data.AsString(v); err != nil {
+				return nil, err
+			}
+		}
+		delete(params, "feature_order")
+	}
+
+	predHistSize := defaultPredictionHistorySize
+	if phs, err := params.Get(predHistSizePath); err == nil {
+		var predHistSize64 int64
+		if predHistSize64, err = data.AsInt(phs); err != nil {
+			return nil, err
+		}
+		if predHistSize64 <= 0 {
+			return nil, fmt.Errorf("prediction_history_size must be greater than 0")
+		}
+		predHistSize = int(predHistSize64)
+		delete(params, "prediction_history_size")
+	}
+
+	var clipMin, clipMax *float64
+	if cm, err := params.Get(featureClipMinPath); err == nil {
+		f, err := data.ToFloat(cm)
+		if err != nil {
+			return nil, err
+		}
+		clipMin = &f
+		delete(params, "feature_clip_min")
+	}
+	if cm, err := params.Get(featureClipMaxPath); err == nil {
+		f, err := data.ToFloat(cm)
+		if err != nil {
+			return nil, err
+		}
+		clipMax = &f
+		delete(params, "feature_clip_max")
+	}
+	if clipMin != nil && clipMax != nil && *clipMin > *clipMax {
+		return nil, fmt.Errorf("feature_clip_min must not be greater than feature_clip_max")
+	}
+
+	rejectNaN := false
+	if rn, err := params.Get(rejectNaNPath); err == nil {
+		if rejectNaN, err = data.AsBool(rn); err != nil {
+			return nil, err
+		}
+		delete(params, "reject_nan_features")
+	}
+
+	pausePolicy := pausePolicyBuffer
+	if pp, err := params.Get(pausePolicyPath); err == nil {
+		if pausePolicy, err = data.AsString(pp); err != nil {
+			return nil, err
+		}
+		if err := validatePausePolicy(pausePolicy); err != nil {
+			return nil, err
+		}
+		delete(params, "pause_policy")
+	}
+
+	maxBucketSize := 0
+	if mbs, err := params.Get(maxBucketSizePath); err == nil {
+		var maxBucketSize64 int64
+		if maxBucketSize64, err = data.AsInt(mbs); err != nil {
+			return nil, err
+		}
+		if maxBucketSize64 < 0 {
+			return nil, fmt.Errorf("max_bucket_size must not be negative")
+		}
+		maxBucketSize = int(maxBucketSize64)
+		delete(params, "max_bucket_size")
+	}
+
+	reprMaxLength := 1024
+	if rml, err := params.Get(reprMaxLengthPath); err == nil {
+		var reprMaxLength64 int64
+		if reprMaxLength64, err = data.AsInt(rml); err != nil {
+			return nil, err
+		}
+		if reprMaxLength64 < 0 {
+			return nil, fmt.Errorf("repr_max_length must not be negative")
+		}
+		reprMaxLength = int(reprMaxLength64)
+		delete(params, "repr_max_length")
+	}
+
+	predictFormat := predictFormatRaw
+	if pf, err := params.Get(predictFormatPath); err == nil {
+		if predictFormat, err = data.AsString(pf); err != nil {
+			return nil, err
+		}
+		if err := validatePredictFormat(predictFormat); err != nil {
+			return nil, err
+		}
+		delete(params, "predict_format")
+	}
+
+	enforceFeatDim := false
+	if efd, err := params.Get(enforceFeatDimPath); err == nil {
+		if enforceFeatDim, err = data.AsBool(efd); err != nil {
+			return nil, err
+		}
+		delete(params, "enforce_feature_dim")
+	}
+
+	nullHandling := nullHandlingNone
+	if nh, err := params.Get(nullHandlingPath); err == nil {
+		if nullHandling, err = data.AsString(nh); err != nil {
+			return nil, err
+		}
+		if err := validateNullHandling(nullHandling); err != nil {
+			return nil, err
+		}
+		delete(params, "null_handling")
+	}
+
+	driftMonitor := false
+	if dm, err := params.Get(driftMonitorPath); err == nil {
+		if driftMonitor, err = data.AsBool(dm); err != nil {
+			return nil, err
+		}
+		delete(params, "drift_monitor")
+	}
+
+	driftWindow := 1000
+	if dw, err := params.Get(driftWindowPath); err == nil {
+		var driftWindow64 int64
+		if driftWindow64, err = data.AsInt(dw); err != nil {
+			return nil, err
+		}
+		if driftWindow64 <= 0 {
+			return nil, fmt.Errorf("drift_window must be greater than 0")
+		}
+		driftWindow = int(driftWindow64)
+		delete(params, "drift_window")
+	}
+
+	feedback := false
+	if fb, err := params.Get(feedbackPath); err == nil {
+		if feedback, err = data.AsBool(fb); err != nil {
+			return nil, err
+		}
+		delete(params, "feedback")
+	}
+
+	feedbackKey := "feedback"
+	if fk, err := params.Get(feedbackKeyPath); err == nil {
+		if feedbackKey, err = data.AsString(fk); err != nil {
+			return nil, err
+		}
+		if feedbackKey == "" {
+			return nil, fmt.Errorf("feedback_key must not be empty")
+		}
+		delete(params, "feedback_key")
+	}
+
+	onnxExportMethod := defaultONNXExportMethod
+	if oem, err := params.Get(onnxExportPath); err == nil {
+		if onnxExportMethod, err = data.AsString(oem); err != nil {
+			return nil, err
+		}
+		if onnxExportMethod == "" {
+			return nil, fmt.Errorf("onnx_export_method must not be empty")
+		}
+		delete(params, "onnx_export_method")
+	}
+
+	fitOnWrite := true
+	if fow, err := params.Get(fitOnWritePath); err == nil {
+		if fitOnWrite, err = data.AsBool(fow); err != nil {
+			return nil, err
+		}
+		delete(params, "fit_on_write")
+	}
+
+	traceField := ""
+	if tf, err := params.Get(traceFieldPath); err == nil {
+		if traceField, err = data.AsString(tf); err != nil {
+			return nil, err
+		}
+		delete(params, "trace_field")
+	}
+
+	checkpointPath := ""
+	if cp, err := params.Get(checkpointPathPath); err == nil {
+		if checkpointPath, err = data.AsString(cp); err != nil {
+			return nil, err
+		}
+		delete(params, "checkpoint_path")
+	}
+
+	var checkpointInterval time.Duration
+	if ci, err := params.Get(checkpointIntPath); err == nil {
+		sec, err := data.ToFloat(ci)
+		if err != nil {
+			return nil, err
+		}
+		checkpointInterval = time.Duration(sec * float64(time.Second))
+		delete(params, "checkpoint_interval")
+	}
+
+	checkpointKeep := 3
+	if ck, err := params.Get(checkpointKeepPath); err == nil {
+		var checkpointKeep64 int64
+		if checkpointKeep64, err = data.AsInt(ck); err != nil {
+			return nil, err
+		}
+		checkpointKeep = int(checkpointKeep64)
+		delete(params, "checkpoint_keep")
+	}
+	if err := validateCheckpoint(checkpointInterval, checkpointKeep,
+		checkpointPath); err != nil {
+		return nil, err
+	}
+
+	sparseThreshold := 0.0
+	if st, err := params.Get(sparseThreshPath); err == nil {
+		if sparseThreshold, err = data.ToFloat(st); err != nil {
+			return nil, err
+		}
+		if sparseThreshold < 0 || sparseThreshold > 1 {
+			return nil, fmt.Errorf("sparse_threshold must be in [0, 1]")
+		}
+		delete(params, "sparse_threshold")
+	}
+
+	lazyInit := false
+	if li, err := params.Get(lazyInitPath); err == nil {
+		if lazyInit, err = data.AsBool(li); err != nil {
+			return nil, err
+		}
+		delete(params, "lazy_init")
+	}
+
+	var metricsPositions []string
+	if mp, err := params.Get(metricsPosPath); err == nil {
+		arr, err := data.AsArray(mp)
+		if err != nil {
+			return nil, err
+		}
+		metricsPositions = make([]string, len(arr))
+		for i, v := range arr {
+			if metricsPositions[i], err = data.AsString(v); err != nil {
+				return nil, err
+			}
+		}
+		delete(params, "metrics_positions")
+	}
+
+	var metrics []string
+	if mp, err := params.Get(metricsPath); err == nil {
+		arr, err := data.AsArray(mp)
+		if err != nil {
+			return nil, err
+		}
+		metrics = make([]string, len(arr))
+		for i, v := range arr {
+			if metrics[i], err = data.AsString(v); err != nil {
+				return nil, err
+			}
+		}
+		delete(params, "metrics")
+	}
+
+	fitEventBuffer := 0
+	if fb, err := params.Get(fitEventBufferPath); err == nil {
+		var fitEventBuffer64 int64
+		if fitEventBuffer64, err = data.AsInt(fb); err != nil {
+			return nil, err
+		}
+		if fitEventBuffer64 < 0 {
+			return nil, fmt.Errorf("fit_event_buffer must not be negative")
+		}
+		fitEventBuffer = int(fitEventBuffer64)
+		delete(params, "fit_event_buffer")
+	}
+
+	esPatience := 0
+	if p, err := params.Get(esPatiencePath); err == nil {
+		var esPatience64 int64
+		if esPatience64, err = data.AsInt(p); err != nil {
+			return nil, err
+		}
+		if esPatience64 < 0 {
+			return nil, fmt.Errorf("early_stopping_patience must not be negative")
+		}
+		esPatience = int(esPatience64)
+		delete(params, "early_stopping_patience")
+	}
+
+	esMinDelta := 0.0
+	if d, err := params.Get(esMinDeltaPath); err == nil {
+		if esMinDelta, err = data.ToFloat(d); err != nil {
+			return nil, err
+		}
+		if esMinDelta < 0 {
+			return nil, fmt.Errorf("early_stopping_min_delta must not be negative")
+		}
+		delete(params, "early_stopping_min_delta")
+	}
+
+	esMetric := "loss"
+	if m, err := params.Get(esMetricPath); err == nil {
+		if esMetric, err = data.AsString(m); err != nil {
+			return nil, err
+		}
+		delete(params, "early_stopping_metric")
+	}
+
+	doubleBuffer := false
+	if db, err := params.Get(doubleBufferPath); err == nil {
+		if doubleBuffer, err = data.AsBool(db); err != nil {
+			return nil, err
+		}
+		delete(params, "double_buffer")
+	}
+
+	var warmupSample data.Value
+	if ws, err := params.Get(warmupSamplePath); err == nil {
+		warmupSample = ws
+		delete(params, "warmup_sample")
+	}
+
+	replayBuffer := 0
+	if rb, err := params.Get(replayBufferPath); err == nil {
+		var replayBuffer64 int64
+		if replayBuffer64, err = data.AsInt(rb); err != nil {
+			return nil, err
+		}
+		if replayBuffer64 < 0 {
+			return nil, fmt.Errorf("replay_buffer must not be negative")
+		}
+		replayBuffer = int(replayBuffer64)
+		delete(params, "replay_buffer")
+	}
+
+	replayDump := ""
+	if rd, err := params.Get(replayDumpPath); err == nil {
+		if replayDump, err = data.AsString(rd); err != nil {
+			return nil, err
+		}
+		delete(params, "replay_dump_path")
+	}
+
+	predictAsScores := false
+	if pas, err := params.Get(predictAsScorePath); err == nil {
+		if predictAsScores, err = data.AsBool(pas); err != nil {
+			return nil, err
+		}
+		delete(params, "predict_as_scores")
+	}
+
+	var classNames []string
+	if cn, err := params.Get(classNamesPath); err == nil {
+		arr, err := data.AsArray(cn)
+		if err != nil {
+			return nil, err
+		}
+		classNames = make([]string, len(arr))
+		for i, v := range arr {
+			if classNames[i], err = data.AsString(v); err != nil {
+				return nil, err
+			}
+		}
+		delete(params, "class_names")
+	}
+
+	numClasses := 0
+	if nc, err := params.Get(numClassesPath); err == nil {
+		var numClasses64 int64
+		if numClasses64, err = data.AsInt(nc); err != nil {
+			return nil, err
+		}
+		numClasses = int(numClasses64)
+		delete(params, "num_classes")
+	}
+	if err := validateClassScores(predictAsScores, classNames, numClasses,
+		predictFormat); err != nil {
+		return nil, err
+	}
+
+	saveBest := false
+	if sb, err := params.Get(saveBestPath); err == nil {
+		if saveBest, err = data.AsBool(sb); err != nil {
+			return nil, err
+		}
+		delete(params, "save_best")
+	}
+
+	saveBestMetric := "val_accuracy"
+	if sbm, err := params.Get(saveBestMetricPath); err == nil {
+		if saveBestMetric, err = data.AsString(sbm); err != nil {
+			return nil, err
+		}
+		delete(params, "save_best_metric")
+	}
+
+	saveBestMode := saveBestModeMax
+	if sbm, err := params.Get(saveBestModePath); err == nil {
+		if saveBestMode, err = data.AsString(sbm); err != nil {
+			return nil, err
+		}
+		delete(params, "save_best_mode")
+	}
+
+	saveModelPath := ""
+	if smp, err := params.Get(saveModelPathPath); err == nil {
+		if saveModelPath, err = data.AsString(smp); err != nil {
+			return nil, err
+		}
+		delete(params, "save_model_path")
+	}
+	if err := validateSaveBest(saveBest, saveBestMode, saveModelPath); err != nil {
+		return nil, err
+	}
+
+	dedupKey := ""
+	if dk, err := params.Get(dedupKeyPath); err == nil {
+		if dedupKey, err = data.AsString(dk); err != nil {
+			return nil, err
+		}
+		delete(params, "dedup_key")
+	}
+
+	dedupWindow := 1000
+	if dw, err := params.Get(dedupWindowPath); err == nil {
+		var dedupWindow64 int64
+		if dedupWindow64, err = data.AsInt(dw); err != nil {
+			return nil, err
+		}
+		if dedupWindow64 <= 0 {
+			return nil, fmt.Errorf("dedup_window must be greater than 0")
+		}
+		dedupWindow = int(dedupWindow64)
+		delete(params, "dedup_window")
+	}
+
+	onInvalidMetrics := invalidMetricsWarn
+	if oim, err := params.Get(onInvalidMetPath); err == nil {
+		if onInvalidMetrics, err = data.AsString(oim); err != nil {
+			return nil, err
+		}
+		if err := validateOnInvalidMetrics(onInvalidMetrics); err != nil {
+			return nil, err
+		}
+		delete(params, "on_invalid_metrics")
+	}
+
+	var outputs map[string]string
+	if o, err := params.Get(outputsPath); err == nil {
+		m, err := data.AsMap(o)
+		if err != nil {
+			return nil, err
+		}
+		if outputs, err = parseOutputs(m); err != nil {
+			return nil, err
+		}
+		delete(params, "outputs")
+	}
+
+	normalizeProba := false
+	if np, err := params.Get(normalizeProbaPath); err == nil {
+		if normalizeProba, err = data.AsBool(np); err != nil {
+			return nil, err
+		}
+		delete(params, "normalize_proba")
+	}
+
+	idField := ""
+	if idf, err := params.Get(idFieldPath); err == nil {
+		if idField, err = data.AsString(idf); err != nil {
+			return nil, err
+		}
+		delete(params, "id_field")
+	}
+
+	idRequired := false
+	if idr, err := params.Get(idRequiredPath); err == nil {
+		if idRequired, err = data.AsBool(idr); err != nil {
+			return nil, err
+		}
+		delete(params, "id_required")
+	}
+
+	var maxFlushInterval time.Duration
+	if mfi, err := params.Get(maxFlushIntPath); err == nil {
+		sec, err := data.ToFloat(mfi)
+		if err != nil {
+			return nil, err
+		}
+		if sec < 0 {
+			return nil, fmt.Errorf("max_flush_interval must not be negative")
+		}
+		maxFlushInterval = time.Duration(sec * float64(time.Second))
+		delete(params, "max_flush_interval")
+	}
+
+	var fitTimeout time.Duration
+	if ft, err := params.Get(fitTimeoutPath); err == nil {
+		sec, err := data.ToFloat(ft)
+		if err != nil {
+			return nil, err
+		}
+		if sec < 0 {
+			return nil, fmt.Errorf("fit_timeout must not be negative")
+		}
+		fitTimeout = time.Duration(sec * float64(time.Second))
+		delete(params, "fit_timeout")
+	}
+
+	var predictTimeout time.Duration
+	if pt, err := params.Get(predictTimeoutPath); err == nil {
+		sec, err := data.ToFloat(pt)
+		if err != nil {
+			return nil, err
+		}
+		if sec < 0 {
+			return nil, fmt.Errorf("predict_timeout must not be negative")
+		}
+		predictTimeout = time.Duration(sec * float64(time.Second))
+		delete(params, "predict_timeout")
+	}
+
+	retryMaxAttempts := 1
+	if rm, err := params.Get(retryMaxPath); err == nil {
+		var retryMax64 int64
+		if retryMax64, err = data.AsInt(rm); err != nil {
+			return nil, err
+		}
+		if retryMax64 < 1 {
+			return nil, fmt.Errorf("retry_max_attempts must be greater than 0")
+		}
+		retryMaxAttempts = int(retryMax64)
+		delete(params, "retry_max_attempts")
+	}
+
+	retryBackoff := 100 * time.Millisecond
+	if rb, err := params.Get(retryBackoffPath); err == nil {
+		sec, err := data.ToFloat(rb)
+		if err != nil {
+			return nil, err
+		}
+		if sec < 0 {
+			return nil, fmt.Errorf("retry_backoff must not be negative")
+		}
+		retryBackoff = time.Duration(sec * float64(time.Second))
+		delete(params, "retry_backoff")
+	}
+
+	var retryErrors []string
+	if re, err := params.Get(retryErrorsPath); err == nil {
+		arr, err := data.AsArray(re)
+		if err != nil {
+			return nil, err
+		}
+		retryErrors = make([]string, len(arr))
+		for i, v := range arr {
+			if retryErrors[i], err = data.AsString(v); err != nil {
+				return nil, err
+			}
+		}
+		delete(params, "retry_errors")
+	}
+
+	partialFit := false
+	if pf, err := params.Get(partialFitPath); err == nil {
+		if partialFit, err = data.AsBool(pf); err != nil {
+			return nil, err
+		}
+		delete(params, "partial_fit")
+	}
+
+	flushOnTerminate := false
+	if fot, err := params.Get(flushOnTermPath); err == nil {
+		if flushOnTerminate, err = data.AsBool(fot); err != nil {
+			return nil, err
+		}
+		delete(params, "flush_on_terminate")
+	}
+
+	fitMethod := "fit"
+	if fm, err := params.Get(fitMethodPath); err == nil {
+		if fitMethod, err = data.AsString(fm); err != nil {
+			return nil, err
+		}
+		if fitMethod == "" {
+			return nil, fmt.Errorf("fit_method must not be empty")
+		}
+		delete(params, "fit_method")
+	}
+
+	predictMethod := "predict"
+	if pm, err := params.Get(predictMethodPath); err == nil {
+		if predictMethod, err = data.AsString(pm); err != nil {
+			return nil, err
+		}
+		if predictMethod == "" {
+			return nil, fmt.Errorf("predict_method must not be empty")
+		}
+		delete(params, "predict_method")
+	}
+
+	predictBatchMethod := "predict_batch"
+	if pm, err := params.Get(predictBatchPath); err == nil {
+		if predictBatchMethod, err = data.AsString(pm); err != nil {
+			return nil, err
+		}
+		if predictBatchMethod == "" {
+			return nil, fmt.Errorf("predict_batch_method must not be empty")
+		}
+		delete(params, "predict_batch_method")
+	}
+
+	asyncFit := doubleBuffer
+	if af, err := params.Get(asyncFitPath); err == nil {
+		if asyncFit, err = data.AsBool(af); err != nil {
+			return nil, err
+		}
+		if doubleBuffer && !asyncFit {
+			return nil, fmt.Errorf("async_fit cannot be false when double_buffer is true")
+		}
+		delete(params, "async_fit")
+	}
+
+	fitQueueSize := 4
+	if fqs, err := params.Get(fitQueueSizePath); err == nil {
+		var fitQueueSize64 int64
+		if fitQueueSize64, err = data.AsInt(fqs); err != nil {
+			return nil, err
+		}
+		if fitQueueSize64 <= 0 {
+			return nil, fmt.Errorf("fit_queue_size must be greater than 0")
+		}
+		fitQueueSize = int(fitQueueSize64)
+		delete(params, "fit_queue_size")
+	}
+
+	overflowPolicy := overflowBlock
+	if op, err := params.Get(overflowPolicyPath); err == nil {
+		if overflowPolicy, err = data.AsString(op); err != nil {
+			return nil, err
+		}
+		if err := validateOverflowPolicy(overflowPolicy); err != nil {
+			return nil, err
+		}
+		delete(params, "overflow_policy")
+	}
+
+	var maxBatchBytes int64
+	if mbb, err := params.Get(maxBatchBytesPath); err == nil {
+		if maxBatchBytes, err = data.AsInt(mbb); err != nil {
+			return nil, err
+		}
+		if maxBatchBytes < 0 {
+			return nil, fmt.Errorf("max_batch_bytes must not be negative")
+		}
+		delete(params, "max_batch_bytes")
+	}
+
+	return &MLParams{
+		BatchSize:             batchSize,
+		SaveMaxBytes:          saveMaxBytes,
+		FeatureOrder:          featureOrder,
+		PredictionHistorySize: predHistSize,
+		FeatureClipMin:        clipMin,
+		FeatureClipMax:        clipMax,
+		RejectNaNFeatures:     rejectNaN,
+		PausePolicy:           pausePolicy,
+		MaxBucketSize:         maxBucketSize,
+		ReprMaxLength:         reprMaxLength,
+		PredictFormat:         predictFormat,
+		EnforceFeatureDim:     enforceFeatDim,
+		NullHandling:          nullHandling,
+		DriftMonitor:          driftMonitor,
+		DriftWindow:           driftWindow,
+		Feedback:              feedback,
+		FeedbackKey:           feedbackKey,
+		ONNXExportMethod:      onnxExportMethod,
+		DeferFit:              !fitOnWrite,
+		TraceField:            traceField,
+		CheckpointPath:        checkpointPath,
+		CheckpointInterval:    checkpointInterval,
+		CheckpointKeep:        checkpointKeep,
+		MaxFlushInterval:      maxFlushInterval,
+		FlushOnTerminate:      flushOnTerminate,
+		FitMethod:             fitMethod,
+		PredictMethod:         predictMethod,
+		PredictBatchMethod:    predictBatchMethod,
+		AsyncFit:              asyncFit,
+		FitQueueSize:          fitQueueSize,
+		OverflowPolicy:        overflowPolicy,
+		MaxBatchBytes:         maxBatchBytes,
+		SparseThreshold:       sparseThreshold,
+		LazyInit:              lazyInit,
+		MetricsPositions:      metricsPositions,
+		Metrics:               metrics,
+		FitEventBuffer:        fitEventBuffer,
+		EarlyStoppingPatience: esPatience,
+		EarlyStoppingMinDelta: esMinDelta,
+		EarlyStoppingMetric:   esMetric,
+		DoubleBuffer:          doubleBuffer,
+		WarmupSample:          warmupSample,
+		FitTimeout:            fitTimeout,
+		PredictTimeout:        predictTimeout,
+		RetryMaxAttempts:      retryMaxAttempts,
+		RetryBackoff:          retryBackoff,
+		RetryErrors:           retryErrors,
+		PartialFit:            partialFit,
+		ReplayBuffer:          replayBuffer,
+		ReplayDumpPath:        replayDump,
+		PredictAsScores:       predictAsScores,
+		ClassNames:            classNames,
+		NumClasses:            numClasses,
+		SaveBest:              saveBest,
+		SaveBestMetric:        saveBestMetric,
+		SaveBestMode:          saveBestMode,
+		SaveModelPath:         saveModelPath,
+		DedupKey:              dedupKey,
+		DedupWindow:           dedupWindow,
+		OnInvalidMetrics:      onInvalidMetrics,
+		Outputs:               outputs,
+		NormalizeProba:        normalizeProba,
+		IDField:               idField,
+		IDRequired:            idRequired,
+	}, nil
 }
 
 // LoadState is same as CREATE STATE.
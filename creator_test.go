@@ -20,6 +20,20 @@ func TestCreatePyMLState(t *testing.T) {
 			})
 		})
 
+		Convey("When create a pymlstate with a class the module doesn't have", func() {
+			params := data.Map{
+				"module_path": data.String("./"),
+				"module_name": data.String("_test_pymlstate"),
+				"class_name":  data.String("TestClas"),
+			}
+			_, err := sc.CreateState(ctx, params)
+			Convey("Then the error should list classes of the module", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "TestClass")
+				So(err.Error(), ShouldContainSubstring, "MinimalClass")
+			})
+		})
+
 		Convey("When create a pymlstate with base parameters", func() {
 			params := data.Map{
 				"module_path": data.String("./"),
@@ -104,3 +118,72 @@ func TestLoadPyMLState(t *testing.T) {
 		})
 	})
 }
+
+func TestValidateWorkerID(t *testing.T) {
+	Convey("Given parameters having worker_id", t, func() {
+		Convey("When worker_id is a string or an integer", func() {
+			Convey("Then it should be valid", func() {
+				So(validateWorkerID(data.Map{"worker_id": data.String("w1")}), ShouldBeNil)
+				So(validateWorkerID(data.Map{"worker_id": data.Int(1)}), ShouldBeNil)
+				So(validateWorkerID(data.Map{}), ShouldBeNil)
+			})
+		})
+
+		Convey("When worker_id is a float", func() {
+			Convey("Then it should be invalid", func() {
+				So(validateWorkerID(data.Map{"worker_id": data.Float(1.5)}), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestConstructorArgs(t *testing.T) {
+	Convey("Given parameters having constructor_args", t, func() {
+		Convey("When merge them", func() {
+			params := data.Map{
+				"foo":              data.Int(1),
+				"constructor_args": data.Map{"lr": data.Float(0.01)},
+			}
+			So(mergeConstructorArgs(params), ShouldBeNil)
+			Convey("Then they should become parameters", func() {
+				So(params, ShouldResemble, data.Map{
+					"foo": data.Int(1),
+					"lr":  data.Float(0.01),
+				})
+			})
+		})
+
+		Convey("When a key is also given as a parameter", func() {
+			params := data.Map{
+				"lr":               data.Float(0.1),
+				"constructor_args": data.Map{"lr": data.Float(0.01)},
+			}
+			Convey("Then it should fail", func() {
+				So(mergeConstructorArgs(params), ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a StateCreator", t, func() {
+		ctx := core.NewContext(&core.ContextConfig{})
+		c := &StateCreator{}
+		Convey("When create a state with constructor_args", func() {
+			s, err := c.CreateState(ctx, data.Map{
+				"module_path":      data.String("./"),
+				"module_name":      data.String("_test_pymlstate"),
+				"class_name":       data.String("KwargsClass"),
+				"constructor_args": data.Map{"lr": data.Float(0.01)},
+			})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+
+			Convey("Then they should be passed to the constructor", func() {
+				v, err := s.(*State).Predict(ctx, data.Int(1))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Float(0.01))
+			})
+		})
+	})
+}
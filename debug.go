@@ -0,0 +1,56 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"unicode/utf8"
+)
+
+// Repr returns `repr()` of the Python instance. It's truncated to at most
+// repr_max_length bytes on a UTF-8 character boundary. It takes the write lock so that the instance isn't
+// being trained while it's inspected.
+func (s *State) Repr(ctx *core.Context) (string, error) {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.checkTermination(); err != nil {
+		return "", err
+	}
+
+	v, err := s.call("__repr__")
+	if err != nil {
+		return "", err
+	}
+	r, err := data.AsString(v)
+	if err != nil {
+		return "", err
+	}
+	return truncateString(r, s.params.ReprMaxLength), nil
+}
+
+// truncateString truncates str to at most max bytes without splitting a
+// UTF-8 character and appends "..." when it's truncated. max <= 0 means no
+// limit.
+func truncateString(str string, max int) string {
+	if max <= 0 || len(str) <= max {
+		return str
+	}
+	i := max
+	for i > 0 && !utf8.RuneStart(str[i]) {
+		i--
+	}
+	return str[:i] + "..."
+}
+
+// Repr returns `repr()` of the Python instance of the state for debugging.
+func Repr(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := s.Repr(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return data.String(r), nil
+}
@@ -0,0 +1,70 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateRepr(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate for repr test", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When get repr of the instance", func() {
+			r, err := s.Repr(ctx)
+			Convey("Then it should be the Python repr", func() {
+				So(err, ShouldBeNil)
+				So(r, ShouldEqual, "TestClass(cnt=0)")
+			})
+		})
+
+		Convey("When get repr with a small max length", func() {
+			s.params.ReprMaxLength = 9
+			r, err := s.Repr(ctx)
+			Convey("Then it should be truncated", func() {
+				So(err, ShouldBeNil)
+				So(r, ShouldEqual, "TestClass...")
+			})
+		})
+	})
+}
+
+func TestTruncateString(t *testing.T) {
+	Convey("Given a string having multi-byte characters", t, func() {
+		str := "aあい"
+
+		Convey("When truncate it in the middle of a character", func() {
+			r := truncateString(str, 3)
+			Convey("Then it should be truncated before the character", func() {
+				So(r, ShouldEqual, "a...")
+			})
+		})
+
+		Convey("When truncate it on a character boundary", func() {
+			r := truncateString(str, 4)
+			Convey("Then the character should be kept", func() {
+				So(r, ShouldEqual, "aあ...")
+			})
+		})
+
+		Convey("When the limit is longer than the string", func() {
+			r := truncateString(str, 100)
+			Convey("Then it shouldn't be truncated", func() {
+				So(r, ShouldEqual, str)
+			})
+		})
+	})
+}
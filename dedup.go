@@ -0,0 +1,62 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// recentKeys remembers the last keys of tuples written to a state to detect
+// duplicates. It's only used by Write, which holds the write lock, so it
+// doesn't have its own lock.
+type recentKeys struct {
+	keys []string
+	next int
+	full bool
+	seen map[string]int
+}
+
+func newRecentKeys(size int) *recentKeys {
+	return &recentKeys{
+		keys: make([]string, size),
+		seen: make(map[string]int, size),
+	}
+}
+
+// add returns false when key is one of the recent keys. Otherwise, it adds key
+// and forgets the oldest key when the window is full.
+func (r *recentKeys) add(key string) bool {
+	if r.seen[key] > 0 {
+		return false
+	}
+	if r.full {
+		old := r.keys[r.next]
+		if r.seen[old]--; r.seen[old] == 0 {
+			delete(r.seen, old)
+		}
+	}
+	r.keys[r.next] = key
+	r.seen[key]++
+	r.next++
+	if r.next == len(r.keys) {
+		r.next = 0
+		r.full = true
+	}
+	return true
+}
+
+// isDuplicate returns true when the tuple t has the same dedup key as one of
+// the recent tuples. Tuples not having the key are never duplicates. The
+// caller must hold the write lock.
+func (s *State) isDuplicate(t data.Map) bool {
+	if s.dedup == nil {
+		return false
+	}
+	v, err := t.Get(s.dedupPath)
+	if err != nil {
+		return false
+	}
+	key, err := data.ToString(v)
+	if err != nil {
+		return false
+	}
+	return !s.dedup.add(key)
+}
@@ -0,0 +1,68 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestRecentKeys(t *testing.T) {
+	Convey("Given recent keys having a window of 2", t, func() {
+		r := newRecentKeys(2)
+		So(r.add("a"), ShouldBeTrue)
+		So(r.add("b"), ShouldBeTrue)
+
+		Convey("When add a key in the window", func() {
+			Convey("Then it should be a duplicate", func() {
+				So(r.add("a"), ShouldBeFalse)
+			})
+		})
+
+		Convey("When add a key which went out of the window", func() {
+			So(r.add("c"), ShouldBeTrue)
+			Convey("Then it should not be a duplicate", func() {
+				So(r.add("a"), ShouldBeTrue)
+				So(r.add("c"), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestPyMLStateDedup(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with dedup_key", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:   1,
+			DedupKey:    "id",
+			DedupWindow: 10,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When write duplicated tuples", func() {
+			for _, id := range []int{1, 2, 1, 3, 2} {
+				tu := &core.Tuple{Data: data.Map{
+					"id":   data.Int(id),
+					"data": data.Int(0),
+				}}
+				So(s.Write(ctx, tu), ShouldBeNil)
+			}
+			Convey("Then duplicates should be skipped", func() {
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, 3)
+				So(s.Status()["skipped_dup_tuples"], ShouldEqual, data.Int(2))
+			})
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package pymlstate
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+// weightSync serializes copies of weights from the training instance to the
+// serving instance so that weights of an older fit never overwrite newer
+// ones. It has its own lock because fit is called while holding the read lock
+// of State.
+type weightSync struct {
+	m        sync.Mutex
+	syncs    int64
+	failures int64
+}
+
+// copyWeights copies weights of the training instance to the serving instance
+// by `get_weights` and `set_weights` methods.
+func copyWeights(training, serving *pystate.Base) error {
+	w, err := training.Call("get_weights")
+	if err != nil {
+		return fmt.Errorf("cannot get weights of the training instance: %v", err)
+	}
+	if _, err := serving.Call("set_weights", w); err != nil {
+		return fmt.Errorf("cannot set weights to the serving instance: %v", err)
+	}
+	return nil
+}
+
+// newServing creates the serving instance having the same weights as the
+// training instance b.
+func newServing(b *pystate.Base, baseParams *pystate.BaseParams, params data.Map) (
+	*pystate.Base, error) {
+	serving, err := newBase(baseParams, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyWeights(b, serving); err != nil {
+		serving.Terminate(nil)
+		return nil, err
+	}
+	return serving, nil
+}
+
+// loadServing loads the serving instance from serialized data of the training
+// instance.
+func (s *State) loadServing(ctx *core.Context, d []byte, params data.Map) error {
+	if s.serving == nil {
+		b, err := pystate.LoadBase(ctx, bytes.NewReader(d), params)
+		if err != nil {
+			return err
+		}
+		s.serving = b
+		return nil
+	}
+	return s.serving.Load(ctx, bytes.NewReader(d), params)
+}
+
+// syncServing copies weights of the training instance to the serving
+// instance after a fit. A failure is logged because the model has already
+// been trained, and the serving instance keeps the previous weights.
+func (s *State) syncServing(ctx *core.Context) {
+	ws := &s.weightSync
+	ws.m.Lock()
+	defer ws.m.Unlock()
+	b, err := s.py()
+	if err == nil {
+		s.modelM.RLock()
+		s.servingM.Lock()
+		err = copyWeights(b, s.serving)
+		s.servingM.Unlock()
+		s.modelM.RUnlock()
+	}
+	if err != nil {
+		ws.failures++
+		ctx.ErrLog(err).Error("pymlstate cannot copy weights to the serving instance")
+		return
+	}
+	ws.syncs++
+}
+
+func (ws *weightSync) status() data.Map {
+	ws.m.Lock()
+	defer ws.m.Unlock()
+	return data.Map{
+		"weight_syncs":        data.Int(ws.syncs),
+		"failed_weight_syncs": data.Int(ws.failures),
+	}
+}
+
+// callServing calls the read-only method of the serving instance when
+// double_buffer is true. Otherwise, it calls the method of the Python
+// instance by callReadOnly.
+func (s *State) callServing(name string, args ...data.Value) (data.Value, error) {
+	if s.serving == nil {
+		return s.callReadOnly(name, args...)
+	}
+	if err := s.checkTermination(); err != nil {
+		return nil, err
+	}
+	if err := s.timeouts.checkOutstanding(); err != nil {
+		return nil, err
+	}
+	s.servingM.RLock()
+	defer s.servingM.RUnlock()
+	return s.serving.Call(name, args...)
+}
@@ -0,0 +1,133 @@
+package pymlstate
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateDoubleBuffer(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with double_buffer", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "DoubleBufferClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:    1,
+			DoubleBuffer: true,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("Then async_fit should be implied", func() {
+			So(s.params.AsyncFit, ShouldBeTrue)
+		})
+
+		Convey("When write tuples", func() {
+			for i := 1; i <= 2; i++ {
+				So(s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(i)}}), ShouldBeNil)
+			}
+			s.drainFitQueue()
+
+			Convey("Then the model should be trained in the background", func() {
+				So(s.stats.snapshot()["batches"], ShouldEqual, data.Int(2))
+				So(s.Status()["weight_syncs"], ShouldEqual, data.Int(2))
+			})
+		})
+
+		Convey("When fit is called", func() {
+			_, err := s.Fit(ctx, []data.Value{data.Int(1), data.Int(2)})
+			So(err, ShouldBeNil)
+
+			Convey("Then predictions should use the copied weights", func() {
+				res, err := s.Predict(ctx, data.Int(0))
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.Int(2))
+				So(s.Status()["weight_syncs"], ShouldEqual, data.Int(1))
+			})
+
+			Convey("Then predictions should be served by the other instance", func() {
+				w, err := s.serving.Call("get_weights")
+				So(err, ShouldBeNil)
+				So(w, ShouldEqual, data.Int(2))
+				cnt, err := s.serving.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, data.Int(0))
+			})
+
+			Convey("Then read-only inference methods should use the serving instance", func() {
+				_, err := s.base.Call("set_weights", data.Int(10))
+				So(err, ShouldBeNil)
+				proba, err := s.predictProba(ctx, data.Int(0))
+				So(err, ShouldBeNil)
+				So(proba, ShouldResemble, []float64{2, 1})
+				score, err := s.Score(ctx, []data.Value{data.Map{"data": data.Int(0)}})
+				So(err, ShouldBeNil)
+				So(score, ShouldEqual, data.Float(2))
+			})
+
+			Convey("And when save and load the state", func() {
+				buf := bytes.NewBuffer(nil)
+				So(s.Save(ctx, buf, data.Map{}), ShouldBeNil)
+				sc := StateCreator{}
+				s2, err := sc.LoadState(ctx, buf, data.Map{})
+				So(err, ShouldBeNil)
+				Reset(func() {
+					s2.Terminate(ctx)
+				})
+
+				Convey("Then the loaded state should also have the serving instance", func() {
+					ps2, ok := s2.(*State)
+					So(ok, ShouldBeTrue)
+					So(ps2.serving, ShouldNotBeNil)
+					res, err := ps2.Predict(ctx, data.Int(0))
+					So(err, ShouldBeNil)
+					So(res, ShouldEqual, data.Int(2))
+				})
+			})
+		})
+	})
+
+	Convey("Given parameters having double_buffer and async_fit = false", t, func() {
+		params := data.Map{
+			"module_path":   data.String("./"),
+			"module_name":   data.String("_test_pymlstate"),
+			"class_name":    data.String("DoubleBufferClass"),
+			"double_buffer": data.True,
+			"async_fit":     data.False,
+		}
+
+		Convey("When create a state", func() {
+			sc := StateCreator{}
+			_, err := sc.CreateState(ctx, params)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a class without get_weights", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		_, err := New(baseParams, &MLParams{
+			BatchSize:    1,
+			DoubleBuffer: true,
+		}, data.Map{})
+
+		Convey("Then the state with double_buffer shouldn't be created", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sync"
+)
+
+// runningStats computes mean and variance of each dimension of feature
+// vectors incrementally by Welford's algorithm.
+type runningStats struct {
+	n    int64
+	mean []float64
+	m2   []float64
+}
+
+// add adds a feature vector. Vectors having a dimension different from the
+// first one are ignored.
+func (r *runningStats) add(vec []float64) {
+	if r.n == 0 {
+		r.mean = make([]float64, len(vec))
+		r.m2 = make([]float64, len(vec))
+	} else if len(vec) != len(r.mean) {
+		return
+	}
+
+	r.n++
+	for i, x := range vec {
+		d := x - r.mean[i]
+		r.mean[i] += d / float64(r.n)
+		r.m2[i] += d * (x - r.mean[i])
+	}
+}
+
+func (r *runningStats) variance(i int) float64 {
+	if r.n < 2 {
+		return 0
+	}
+	return r.m2[i] / float64(r.n-1)
+}
+
+// driftMonitor compares statistics of features given to predict with ones
+// given to fit. The score is the mean of the standardized mean shift of each
+// dimension, which is computed every time window predictions are observed.
+type driftMonitor struct {
+	m      sync.Mutex
+	window int
+	train  runningStats
+	recent runningStats
+	score  float64
+	scored bool
+}
+
+func newDriftMonitor(window int) *driftMonitor {
+	return &driftMonitor{
+		window: window,
+	}
+}
+
+// observeTraining adds feature vectors of converted training samples, which
+// are "data" fields of labeled samples or samples themselves, to the training
+// statistics.
+func (d *driftMonitor) observeTraining(bucket []data.Value) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	for _, v := range bucket {
+		f, _ := sampleFeatures(v)
+		if f.Type() != data.TypeArray {
+			continue
+		}
+		if vec, err := toFloatVector(f); err == nil {
+			d.train.add(vec)
+		}
+	}
+}
+
+func (d *driftMonitor) observePrediction(v data.Value) {
+	if v.Type() != data.TypeArray {
+		return
+	}
+	vec, err := toFloatVector(v)
+	if err != nil {
+		return
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.recent.add(vec)
+	if d.recent.n < int64(d.window) {
+		return
+	}
+	if d.train.n > 0 && len(d.train.mean) == len(d.recent.mean) {
+		d.score = standardizedMeanShift(&d.train, &d.recent)
+		d.scored = true
+	}
+	d.recent = runningStats{}
+}
+
+// standardizedMeanShift returns the mean of |mean_recent - mean_train| /
+// stddev_train over all dimensions. Dimensions having no variance in training
+// data are compared without standardization.
+func standardizedMeanShift(train, recent *runningStats) float64 {
+	if len(train.mean) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for i := range train.mean {
+		shift := math.Abs(recent.mean[i] - train.mean[i])
+		if sd := math.Sqrt(train.variance(i)); sd > 0 {
+			shift /= sd
+		}
+		sum += shift
+	}
+	return sum / float64(len(train.mean))
+}
+
+func (d *driftMonitor) status() data.Map {
+	d.m.Lock()
+	defer d.m.Unlock()
+	m := data.Map{
+		"drift_training_samples": data.Int(d.train.n),
+		"drift_window_samples":   data.Int(d.recent.n),
+	}
+	if d.scored {
+		m["drift_score"] = data.Float(d.score)
+	} else {
+		m["drift_score"] = data.Null{}
+	}
+	return m
+}
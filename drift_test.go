@@ -0,0 +1,84 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestDriftMonitor(t *testing.T) {
+	Convey("Given a drift monitor trained with data", t, func() {
+		d := newDriftMonitor(2)
+		d.observeTraining([]data.Value{
+			data.Array{data.Float(0), data.Float(10)},
+			data.Array{data.Float(2), data.Float(10)},
+		})
+
+		Convey("When the window isn't filled", func() {
+			d.observePrediction(data.Array{data.Float(1), data.Float(10)})
+			Convey("Then the score should be null", func() {
+				st := d.status()
+				So(st["drift_score"], ShouldResemble, data.Null{})
+				So(st["drift_window_samples"], ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When predictions have the same distribution", func() {
+			d.observePrediction(data.Array{data.Float(0), data.Float(10)})
+			d.observePrediction(data.Array{data.Float(2), data.Float(10)})
+			Convey("Then the score should be 0", func() {
+				So(d.status()["drift_score"], ShouldEqual, data.Float(0))
+			})
+		})
+
+		Convey("When predictions are shifted", func() {
+			// The stddev of the first dimension is sqrt(2).
+			d.observePrediction(data.Array{data.Float(3), data.Float(12)})
+			d.observePrediction(data.Array{data.Float(5), data.Float(12)})
+			Convey("Then the score should be the mean of standardized shifts", func() {
+				s, err := data.AsFloat(d.status()["drift_score"])
+				So(err, ShouldBeNil)
+				So(s, ShouldAlmostEqual, (3/1.4142135623730951+2)/2, 1e-9)
+			})
+		})
+	})
+}
+
+func TestPyMLStateDriftMonitor(t *testing.T) {
+	ctx := core.NewContext(&core.ContextConfig{})
+	Convey("Given a pymlstate with drift_monitor", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "RecordClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:    1,
+			DriftMonitor: true,
+			DriftWindow:  1,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When write labeled samples and predict", func() {
+			So(s.Write(ctx, &core.Tuple{Data: data.Map{
+				"data": data.Array{
+					data.Map{"data": data.Array{data.Float(0), data.Float(10)}, "label": data.Int(0)},
+					data.Map{"data": data.Array{data.Float(2), data.Float(10)}, "label": data.Int(1)},
+				},
+			}}), ShouldBeNil)
+			_, err := s.Predict(ctx, data.Array{data.Float(1), data.Float(10)})
+			So(err, ShouldBeNil)
+
+			Convey("Then features of the samples should be used as training data", func() {
+				st := s.Status()
+				So(st["drift_training_samples"], ShouldEqual, data.Int(2))
+				So(st["drift_score"], ShouldEqual, data.Float(0))
+			})
+		})
+	})
+}
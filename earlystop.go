@@ -0,0 +1,117 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+// earlyStopping stops training via Write when the metric monitored by
+// early_stopping_metric hasn't improved by early_stopping_min_delta for
+// early_stopping_patience batches. It has its own lock because fit is called
+// while holding the read lock of State.
+type earlyStopping struct {
+	m         sync.Mutex
+	patience  int
+	minDelta  float64
+	found     bool
+	best      float64
+	wait      int
+	stopped   bool
+	stoppedAt int64
+}
+
+func newEarlyStopping(patience int, minDelta float64) *earlyStopping {
+	return &earlyStopping{
+		patience: patience,
+		minDelta: minDelta,
+	}
+}
+
+// observe records the metric of the step-th batch. It returns true when
+// training is stopped by this batch.
+func (e *earlyStopping) observe(v float64, step int64) bool {
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.stopped {
+		return false
+	}
+	if !e.found || v < e.best-e.minDelta {
+		e.found = true
+		e.best = v
+		e.wait = 0
+		return false
+	}
+	e.wait++
+	if e.wait < e.patience {
+		return false
+	}
+	e.stopped = true
+	e.stoppedAt = step
+	return true
+}
+
+func (e *earlyStopping) isStopped() bool {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.stopped
+}
+
+// reset restarts monitoring from scratch.
+func (e *earlyStopping) reset() {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.found = false
+	e.wait = 0
+	e.stopped = false
+	e.stoppedAt = 0
+}
+
+func (e *earlyStopping) status() data.Map {
+	e.m.Lock()
+	defer e.m.Unlock()
+	m := data.Map{
+		"early_stopped":         data.Bool(e.stopped),
+		"early_stopping_wait":   data.Int(e.wait),
+		"early_stopping_best":   data.Null{},
+		"early_stopped_at_step": data.Null{},
+	}
+	if e.found {
+		m["early_stopping_best"] = data.Float(e.best)
+	}
+	if e.stopped {
+		m["early_stopped_at_step"] = data.Int(e.stoppedAt)
+	}
+	return m
+}
+
+// observeEarlyStopping passes the monitored metric in metrics to the early
+// stopping controller, and returns true when it stopped training. Results not
+// having the metric are ignored.
+func (s *State) observeEarlyStopping(ctx *core.Context, metrics data.Value, step int64) bool {
+	m, err := data.AsMap(metrics)
+	if err != nil {
+		return false
+	}
+	name := s.params.EarlyStoppingMetric
+	if name == "" {
+		name = "loss"
+	}
+	v, ok := m[name]
+	if !ok {
+		return false
+	}
+	f, err := data.ToFloat(v)
+	if err != nil {
+		ctx.ErrLog(err).WithField("metric", name).
+			Warn("pymlstate cannot monitor a non-numeric metric for early stopping")
+		return false
+	}
+	if !s.early.observe(f, step) {
+		return false
+	}
+	ctx.Log().WithField("metric", name).
+		WithField("step", step).
+		Info("pymlstate stopped training because the metric hasn't improved")
+	return true
+}
@@ -0,0 +1,91 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestEarlyStopping(t *testing.T) {
+	Convey("Given an early stopping controller", t, func() {
+		e := newEarlyStopping(2, 0.1)
+
+		Convey("When the metric keeps improving by more than min_delta", func() {
+			stopped := false
+			for i, v := range []float64{1.0, 0.8, 0.6, 0.4} {
+				stopped = stopped || e.observe(v, int64(i+1))
+			}
+			Convey("Then it shouldn't stop", func() {
+				So(stopped, ShouldBeFalse)
+				So(e.isStopped(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the metric improves by less than min_delta", func() {
+			So(e.observe(1.0, 1), ShouldBeFalse)
+			So(e.observe(0.95, 2), ShouldBeFalse)
+			So(e.observe(0.92, 3), ShouldBeTrue)
+			Convey("Then it should stop after patience batches", func() {
+				So(e.isStopped(), ShouldBeTrue)
+				st := e.status()
+				So(st["early_stopped_at_step"], ShouldEqual, data.Int(3))
+				So(st["early_stopping_best"], ShouldEqual, data.Float(1.0))
+			})
+		})
+	})
+}
+
+func TestPyMLStateEarlyStopping(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with early_stopping_patience whose loss doesn't improve", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "MetricsClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:             1,
+			EarlyStoppingPatience: 2,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+		write := func() {
+			So(s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(1)}}), ShouldBeNil)
+		}
+		fitCount := func() data.Value {
+			cnt, err := s.base.Call("confirm_to_call_fit")
+			So(err, ShouldBeNil)
+			return cnt
+		}
+
+		Convey("When write tuples after the patience", func() {
+			for i := 0; i < 4; i++ {
+				write()
+			}
+
+			Convey("Then training should be stopped", func() {
+				So(fitCount(), ShouldEqual, data.Int(3))
+				st := s.Status()
+				So(st["early_stopped"], ShouldEqual, data.Bool(true))
+				So(st["early_stopped_tuples"], ShouldEqual, data.Int(1))
+			})
+
+			Convey("Then predict should still work", func() {
+				_, err := s.Predict(ctx, data.Int(1))
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Then Resume should restart training", func() {
+				So(s.Resume(ctx), ShouldBeNil)
+				write()
+				So(fitCount(), ShouldEqual, data.Int(4))
+				So(s.Status()["early_stopped"], ShouldEqual, data.Bool(false))
+			})
+		})
+	})
+}
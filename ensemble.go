@@ -0,0 +1,89 @@
+package pymlstate
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// ensemblePredict applies all states to dt and returns their outputs as
+// numeric vectors. All outputs must have the same length.
+func ensemblePredict(ctx *core.Context, stateNames []data.Value, dt data.Value) (
+	[][]float64, error) {
+	if len(stateNames) == 0 {
+		return nil, errors.New("at least one state name is required")
+	}
+
+	vecs := make([][]float64, len(stateNames))
+	for i, n := range stateNames {
+		name, err := data.AsString(n)
+		if err != nil {
+			return nil, err
+		}
+		m, err := lookupModel(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		res, err := m.Predict(ctx, dt)
+		if err != nil {
+			return nil, err
+		}
+		vec, err := toFloatVector(res)
+		if err != nil {
+			return nil, fmt.Errorf("output of state '%v' isn't numeric: %v", name, err)
+		}
+		if i > 0 && len(vec) != len(vecs[0]) {
+			return nil, fmt.Errorf("output of state '%v' has %v elements but %v is expected",
+				name, len(vec), len(vecs[0]))
+		}
+		vecs[i] = vec
+	}
+	return vecs, nil
+}
+
+// EnsemblePredict applies all states to the given data and returns the
+// element-wise average of their outputs as a `data.Array`. Each output must
+// be a number or an array of numbers, and all of them must have the same
+// length.
+func EnsemblePredict(ctx *core.Context, stateNames []data.Value, dt data.Value) (
+	data.Value, error) {
+	vecs, err := ensemblePredict(ctx, stateNames, dt)
+	if err != nil {
+		return nil, err
+	}
+
+	avg := make([]float64, len(vecs[0]))
+	for _, vec := range vecs {
+		for i, f := range vec {
+			avg[i] += f
+		}
+	}
+	for i := range avg {
+		avg[i] /= float64(len(vecs))
+	}
+	return fromFloatVector(avg), nil
+}
+
+// EnsembleVote applies all states to the given data and returns the class
+// index voted by the largest number of states. Each state votes for the index
+// of the largest element of its output. Ties are broken by the lowest index.
+func EnsembleVote(ctx *core.Context, stateNames []data.Value, dt data.Value) (
+	data.Value, error) {
+	vecs, err := ensemblePredict(ctx, stateNames, dt)
+	if err != nil {
+		return nil, err
+	}
+
+	votes := make([]float64, len(vecs[0]))
+	for _, vec := range vecs {
+		if i := argmax(vec); i >= 0 {
+			votes[i]++
+		}
+	}
+	c := argmax(votes)
+	if c < 0 {
+		return data.Null{}, nil
+	}
+	return data.Int(c), nil
+}
@@ -0,0 +1,89 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestEnsemble(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given pymlstates returning fixed vectors", t, func() {
+		newState := func(name string, output data.Array) data.Value {
+			baseParams := &pystate.BaseParams{
+				ModulePath: "./",
+				ModuleName: "_test_pymlstate",
+				ClassName:  "VectorClass",
+			}
+			s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{
+				"output": output,
+			})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add(name, "pymlstate", s), ShouldBeNil)
+			Reset(func() {
+				ctx.SharedStates.Remove(name)
+				s.Terminate(ctx)
+			})
+			return data.String(name)
+		}
+		a := newState("ensemble_test_a", data.Array{data.Float(0.2), data.Float(0.8)})
+		b := newState("ensemble_test_b", data.Array{data.Float(0.6), data.Float(0.4)})
+		c := newState("ensemble_test_c", data.Array{data.Float(0.0), data.Float(1.0)})
+
+		Convey("When predict with EnsemblePredict", func() {
+			res, err := EnsemblePredict(ctx, []data.Value{a, b}, data.Int(1))
+
+			Convey("Then outputs should be averaged element-wise", func() {
+				So(err, ShouldBeNil)
+				avg, err := toFloatVector(res)
+				So(err, ShouldBeNil)
+				So(len(avg), ShouldEqual, 2)
+				So(avg[0], ShouldAlmostEqual, 0.4, 1e-9)
+				So(avg[1], ShouldAlmostEqual, 0.6, 1e-9)
+			})
+		})
+
+		Convey("When predict with EnsembleVote", func() {
+			res, err := EnsembleVote(ctx, []data.Value{a, b, c}, data.Int(1))
+
+			Convey("Then the class voted by the majority should be returned", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When votes are tied", func() {
+			res, err := EnsembleVote(ctx, []data.Value{c, b}, data.Int(1))
+
+			Convey("Then the lowest class index should be returned", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.Int(0))
+			})
+		})
+
+		Convey("When an output has a different length", func() {
+			d := newState("ensemble_test_d", data.Array{data.Float(0.1), data.Float(0.2), data.Float(0.7)})
+
+			Convey("Then EnsemblePredict should fail", func() {
+				_, err := EnsemblePredict(ctx, []data.Value{a, d}, data.Int(1))
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then EnsembleVote should fail", func() {
+				_, err := EnsembleVote(ctx, []data.Value{a, d}, data.Int(1))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When no state is given", func() {
+			_, err := EnsemblePredict(ctx, nil, data.Int(1))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
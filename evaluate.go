@@ -0,0 +1,80 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// Evaluate passes labeled samples to `evaluate` method of the model and
+// returns its result, e.g. a loss, an accuracy, and confusion counts, without
+// training the model. Samples have the same format as tuples given to fit and
+// are converted in the same way. When metrics_positions is given, an array
+// returned by the method is keyed by the names. The result isn't recorded as
+// fit metrics.
+func (s *State) Evaluate(ctx *core.Context, samples []data.Value) (data.Value, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("samples must not be empty")
+	}
+	_, arg, err := s.convertSamples(samples)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.callOptionalServing("evaluation", "evaluate", arg)
+	if err != nil {
+		return nil, err
+	}
+	return namedMetrics(s.params.MetricsPositions, res), nil
+}
+
+// Score passes samples to `score` method of the model and returns its result
+// as a float, e.g. the mean accuracy of scikit-learn's classifiers. Samples
+// have the same format as tuples given to fit and are converted in the same
+// way. The model isn't trained.
+func (s *State) Score(ctx *core.Context, samples []data.Value) (data.Value, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("samples must not be empty")
+	}
+	_, arg, err := s.convertSamples(samples)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.callOptionalServing("scoring", "score", arg)
+	if err != nil {
+		return nil, err
+	}
+	score, err := data.ToFloat(res)
+	if err != nil {
+		return nil, fmt.Errorf("score must return a number: %v", err)
+	}
+	return data.Float(score), nil
+}
+
+// Evaluate evaluates the model of the state with a batch of labeled samples
+// held out from training, so that validation can be done in a stream. The
+// Python class must define `evaluate` method. See State.Evaluate for details.
+func Evaluate(ctx *core.Context, stateName string, samples []data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Evaluate(ctx, samples)
+}
+
+// Score returns a single aggregate score of the model of the state over an
+// array of samples, e.g. ones in a sliding window, so that the quality of the
+// model can be monitored in BQL. The Python class must define `score` method.
+// See State.Score for details.
+func Score(ctx *core.Context, stateName string, samples []data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Score(ctx, samples)
+}
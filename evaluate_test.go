@@ -0,0 +1,90 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateEvaluate(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate having evaluate", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When evaluate samples", func() {
+			samples := []data.Value{
+				data.Map{"data": data.Int(1), "label": data.Int(0)},
+				data.Map{"data": data.Int(2), "label": data.Int(1)},
+			}
+			res, err := s.Evaluate(ctx, samples)
+			So(err, ShouldBeNil)
+
+			Convey("Then the result of evaluate should be returned", func() {
+				So(res, ShouldResemble, data.Map{
+					"loss":  data.Float(0.25),
+					"count": data.Int(2),
+				})
+			})
+
+			Convey("Then the model shouldn't be trained", func() {
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, data.Int(0))
+				So(s.Status()["fit_calls"], ShouldEqual, data.Int(0))
+			})
+		})
+
+		Convey("When score samples", func() {
+			res, err := s.Score(ctx, []data.Value{
+				data.Map{"data": data.Int(1), "label": data.Int(0)},
+				data.Map{"data": data.Int(2), "label": data.Int(1)},
+				data.Map{"data": data.Int(3), "label": data.Int(1)},
+				data.Map{"data": data.Int(4), "label": data.Int(0)},
+			})
+
+			Convey("Then the aggregate score should be returned", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.Float(0.25))
+			})
+		})
+
+		Convey("When evaluate no sample", func() {
+			_, err := s.Evaluate(ctx, nil)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a pymlstate not having evaluate", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "PartialClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When evaluate samples", func() {
+			_, err := s.Evaluate(ctx, []data.Value{data.Int(1)})
+			Convey("Then it should fail as not supported", func() {
+				So(isNotSupported(err), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,68 @@
+package mnist
+
+import (
+	"encoding/binary"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"hash/fnv"
+	"sort"
+)
+
+// featureHasher maps a dense feature vector into a fixed size sparse vector
+// by the hashing trick. The bucket and the sign of each feature index are
+// computed once because they only depend on the index and the seed.
+type featureHasher struct {
+	dim   int
+	index []int
+	sign  []float64
+}
+
+func newFeatureHasher(elemSize, dim int, seed int64) *featureHasher {
+	h := &featureHasher{
+		dim:   dim,
+		index: make([]int, elemSize),
+		sign:  make([]float64, elemSize),
+	}
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint64(buf, uint64(seed))
+	for i := 0; i < elemSize; i++ {
+		binary.LittleEndian.PutUint64(buf[8:], uint64(i))
+		f := fnv.New64a()
+		f.Write(buf)
+		v := f.Sum64()
+		h.index[i] = int((v >> 1) % uint64(dim))
+		if v&1 == 0 {
+			h.sign[i] = 1
+		} else {
+			h.sign[i] = -1
+		}
+	}
+	return h
+}
+
+// hash returns indices and values of non-zero elements of the hashed vector.
+// Indices are sorted in ascending order.
+func (h *featureHasher) hash(vec []float32) (data.Array, data.Array) {
+	acc := map[int]float64{}
+	for i, v := range vec {
+		if v == 0 {
+			continue
+		}
+		acc[h.index[i]] += h.sign[i] * float64(v)
+	}
+
+	idx := make([]int, 0, len(acc))
+	for i, v := range acc {
+		if v != 0 {
+			idx = append(idx, i)
+		}
+	}
+	sort.Ints(idx)
+
+	indices := make(data.Array, len(idx))
+	values := make(data.Array, len(idx))
+	for j, i := range idx {
+		indices[j] = data.Int(i)
+		values[j] = data.Float(acc[i])
+	}
+	return indices, values
+}
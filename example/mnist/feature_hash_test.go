@@ -0,0 +1,42 @@
+package mnist
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestFeatureHasher(t *testing.T) {
+	Convey("Given a feature hasher", t, func() {
+		h := newFeatureHasher(6, 4, 1)
+		vec := []float32{0, 0.5, 0, 1, 0.25, 0}
+
+		Convey("When hash a vector", func() {
+			indices, values := h.hash(vec)
+			Convey("Then every index should be less than the dimension", func() {
+				So(len(indices), ShouldEqual, len(values))
+				So(len(indices), ShouldBeLessThanOrEqualTo, 3)
+				for _, i := range indices {
+					n, err := data.AsInt(i)
+					So(err, ShouldBeNil)
+					So(n, ShouldBeBetweenOrEqual, 0, 3)
+				}
+			})
+
+			Convey("Then the result should be deterministic under the same seed", func() {
+				h2 := newFeatureHasher(6, 4, 1)
+				indices2, values2 := h2.hash(vec)
+				So(indices2, ShouldResemble, indices)
+				So(values2, ShouldResemble, values)
+			})
+		})
+
+		Convey("When hash a zero vector", func() {
+			indices, values := h.hash(make([]float32, 6))
+			Convey("Then the result should be empty", func() {
+				So(indices, ShouldBeEmpty)
+				So(values, ShouldBeEmpty)
+			})
+		})
+	})
+}
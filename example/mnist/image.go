@@ -0,0 +1,22 @@
+package mnist
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+)
+
+// encodePNG encodes pixels, which are normalized to [0, 1], as a grayscale
+// PNG image having rows x cols pixels.
+func encodePNG(pixels []float32, rows, cols int) ([]byte, error) {
+	img := image.NewGray(image.Rect(0, 0, cols, rows))
+	for i, p := range pixels {
+		img.Pix[i] = uint8(p*255 + 0.5)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
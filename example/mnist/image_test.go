@@ -0,0 +1,28 @@
+package mnist
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"image/png"
+	"testing"
+)
+
+func TestEncodePNG(t *testing.T) {
+	Convey("Given normalized pixels of a 2x3 image", t, func() {
+		pixels := []float32{0, 0.5, 1, 1, 0.5, 0}
+		Convey("When encode them as PNG", func() {
+			b, err := encodePNG(pixels, 2, 3)
+			So(err, ShouldBeNil)
+			Convey("Then it should be decoded as the same grayscale image", func() {
+				img, err := png.Decode(bytes.NewReader(b))
+				So(err, ShouldBeNil)
+				So(img.Bounds().Dx(), ShouldEqual, 3)
+				So(img.Bounds().Dy(), ShouldEqual, 2)
+				r, _, _, _ := img.At(2, 0).RGBA()
+				So(r>>8, ShouldEqual, 255)
+				r, _, _, _ = img.At(1, 1).RGBA()
+				So(r>>8, ShouldEqual, 128)
+			})
+		})
+	})
+}
@@ -2,11 +2,18 @@ package mnist
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"gopkg.in/sensorbee/sensorbee.v0/bql"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"hash"
 	"io"
+	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,6 +26,31 @@ type mnistDataSource struct {
 	target        []int32
 	dataSize      int
 	imageElemSize int
+
+	// hasher is set when hash_features is true.
+	hasher *featureHasher
+
+	// encode is the encoding of images. It's empty when images are emitted
+	// as arrays.
+	encode    string
+	imageRows int
+	imageCols int
+
+	// raw has original pixel bytes of images when raw_blob is true. data is
+	// nil in that case.
+	raw [][]byte
+
+	// order is the order of indices of emitted samples. It's nil when
+	// class_sample_weights isn't given.
+	order []int
+
+	// emitStreamEnd is true when a stream_end sentinel is emitted after the
+	// last sample.
+	emitStreamEnd bool
+
+	// stop is closed by Stop. GenerateStream returns when it observes it.
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 var (
@@ -27,6 +59,18 @@ var (
 	dataSizePath       = data.MustCompilePath("data_size")
 	imageElemSizePath  = data.MustCompilePath("image_element_size")
 	rewindPath         = data.MustCompilePath("rewind")
+	hashFeaturesPath   = data.MustCompilePath("hash_features")
+	hashDimPath        = data.MustCompilePath("hash_dim")
+	hashSeedPath       = data.MustCompilePath("hash_seed")
+	encodePath         = data.MustCompilePath("encode")
+	imageRowsPath      = data.MustCompilePath("image_rows")
+	imageColsPath      = data.MustCompilePath("image_cols")
+	imagesSHA256Path   = data.MustCompilePath("images_sha256")
+	labelsSHA256Path   = data.MustCompilePath("labels_sha256")
+	classWeightsPath   = data.MustCompilePath("class_sample_weights")
+	sampleSeedPath     = data.MustCompilePath("sample_seed")
+	emitStreamEndPath  = data.MustCompilePath("emit_stream_end")
+	rawBlobPath        = data.MustCompilePath("raw_blob")
 )
 
 // CreateSource returns a source which generate MNIST data stream. The MNIST
@@ -45,6 +89,58 @@ var (
 // data_size: MNIST data size [required]
 //
 // image_element_size: MNIST image element size (default: 784=28*28)
+//
+// hash_features: emit features mapped by the hashing trick instead of raw
+// pixels (default: false). The "data" field becomes a map having "indices"
+// and "values" arrays of non-zero elements of the hashed vector. Different
+// pixels can be mapped to the same index, so a smaller hash_dim reduces the
+// size of tuples at the cost of more collisions.
+//
+// hash_dim: dimension of the hashed vector, required when hash_features is
+// true
+//
+// hash_seed: seed of the hash function (default: 0). The mapping is
+// deterministic for the same seed.
+//
+// encode: encoding of images. When it's "png", each image is encoded as a
+// grayscale PNG and emitted as a blob in the "data" field. Encoding costs CPU
+// time while it makes tuples smaller than arrays of floats. It cannot be used
+// with hash_features.
+//
+// image_rows, image_cols: the number of rows and columns of an image used by
+// encode (default: 28). image_rows*image_cols must be image_element_size.
+//
+// images_sha256, labels_sha256: hex encoded SHA-256 checksums of the images
+// and labels files. When they're given, the checksum of each file is computed
+// while it's loaded and the creator returns an error if it doesn't match.
+// Checksums aren't verified by default.
+//
+// class_sample_weights: a map from a label to its sampling weight, e.g.
+// {"3": 2.5}. A sample having a label with weight w is emitted floor(w) times
+// plus once more with the probability of the fractional part of w, and all
+// samples are shuffled. Labels not in the map have weight 1. This changes the
+// size and class composition of the stream, so data_size no longer equals the
+// number of emitted tuples. Samples are emitted in the file order by default.
+//
+// sample_seed: seed used by class_sample_weights (default: 0). The order of
+// samples is deterministic for the same seed.
+//
+// raw_blob: emit original uint8 pixel bytes of each image as a blob in the
+// "data" field without converting them to floats (default: false). Tuples
+// also have "shape", which is [image_element_size], and "dtype", which is
+// "uint8", so that the Python side can decode and normalize them, e.g. with
+// numpy.frombuffer. This has the least overhead of all formats. It cannot be
+// used with hash_features nor encode.
+//
+// emit_stream_end: emit a sentinel tuple having "stream_end": true and the
+// number of emitted samples as "count" when the stream ends (default: false).
+// It's emitted both after the last sample and when the source is stopped in
+// the middle of the stream, so that a downstream UDF can flush partial
+// buckets. The sentinel is the last tuple of the stream and Stop doesn't
+// return until it has been written. It cannot be emitted once the writer has
+// reported that the source is stopped, e.g. by a rewindable source. The
+// sentinel doesn't have "label" nor "data", so streams consuming samples
+// should filter it out.
 func (s *DataSourceCreator) CreateSource(ctx *core.Context, ioParams *bql.IOParams,
 	params data.Map) (core.Source, error) {
 	ms, err := createMNISTDataSource(ctx, ioParams, params)
@@ -100,7 +196,23 @@ func createMNISTDataSource(ctx *core.Context, ioParams *bql.IOParams,
 		imageElemSize = int(iesInt)
 	}
 
-	target, data, err := getMNISTRawData(imagesDataName, labelsDataName, dataSize,
+	imagesSHA256 := ""
+	if is, err := params.Get(imagesSHA256Path); err == nil {
+		if imagesSHA256, err = data.AsString(is); err != nil {
+			return nil, err
+		}
+	}
+
+	labelsSHA256 := ""
+	if ls, err := params.Get(labelsSHA256Path); err == nil {
+		if labelsSHA256, err = data.AsString(ls); err != nil {
+			return nil, err
+		}
+	}
+
+	imagesData := dataSource{path: imagesDataName, sha256: imagesSHA256}
+	labelsData := dataSource{path: labelsDataName, sha256: labelsSHA256}
+	target, data, err := getMNISTRawData(imagesData, labelsData, dataSize,
 		imageElemSize)
 	if err != nil {
 		return nil, err
@@ -111,27 +223,174 @@ func createMNISTDataSource(ctx *core.Context, ioParams *bql.IOParams,
 		target:        target,
 		dataSize:      dataSize,
 		imageElemSize: imageElemSize,
+		stop:          make(chan struct{}),
+	}
+
+	if ese, err := params.Get(emitStreamEndPath); err == nil {
+		if ms.emitStreamEnd, err = data.AsBool(ese); err != nil {
+			return nil, err
+		}
+	}
+
+	hasher, err := createFeatureHasher(params, imageElemSize)
+	if err != nil {
+		return nil, err
+	}
+	ms.hasher = hasher
+
+	if err := setImageEncoding(ms, params); err != nil {
+		return nil, err
+	}
+
+	if err := setRawBlob(ms, params); err != nil {
+		return nil, err
+	}
+
+	if err := setSampleOrder(ms, params); err != nil {
+		return nil, err
 	}
 
 	return ms, nil
 }
 
+func setSampleOrder(ms *mnistDataSource, params data.Map) error {
+	cw, err := params.Get(classWeightsPath)
+	if err != nil {
+		return nil
+	}
+	m, err := data.AsMap(cw)
+	if err != nil {
+		return err
+	}
+	weights, err := parseClassSampleWeights(m)
+	if err != nil {
+		return err
+	}
+
+	seed := int64(0)
+	if ss, err := params.Get(sampleSeedPath); err == nil {
+		if seed, err = data.AsInt(ss); err != nil {
+			return err
+		}
+	}
+	ms.order = sampleOrder(ms.target, weights, seed)
+	return nil
+}
+
+func setRawBlob(ms *mnistDataSource, params data.Map) error {
+	rawBlob := false
+	if rb, err := params.Get(rawBlobPath); err == nil {
+		if rawBlob, err = data.AsBool(rb); err != nil {
+			return err
+		}
+	}
+	if !rawBlob {
+		return nil
+	}
+	if ms.hasher != nil || ms.encode != "" {
+		return fmt.Errorf("raw_blob cannot be used with hash_features nor encode")
+	}
+
+	// Pixels were normalized by 255 when they were loaded, which can be
+	// reverted exactly by rounding.
+	ms.raw = make([][]byte, len(ms.data))
+	for i, d := range ms.data {
+		b := make([]byte, len(d))
+		for j, f := range d {
+			b[j] = byte(f*255 + 0.5)
+		}
+		ms.raw[i] = b
+	}
+	ms.data = nil
+	return nil
+}
+
+func setImageEncoding(ms *mnistDataSource, params data.Map) error {
+	if e, err := params.Get(encodePath); err == nil {
+		if ms.encode, err = data.AsString(e); err != nil {
+			return err
+		}
+	}
+	switch ms.encode {
+	case "":
+		return nil
+	case "png":
+	default:
+		return fmt.Errorf("unsupported encode: %v", ms.encode)
+	}
+	if ms.hasher != nil {
+		return fmt.Errorf("encode cannot be used with hash_features")
+	}
+
+	ms.imageRows, ms.imageCols = 28, 28
+	if ir, err := params.Get(imageRowsPath); err == nil {
+		irInt, err := data.AsInt(ir)
+		if err != nil {
+			return err
+		}
+		ms.imageRows = int(irInt)
+	}
+	if ic, err := params.Get(imageColsPath); err == nil {
+		icInt, err := data.AsInt(ic)
+		if err != nil {
+			return err
+		}
+		ms.imageCols = int(icInt)
+	}
+	if ms.imageRows <= 0 || ms.imageCols <= 0 ||
+		ms.imageRows*ms.imageCols != ms.imageElemSize {
+		return fmt.Errorf("image_rows*image_cols must be image_element_size (%v)",
+			ms.imageElemSize)
+	}
+	return nil
+}
+
+func createFeatureHasher(params data.Map, imageElemSize int) (*featureHasher, error) {
+	hashFeatures := false
+	if hf, err := params.Get(hashFeaturesPath); err == nil {
+		if hashFeatures, err = data.AsBool(hf); err != nil {
+			return nil, err
+		}
+	}
+	if !hashFeatures {
+		return nil, nil
+	}
+
+	hashDim := 0
+	if hd, err := params.Get(hashDimPath); err != nil {
+		return nil, err
+	} else if hdInt, err := data.AsInt(hd); err != nil {
+		return nil, err
+	} else if hdInt <= 0 {
+		return nil, fmt.Errorf("hash_dim must be greater than 0")
+	} else {
+		hashDim = int(hdInt)
+	}
+
+	var hashSeed int64
+	if hs, err := params.Get(hashSeedPath); err == nil {
+		if hashSeed, err = data.AsInt(hs); err != nil {
+			return nil, err
+		}
+	}
+
+	return newFeatureHasher(imageElemSize, hashDim, hashSeed), nil
+}
+
 const (
 	imagesDataOffsetSize = 16
 	labelsDataOffsetSize = 8
 )
 
-func getMNISTRawData(imagesDataName string, labelsDataName string, dataSize int,
+func getMNISTRawData(imagesData dataSource, labelsData dataSource, dataSize int,
 	imageElemSize int) ([]int32, [][]float32, error) {
 
-	imagesData := dataSource{path: imagesDataName}
 	ir, ic, err := imagesData.reader()
 	if err != nil {
 		return []int32{}, [][]float32{}, err
 	}
 	defer ic.Close()
 
-	labelsData := dataSource{path: labelsDataName}
 	lr, lc, err := labelsData.reader()
 	if err != nil {
 		return []int32{}, [][]float32{}, err
@@ -159,6 +418,13 @@ func getMNISTRawData(imagesDataName string, labelsDataName string, dataSize int,
 		}
 	}
 
+	if err := imagesData.verify(ir); err != nil {
+		return []int32{}, [][]float32{}, err
+	}
+	if err := labelsData.verify(lr); err != nil {
+		return []int32{}, [][]float32{}, err
+	}
+
 	return target, data, nil
 }
 
@@ -172,21 +438,42 @@ func getMNISTRawData(imagesDataName string, labelsDataName string, dataSize int,
 //    "label": [correct data] (data.Int),
 //    "data":  [image data (28*28)] (data.Array),
 //  }
+//
+// "data" is a data.Map when hash_features is true and a data.Blob when encode
+// is "png" or raw_blob is true. Tuples also have "shape" and "dtype" when
+// raw_blob is true. Samples are emitted in the order computed from
+// class_sample_weights when it's given. A stream_end sentinel follows the
+// samples when emit_stream_end is true.
 func (s *mnistDataSource) GenerateStream(ctx *core.Context, w core.Writer) error {
-	perm := make([]int, s.dataSize, s.dataSize)
-	for i := range perm {
-		perm[i] = i
+	perm := s.order
+	if perm == nil {
+		perm = make([]int, len(s.target), len(s.target))
+		for i := range perm {
+			perm[i] = i
+		}
 	}
 
-	for i, l := range s.target {
-		im := make(data.Array, len(s.data[i]), len(s.data[i]))
-		for j, d := range s.data[i] {
-			im[j] = data.Float(d)
+	count := 0
+	for _, i := range perm {
+		select {
+		case <-s.stop:
+			return s.writeStreamEnd(ctx, w, count)
+		default:
+		}
+
+		l := s.target[i]
+		im, err := s.image(i)
+		if err != nil {
+			return err
 		}
 		dm := data.Map{
 			"label": data.Int(l),
 			"data":  im,
 		}
+		if s.raw != nil {
+			dm["shape"] = data.Array{data.Int(s.imageElemSize)}
+			dm["dtype"] = data.String("uint8")
+		}
 
 		now := time.Now()
 		tu := core.Tuple{
@@ -195,24 +482,87 @@ func (s *mnistDataSource) GenerateStream(ctx *core.Context, w core.Writer) error
 			ProcTimestamp: now,
 			Trace:         []core.TraceEvent{},
 		}
-		err := w.Write(ctx, &tu)
+		err = w.Write(ctx, &tu)
 		if err == core.ErrSourceRewound || err == core.ErrSourceStopped {
 			return err
 		}
+		count++
 	}
 
 	ctx.Log().WithField("source_type", "mnist_source").Info(
 		"All tuples have been emitted")
+	return s.writeStreamEnd(ctx, w, count)
+}
+
+// writeStreamEnd writes the stream_end sentinel when emit_stream_end is true.
+// count is the number of samples emitted.
+func (s *mnistDataSource) writeStreamEnd(ctx *core.Context, w core.Writer, count int) error {
+	if !s.emitStreamEnd {
+		return nil
+	}
+	now := time.Now()
+	err := w.Write(ctx, &core.Tuple{
+		Data: data.Map{
+			"stream_end": data.True,
+			"count":      data.Int(count),
+		},
+		Timestamp:     now,
+		ProcTimestamp: now,
+		Trace:         []core.TraceEvent{},
+	})
+	if err == core.ErrSourceRewound || err == core.ErrSourceStopped {
+		return err
+	}
 	return nil
 }
 
-// Stop stops generating stream. TODO forced stop
+// image returns the i-th image in the format specified by parameters.
+func (s *mnistDataSource) image(i int) (data.Value, error) {
+	if s.raw != nil {
+		return data.Blob(s.raw[i]), nil
+	}
+
+	if s.hasher != nil {
+		indices, values := s.hasher.hash(s.data[i])
+		return data.Map{
+			"indices": indices,
+			"values":  values,
+		}, nil
+	}
+
+	if s.encode == "png" {
+		b, err := encodePNG(s.data[i], s.imageRows, s.imageCols)
+		if err != nil {
+			return nil, err
+		}
+		return data.Blob(b), nil
+	}
+
+	im := make(data.Array, len(s.data[i]), len(s.data[i]))
+	for j, d := range s.data[i] {
+		im[j] = data.Float(d)
+	}
+	return im, nil
+}
+
+// Stop stops generating stream. GenerateStream stops before emitting the
+// next sample and writes the stream_end sentinel if enabled. Stop doesn't wait
+// for GenerateStream to return because it may be blocked in Write, which
+// only returns after the source is stopped.
 func (s *mnistDataSource) Stop(ctx *core.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
 	return nil
 }
 
 type dataSource struct {
 	path string
+
+	// sha256 is the expected hex encoded SHA-256 checksum of the file. The
+	// checksum isn't verified when it's empty.
+	sha256 string
+	hash   hash.Hash
 }
 
 func (s *dataSource) reader() (*bufio.Reader, io.Closer, error) {
@@ -220,6 +570,27 @@ func (s *dataSource) reader() (*bufio.Reader, io.Closer, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	r := bufio.NewReader(f)
+	var fr io.Reader = f
+	if s.sha256 != "" {
+		s.hash = sha256.New()
+		fr = io.TeeReader(f, s.hash)
+	}
+	r := bufio.NewReader(fr)
 	return r, f, nil
 }
+
+// verify reads the rest of r, which must be returned from reader, and
+// compares the checksum of the whole file with the expected one.
+func (s *dataSource) verify(r io.Reader) error {
+	if s.sha256 == "" {
+		return nil
+	}
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(s.hash.Sum(nil)); !strings.EqualFold(sum, s.sha256) {
+		return fmt.Errorf("SHA-256 checksum of %v doesn't match: expected %v but %v",
+			s.path, s.sha256, sum)
+	}
+	return nil
+}
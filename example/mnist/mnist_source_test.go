@@ -6,6 +6,7 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/bql"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
 	"os"
 	"testing"
 )
@@ -108,5 +109,226 @@ func TestCreateSource(t *testing.T) {
 				So(ms.dataSize, ShouldEqual, 1)
 			})
 		})
+		Convey("When get parameters which enable hash_features without hash_dim", func() {
+			params := data.Map{
+				"images_file_name": data.String("_test_train_image"),
+				"labels_file_name": data.String("_test_train_label"),
+				"data_size":        data.Int(1),
+				"hash_features":    data.True,
+			}
+			Convey("Then the creator should return an error", func() {
+				s, err := createMNISTDataSource(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+			})
+		})
+		Convey("When get parameters which enable hash_features", func() {
+			params := data.Map{
+				"images_file_name": data.String("_test_train_image"),
+				"labels_file_name": data.String("_test_train_label"),
+				"data_size":        data.Int(1),
+				"hash_features":    data.True,
+				"hash_dim":         data.Int(64),
+			}
+			Convey("Then the source should have a feature hasher", func() {
+				s, err := createMNISTDataSource(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+
+				ms, ok := s.(*mnistDataSource)
+				So(ok, ShouldBeTrue)
+				So(ms.hasher, ShouldNotBeNil)
+				So(ms.hasher.dim, ShouldEqual, 64)
+			})
+		})
+		Convey("When get parameters which set png encode", func() {
+			params := data.Map{
+				"images_file_name": data.String("_test_train_image"),
+				"labels_file_name": data.String("_test_train_label"),
+				"data_size":        data.Int(1),
+				"encode":           data.String("png"),
+			}
+			Convey("Then the source should emit a PNG blob", func() {
+				s, err := createMNISTDataSource(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+
+				ms, ok := s.(*mnistDataSource)
+				So(ok, ShouldBeTrue)
+				im, err := ms.image(0)
+				So(err, ShouldBeNil)
+				b, err := data.AsBlob(im)
+				So(err, ShouldBeNil)
+				So(string(b[1:4]), ShouldEqual, "PNG")
+			})
+
+			Convey("Then the creator should fail when the size doesn't match", func() {
+				params["image_rows"] = data.Int(27)
+				s, err := createMNISTDataSource(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+			})
+		})
+		Convey("When get parameters which have correct checksums", func() {
+			params := data.Map{
+				"images_file_name": data.String("_test_train_image"),
+				"labels_file_name": data.String("_test_train_label"),
+				"data_size":        data.Int(1),
+				"images_sha256":    data.String("9d7432e26dfded6b2edb4db9ada2f4fd57af36f2229b527030a8e82d9862a93b"),
+				"labels_sha256":    data.String("98EF1080DD87A7CF4047558BEB84DD730C786B93EE2CB89AB04FF757AF10DA5E"),
+			}
+			Convey("Then the creator should succeed", func() {
+				s, err := createMNISTDataSource(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				So(s, ShouldNotBeNil)
+			})
+
+			Convey("Then the creator should fail when a checksum doesn't match", func() {
+				params["labels_sha256"] = data.String("0000000000000000000000000000000000000000000000000000000000000000")
+				s, err := createMNISTDataSource(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+			})
+		})
+		Convey("When get parameters which enable raw_blob", func() {
+			params := data.Map{
+				"images_file_name": data.String("_test_train_image"),
+				"labels_file_name": data.String("_test_train_label"),
+				"data_size":        data.Int(1),
+				"raw_blob":         data.True,
+			}
+			Convey("Then the source should emit original pixel bytes", func() {
+				s, err := createMNISTDataSource(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+
+				ms, ok := s.(*mnistDataSource)
+				So(ok, ShouldBeTrue)
+				im, err := ms.image(0)
+				So(err, ShouldBeNil)
+				b, err := data.AsBlob(im)
+				So(err, ShouldBeNil)
+				So(len(b), ShouldEqual, 784)
+
+				// The test image file has a 16 bytes header.
+				f, err := ioutil.ReadFile("_test_train_image")
+				So(err, ShouldBeNil)
+				So(b, ShouldResemble, f[16:16+784])
+			})
+
+			Convey("Then the creator should fail with encode", func() {
+				params["encode"] = data.String("png")
+				s, err := createMNISTDataSource(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+			})
+		})
+		Convey("When get parameters which have class_sample_weights", func() {
+			params := data.Map{
+				"images_file_name":     data.String("_test_train_image"),
+				"labels_file_name":     data.String("_test_train_label"),
+				"data_size":            data.Int(1),
+				"class_sample_weights": data.Map{},
+			}
+			Convey("Then the source should have the order of samples", func() {
+				s, err := createMNISTDataSource(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+
+				ms, ok := s.(*mnistDataSource)
+				So(ok, ShouldBeTrue)
+				So(ms.order, ShouldResemble, []int{0})
+			})
+
+			Convey("Then the creator should fail with an invalid weight", func() {
+				params["class_sample_weights"] = data.Map{"1": data.String("a")}
+				s, err := createMNISTDataSource(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+			})
+		})
 	})
 }
+
+func TestStreamEnd(t *testing.T) {
+	ctx := core.NewContext(&core.ContextConfig{})
+	ioParams := &bql.IOParams{}
+	Convey("Given a MNIST data source emitting stream_end", t, func() {
+		params := data.Map{
+			"images_file_name": data.String("_test_train_image"),
+			"labels_file_name": data.String("_test_train_label"),
+			"data_size":        data.Int(1),
+			"emit_stream_end":  data.True,
+		}
+		s, err := createMNISTDataSource(ctx, ioParams, params)
+		So(err, ShouldBeNil)
+		ms, ok := s.(*mnistDataSource)
+		So(ok, ShouldBeTrue)
+		ms.order = []int{0, 0, 0}
+
+		var emitted []data.Map
+		var onWrite func()
+		w := core.WriterFunc(func(ctx *core.Context, t *core.Tuple) error {
+			emitted = append(emitted, t.Data)
+			if onWrite != nil {
+				onWrite()
+			}
+			return nil
+		})
+
+		Convey("When generate the whole stream", func() {
+			So(ms.GenerateStream(ctx, w), ShouldBeNil)
+			Convey("Then the sentinel should follow all samples", func() {
+				So(len(emitted), ShouldEqual, 4)
+				So(emitted[3], ShouldResemble, data.Map{
+					"stream_end": data.True,
+					"count":      data.Int(3),
+				})
+			})
+		})
+
+		Convey("When stop the source while a sample is being written", func() {
+			onWrite = func() {
+				if len(emitted) == 1 {
+					// Stop must return while Write is blocked.
+					So(ms.Stop(ctx), ShouldBeNil)
+				}
+			}
+			So(ms.GenerateStream(ctx, w), ShouldBeNil)
+
+			Convey("Then the sentinel should follow the emitted samples", func() {
+				So(len(emitted), ShouldEqual, 2)
+				So(emitted[1]["count"], ShouldEqual, data.Int(1))
+			})
+		})
+	})
+}
+
+func benchmarkImageSource(rawBlob bool) *mnistDataSource {
+	d := make([]float32, 28*28)
+	for i := range d {
+		d[i] = float32(i%256) / 255
+	}
+	ms := &mnistDataSource{
+		data:          [][]float32{d},
+		target:        []int32{0},
+		dataSize:      1,
+		imageElemSize: len(d),
+	}
+	if rawBlob {
+		setRawBlob(ms, data.Map{"raw_blob": data.True})
+	}
+	return ms
+}
+
+func BenchmarkImageFloatArray(b *testing.B) {
+	ms := benchmarkImageSource(false)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ms.image(0)
+	}
+}
+
+func BenchmarkImageRawBlob(b *testing.B) {
+	ms := benchmarkImageSource(true)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ms.image(0)
+	}
+}
@@ -0,0 +1,59 @@
+package mnist
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+// parseClassSampleWeights converts class_sample_weights parameter to a map
+// from a label to its weight. Keys of m are labels written as strings.
+func parseClassSampleWeights(m data.Map) (map[int32]float64, error) {
+	weights := make(map[int32]float64, len(m))
+	for k, v := range m {
+		l, err := strconv.ParseInt(k, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("label of class_sample_weights must be an integer: %v", k)
+		}
+		w, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("weight of label %v must be a non-negative number: %v", k, w)
+		}
+		weights[int32(l)] = w
+	}
+	return weights, nil
+}
+
+// sampleOrder returns the order of indices in which samples are emitted. Each
+// sample appears floor(w) times plus once more with the probability of the
+// fractional part of w, where w is the weight of its label. Labels missing
+// from weights have weight 1. The result is shuffled so that repeated samples
+// are spread over the stream. The order is deterministic for the same seed.
+func sampleOrder(target []int32, weights map[int32]float64, seed int64) []int {
+	r := rand.New(rand.NewSource(seed))
+	order := make([]int, 0, len(target))
+	for i, l := range target {
+		w, ok := weights[l]
+		if !ok {
+			w = 1
+		}
+		n := int(w)
+		if r.Float64() < w-float64(n) {
+			n++
+		}
+		for j := 0; j < n; j++ {
+			order = append(order, i)
+		}
+	}
+
+	for i := len(order) - 1; i > 0; i-- {
+		j := r.Intn(i + 1)
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
@@ -0,0 +1,70 @@
+package mnist
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestSampleOrder(t *testing.T) {
+	Convey("Given labels of an imbalanced dataset", t, func() {
+		target := []int32{0, 0, 0, 0, 1}
+
+		Convey("When compute the order with integer weights", func() {
+			order := sampleOrder(target, map[int32]float64{0: 0, 1: 3}, 1)
+			Convey("Then only the weighted class should be repeated", func() {
+				So(order, ShouldResemble, []int{4, 4, 4})
+			})
+		})
+
+		Convey("When compute the order without weights of some classes", func() {
+			order := sampleOrder(target, map[int32]float64{1: 2}, 1)
+			Convey("Then the other classes should appear once", func() {
+				So(len(order), ShouldEqual, 6)
+				cnt := map[int]int{}
+				for _, i := range order {
+					cnt[i]++
+				}
+				So(cnt[4], ShouldEqual, 2)
+				So(cnt[0], ShouldEqual, 1)
+			})
+		})
+
+		Convey("When compute the order with fractional weights", func() {
+			weights := map[int32]float64{0: 0.5, 1: 2.5}
+			order := sampleOrder(target, weights, 7)
+			Convey("Then it should be deterministic under the same seed", func() {
+				So(sampleOrder(target, weights, 7), ShouldResemble, order)
+			})
+		})
+	})
+}
+
+func TestParseClassSampleWeights(t *testing.T) {
+	Convey("Given class_sample_weights parameter", t, func() {
+		Convey("When it has valid weights", func() {
+			w, err := parseClassSampleWeights(data.Map{
+				"1": data.Int(2),
+				"3": data.Float(0.5),
+			})
+			Convey("Then it should be converted to a map keyed by labels", func() {
+				So(err, ShouldBeNil)
+				So(w, ShouldResemble, map[int32]float64{1: 2, 3: 0.5})
+			})
+		})
+
+		Convey("When it has a non-integer label", func() {
+			_, err := parseClassSampleWeights(data.Map{"a": data.Int(2)})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When it has a negative weight", func() {
+			_, err := parseClassSampleWeights(data.Map{"1": data.Int(-1)})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
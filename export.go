@@ -0,0 +1,45 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"os"
+)
+
+const defaultONNXExportMethod = "to_onnx"
+
+// ExportONNX calls the ONNX export method of the model, which is `to_onnx` by
+// default, with path and returns the size of the written file in bytes. The
+// state is locked exclusively during the export so that the model isn't
+// trained while it's exported.
+func (s *State) ExportONNX(ctx *core.Context, path string) (data.Value, error) {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.timeouts.checkOutstanding(); err != nil {
+		return nil, err
+	}
+	method := s.params.ONNXExportMethod
+	if method == "" {
+		method = defaultONNXExportMethod
+	}
+	if _, err := s.callOptional("ONNX export", method, data.String(path)); err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return data.Int(fi.Size()), nil
+}
+
+// ExportONNX exports the model to path in ONNX format. See State.ExportONNX
+// for details.
+func ExportONNX(ctx *core.Context, stateName string, path string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ExportONNX(ctx, path)
+}
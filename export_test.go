@@ -0,0 +1,59 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPyMLStateExportONNX(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate", t, func() {
+		dir, err := ioutil.TempDir("", "pymlstate_onnx")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "model.onnx")
+
+		newState := func(className string) *State {
+			baseParams := &pystate.BaseParams{
+				ModulePath: "./",
+				ModuleName: "_test_pymlstate",
+				ClassName:  className,
+			}
+			s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+			So(err, ShouldBeNil)
+			return s
+		}
+
+		Convey("When export a model having to_onnx", func() {
+			s := newState("TestClass")
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			v, err := s.ExportONNX(ctx, path)
+			Convey("Then it should return the size of the file", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Int(4))
+			})
+		})
+
+		Convey("When export a model not having to_onnx", func() {
+			s := newState("MinimalClass")
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			_, err := s.ExportONNX(ctx, path)
+			Convey("Then it should fail as not supported", func() {
+				So(isNotSupported(err), ShouldBeTrue)
+			})
+		})
+	})
+}
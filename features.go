@@ -0,0 +1,449 @@
+package pymlstate
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+)
+
+// compileFeatureOrder compiles each element of feature_order as a path.
+func compileFeatureOrder(order []string) ([]data.Path, error) {
+	if order == nil {
+		return nil, nil
+	}
+	if len(order) == 0 {
+		return nil, errors.New("feature_order must not be empty")
+	}
+
+	paths := make([]data.Path, len(order))
+	for i, o := range order {
+		p, err := data.CompilePath(o)
+		if err != nil {
+			return nil, fmt.Errorf("feature_order[%v] is not a valid path: %v", i, err)
+		}
+		paths[i] = p
+	}
+	return paths, nil
+}
+
+const (
+	nullHandlingNone  = "none"
+	nullHandlingSkip  = "skip"
+	nullHandlingError = "error"
+)
+
+func validateNullHandling(h string) error {
+	switch h {
+	case nullHandlingNone, nullHandlingSkip, nullHandlingError:
+		return nil
+	default:
+		return fmt.Errorf("null_handling must be '%v', '%v', or '%v': %v",
+			nullHandlingNone, nullHandlingSkip, nullHandlingError, h)
+	}
+}
+
+// needsInputConversion returns true when convertInput changes a value.
+func (s *State) needsInputConversion() bool {
+	return len(s.featurePaths) > 0 || s.params.NullHandling == nullHandlingSkip ||
+		s.params.NullHandling == nullHandlingError
+}
+
+// convertInput converts a value passed to fit or predict according to
+// null_handling and feature_order.
+func (s *State) convertInput(v data.Value) (data.Value, error) {
+	if !s.needsInputConversion() {
+		return v, nil
+	}
+
+	v, err := handleNulls(s.params.NullHandling, v)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.featurePaths) > 0 {
+		return s.assembleFeatures(v)
+	}
+	return v, nil
+}
+
+// convertBatch converts each element of bucket in the same way as Predict. It
+// returns converted elements and the argument passed to Python methods taking
+// a batch, which has sparse representations when sparse_threshold is given.
+func (s *State) convertBatch(bucket []data.Value) ([]data.Value, data.Array, error) {
+	return s.convertEach(bucket, s.convertInput, s.sparsify)
+}
+
+// convertSamples converts each training sample of bucket by convertSample. It
+// returns values in the same way as convertBatch. It's used for samples given
+// to fit, Evaluate, and Score so that their labels are kept.
+func (s *State) convertSamples(bucket []data.Value) ([]data.Value, data.Array, error) {
+	return s.convertEach(bucket, s.convertSample, s.sparsifySample)
+}
+
+func (s *State) convertEach(bucket []data.Value, convert func(data.Value) (data.Value, error),
+	sparsify func(data.Value) data.Value) ([]data.Value, data.Array, error) {
+	if s.needsInputConversion() {
+		b := make(data.Array, len(bucket))
+		for i, v := range bucket {
+			f, err := convert(v)
+			if err != nil {
+				return nil, nil, err
+			}
+			b[i] = f
+		}
+		bucket = b
+	}
+	arg := data.Array(bucket)
+	if s.params.SparseThreshold > 0 {
+		arg = make(data.Array, len(bucket))
+		for i, v := range bucket {
+			arg[i] = sparsify(v)
+		}
+	}
+	return bucket, arg, nil
+}
+
+// convertSample converts a training sample. Only features of a labeled sample
+// are converted by convertInput, and the other fields are kept. When
+// feature_order is given and a sample having no "data" field has "label"
+// field, the sample is converted to a labeled sample having the assembled
+// features and the label, e.g. {"data": [x, y], "label": 1}, so that the
+// label doesn't have to be a part of feature_order, which would break
+// predictions. Other samples are converted in the same way as Predict.
+func (s *State) convertSample(v data.Value) (data.Value, error) {
+	if f, ok := sampleFeatures(v); ok {
+		c, err := s.convertInput(f)
+		if err != nil {
+			return nil, err
+		}
+		m, _ := data.AsMap(v)
+		return withFeatures(m, c), nil
+	}
+
+	c, err := s.convertInput(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.featurePaths) > 0 {
+		if m, err := data.AsMap(v); err == nil {
+			if l, ok := m["label"]; ok {
+				return data.Map{"data": c, "label": l}, nil
+			}
+		}
+	}
+	return c, nil
+}
+
+// sparsifySample applies sparsify to features of a training sample.
+func (s *State) sparsifySample(v data.Value) data.Value {
+	f, ok := sampleFeatures(v)
+	if !ok {
+		return s.sparsify(v)
+	}
+	m, _ := data.AsMap(v)
+	return withFeatures(m, s.sparsify(f))
+}
+
+// handleNulls applies null_handling to null values in maps, including ones
+// nested in other maps and arrays. Null elements of arrays are kept as they
+// are so that positions of elements don't change. v itself isn't modified.
+func handleNulls(handling string, v data.Value) (data.Value, error) {
+	if handling != nullHandlingSkip && handling != nullHandlingError {
+		return v, nil
+	}
+
+	switch v.Type() {
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		res := make(data.Map, len(m))
+		for k, e := range m {
+			if e.Type() == data.TypeNull {
+				if handling == nullHandlingError {
+					return nil, fmt.Errorf("field '%v' is null", k)
+				}
+				continue
+			}
+			c, err := handleNulls(handling, e)
+			if err != nil {
+				return nil, err
+			}
+			res[k] = c
+		}
+		return res, nil
+
+	case data.TypeArray:
+		arr, _ := data.AsArray(v)
+		res := make(data.Array, len(arr))
+		for i, e := range arr {
+			c, err := handleNulls(handling, e)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = c
+		}
+		return res, nil
+
+	default:
+		return v, nil
+	}
+}
+
+// assembleFeatures converts a `data.Map` to a `data.Array` having values
+// located by featurePaths in the same order.
+func (s *State) assembleFeatures(v data.Value) (data.Value, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("data must be a map when feature_order is set: %v", err)
+	}
+
+	f := make(data.Array, len(s.featurePaths))
+	for i, p := range s.featurePaths {
+		e, err := m.Get(p)
+		if err != nil {
+			return nil, fmt.Errorf("feature '%v' is missing: %v", s.params.FeatureOrder[i], err)
+		}
+		f[i] = e
+	}
+	return f, nil
+}
+
+// Samples written to the state are either features themselves or labeled
+// samples, which are `data.Map`s having features in "data" field and other
+// fields such as "label", e.g. {"data": [0.1, 0.2], "label": 1} emitted by
+// the MNIST example.
+
+// sampleFeatures returns features of a sample and true when the sample is a
+// labeled sample.
+func sampleFeatures(v data.Value) (data.Value, bool) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return v, false
+	}
+	f, ok := m["data"]
+	if !ok {
+		return v, false
+	}
+	return f, true
+}
+
+// withFeatures returns a copy of a labeled sample whose features are
+// replaced with f.
+func withFeatures(sample data.Map, f data.Value) data.Map {
+	res := make(data.Map, len(sample))
+	for k, v := range sample {
+		res[k] = v
+	}
+	res["data"] = f
+	return res
+}
+
+func (s *State) preprocessesFeatures() bool {
+	p := &s.params
+	return p.FeatureClipMin != nil || p.FeatureClipMax != nil || p.RejectNaNFeatures
+}
+
+// preprocessSamples applies feature_clip_min, feature_clip_max, and
+// reject_nan_features to dataSet written to the state. dataSet is a batch of
+// samples when batch_train_size is 1 or less and it's an array, and a single
+// sample otherwise. Only features are preprocessed: "data" field of labeled
+// samples, or values of feature_order paths when it's given, so that labels
+// aren't modified. Rejected samples are removed from the batch. It returns
+// the preprocessed value, which is nil when no sample is left, and the number
+// of rejected samples. dataSet itself isn't modified.
+func (s *State) preprocessSamples(dataSet data.Value) (data.Value, int) {
+	if !s.preprocessesFeatures() {
+		return dataSet, 0
+	}
+	if s.params.BatchSize > 1 || dataSet.Type() != data.TypeArray {
+		v, ok := s.preprocessSample(dataSet)
+		if !ok {
+			return nil, 1
+		}
+		return v, 0
+	}
+
+	arr, _ := data.AsArray(dataSet)
+	res := make(data.Array, 0, len(arr))
+	for _, e := range arr {
+		if v, ok := s.preprocessSample(e); ok {
+			res = append(res, v)
+		}
+	}
+	if len(res) == 0 {
+		return nil, len(arr)
+	}
+	return res, len(arr) - len(res)
+}
+
+// preprocessSample preprocesses features of a sample. It returns false when
+// the sample is rejected.
+func (s *State) preprocessSample(v data.Value) (data.Value, bool) {
+	f, labeled := sampleFeatures(v)
+	f, ok := s.preprocessFeatureValues(f)
+	if !ok {
+		return nil, false
+	}
+	if !labeled {
+		return f, true
+	}
+	m, _ := data.AsMap(v)
+	return withFeatures(m, f), true
+}
+
+// preprocessFeatureValues applies preprocessFeatures to values of
+// feature_order paths when it's given and f is a `data.Map`, and to f itself
+// otherwise.
+func (s *State) preprocessFeatureValues(f data.Value) (data.Value, bool) {
+	m, err := data.AsMap(f)
+	if err != nil || len(s.featurePaths) == 0 {
+		return s.preprocessFeatures(f)
+	}
+
+	res := m.Copy().(data.Map)
+	for _, p := range s.featurePaths {
+		e, err := m.Get(p)
+		if err != nil {
+			// A missing feature is reported when it's converted.
+			continue
+		}
+		c, ok := s.preprocessFeatures(e)
+		if !ok {
+			return nil, false
+		}
+		if err := res.Set(p, c); err != nil {
+			return nil, false
+		}
+	}
+	return res, true
+}
+
+// preprocessFeatures clamps numeric values in v, including ones in arrays and
+// maps, by feature_clip_min and feature_clip_max. It returns false when v has
+// NaN or Inf and reject_nan_features is true. v itself isn't modified.
+func (s *State) preprocessFeatures(v data.Value) (data.Value, bool) {
+	p := &s.params
+	if !s.preprocessesFeatures() {
+		return v, true
+	}
+
+	switch v.Type() {
+	case data.TypeArray:
+		arr, _ := data.AsArray(v)
+		res := make(data.Array, len(arr))
+		for i, e := range arr {
+			f, ok := s.preprocessFeatures(e)
+			if !ok {
+				return nil, false
+			}
+			res[i] = f
+		}
+		return res, true
+
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		res := make(data.Map, len(m))
+		for k, e := range m {
+			f, ok := s.preprocessFeatures(e)
+			if !ok {
+				return nil, false
+			}
+			res[k] = f
+		}
+		return res, true
+
+	case data.TypeFloat:
+		f, _ := data.AsFloat(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			if p.RejectNaNFeatures {
+				return nil, false
+			}
+			if math.IsNaN(f) {
+				return v, true
+			}
+		}
+		if p.FeatureClipMin != nil && f < *p.FeatureClipMin {
+			return data.Float(*p.FeatureClipMin), true
+		}
+		if p.FeatureClipMax != nil && f > *p.FeatureClipMax {
+			return data.Float(*p.FeatureClipMax), true
+		}
+		return v, true
+
+	case data.TypeInt:
+		i, _ := data.AsInt(v)
+		if p.FeatureClipMin != nil && float64(i) < *p.FeatureClipMin {
+			return data.Float(*p.FeatureClipMin), true
+		}
+		if p.FeatureClipMax != nil && float64(i) > *p.FeatureClipMax {
+			return data.Float(*p.FeatureClipMax), true
+		}
+		return v, true
+
+	default:
+		return v, true
+	}
+}
+
+// featureDim returns the length of a feature vector. It returns -1 when v
+// isn't an array.
+func featureDim(v data.Value) int {
+	arr, err := data.AsArray(v)
+	if err != nil {
+		return -1
+	}
+	return len(arr)
+}
+
+// sampleDim returns the dimension of the feature vector of a sample, which
+// is converted in the same way as fit, e.g. by feature_order. It returns -1
+// when the features cannot be converted to an array.
+func (s *State) sampleDim(v data.Value) int {
+	f, _ := sampleFeatures(v)
+	f, err := s.convertInput(f)
+	if err != nil {
+		return -1
+	}
+	return featureDim(f)
+}
+
+// checkFeatureDim returns false when enforce_feature_dim is true and samples
+// in dataSet have a dimension different from the one recorded at the first
+// successful fit. dataSet is a single sample unless batch_train_size is 1, in
+// which case an array is regarded as a batch of samples.
+func (s *State) checkFeatureDim(dataSet data.Value) bool {
+	if !s.params.EnforceFeatureDim || s.expectedDim <= 0 {
+		return true
+	}
+
+	samples := []data.Value{dataSet}
+	if s.params.BatchSize <= 1 && dataSet.Type() == data.TypeArray {
+		samples, _ = data.AsArray(dataSet)
+	}
+	for _, v := range samples {
+		if s.sampleDim(v) != s.expectedDim {
+			return false
+		}
+	}
+	return true
+}
+
+// recordFeatureDim records the dimension of the first sample in bucket when
+// it hasn't been recorded yet. When enforce_feature_dim is true and the
+// dimension cannot be determined, it logs a warning once because the
+// dimension isn't enforced.
+func (s *State) recordFeatureDim(ctx *core.Context, bucket []data.Value) {
+	if s.expectedDim > 0 || len(bucket) == 0 {
+		return
+	}
+	if d := s.sampleDim(bucket[0]); d > 0 {
+		s.expectedDim = d
+		return
+	}
+	if s.params.EnforceFeatureDim && !s.unknownDimWarned {
+		s.unknownDimWarned = true
+		ctx.Log().Warn("pymlstate cannot determine the feature dimension, so " +
+			"enforce_feature_dim has no effect: features must be an array, a map " +
+			"with feature_order, or \"data\" field of a labeled sample")
+	}
+}
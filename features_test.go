@@ -0,0 +1,309 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"testing"
+)
+
+func TestAssembleFeatures(t *testing.T) {
+	Convey("Given a state with feature_order", t, func() {
+		s := &State{}
+		So(s.setParams(&MLParams{
+			BatchSize:    1,
+			FeatureOrder: []string{"b", "a", "c.d"},
+		}), ShouldBeNil)
+
+		Convey("When assemble features from a map having extra fields", func() {
+			f, err := s.assembleFeatures(data.Map{
+				"a":     data.Int(1),
+				"b":     data.Int(2),
+				"c":     data.Map{"d": data.Int(3)},
+				"extra": data.Int(4),
+			})
+			Convey("Then features should be in the configured order", func() {
+				So(err, ShouldBeNil)
+				So(f, ShouldResemble, data.Array{data.Int(2), data.Int(1), data.Int(3)})
+			})
+		})
+
+		Convey("When assemble features from a map missing a field", func() {
+			_, err := s.assembleFeatures(data.Map{
+				"a": data.Int(1),
+			})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When assemble features from a non map value", func() {
+			_, err := s.assembleFeatures(data.Int(1))
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an invalid feature_order", t, func() {
+		Convey("When it's empty", func() {
+			_, err := compileFeatureOrder([]string{})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When it has an invalid path", func() {
+			_, err := compileFeatureOrder([]string{"a[", "b"})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestPreprocessFeatures(t *testing.T) {
+	Convey("Given a state clipping features", t, func() {
+		min, max := -1.0, 1.0
+		s := &State{}
+		So(s.setParams(&MLParams{
+			BatchSize:         1,
+			FeatureClipMin:    &min,
+			FeatureClipMax:    &max,
+			RejectNaNFeatures: true,
+		}), ShouldBeNil)
+
+		Convey("When preprocess values out of the range", func() {
+			v := data.Array{data.Float(-3), data.Float(0.5), data.Int(2),
+				data.Map{"a": data.Float(1.5)}}
+			f, ok := s.preprocessFeatures(v)
+			Convey("Then values should be clamped", func() {
+				So(ok, ShouldBeTrue)
+				So(f, ShouldResemble, data.Array{data.Float(-1), data.Float(0.5),
+					data.Float(1), data.Map{"a": data.Float(1)}})
+			})
+			Convey("Then the original value should not be modified", func() {
+				So(v[0], ShouldEqual, data.Float(-3))
+			})
+		})
+
+		Convey("When preprocess values having NaN", func() {
+			_, ok := s.preprocessFeatures(data.Array{data.Float(math.NaN())})
+			Convey("Then it should be rejected", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When preprocess values having Inf", func() {
+			_, ok := s.preprocessFeatures(data.Map{"a": data.Float(math.Inf(1))})
+			Convey("Then it should be rejected", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestPyMLStateWritePreprocessesFeatures(t *testing.T) {
+	ctx := core.NewContext(&core.ContextConfig{})
+	Convey("Given a pymlstate clipping features and rejecting NaN", t, func() {
+		max := 1.0
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "RecordClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:         1,
+			FeatureClipMax:    &max,
+			RejectNaNFeatures: true,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When write a batch of labeled samples", func() {
+			So(s.Write(ctx, &core.Tuple{Data: data.Map{
+				"data": data.Array{
+					data.Map{"data": data.Array{data.Float(2), data.Float(0.5)}, "label": data.Int(7)},
+					data.Map{"data": data.Array{data.Float(math.NaN())}, "label": data.Int(3)},
+					data.Map{"data": data.Array{data.Float(0.1)}, "label": data.Int(5)},
+				},
+			}}), ShouldBeNil)
+
+			Convey("Then only features should be clipped and labels should be unchanged", func() {
+				v, err := s.base.Call("last_fit")
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Array{
+					data.Map{"data": data.Array{data.Float(1), data.Float(0.5)}, "label": data.Int(7)},
+					data.Map{"data": data.Array{data.Float(0.1)}, "label": data.Int(5)},
+				})
+			})
+
+			Convey("Then only the sample having NaN should be skipped", func() {
+				So(s.Status()["skipped_nan_tuples"], ShouldEqual, data.Int(1))
+			})
+		})
+	})
+}
+
+func TestPyMLStateFitKeepsLabels(t *testing.T) {
+	ctx := core.NewContext(&core.ContextConfig{})
+	Convey("Given a pymlstate with feature_order", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "RecordClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:    2,
+			FeatureOrder: []string{"x", "y"},
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When fit labeled samples", func() {
+			_, err := s.Fit(ctx, []data.Value{
+				data.Map{
+					"data":  data.Map{"x": data.Int(1), "y": data.Int(2)},
+					"label": data.Int(7),
+				},
+				data.Map{"x": data.Int(3), "y": data.Int(4), "label": data.Int(5)},
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then only features should be assembled and labels should be kept", func() {
+				v, err := s.base.Call("last_fit")
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Array{
+					data.Map{"data": data.Array{data.Int(1), data.Int(2)}, "label": data.Int(7)},
+					data.Map{"data": data.Array{data.Int(3), data.Int(4)}, "label": data.Int(5)},
+				})
+			})
+
+			Convey("Then predict should still take features only", func() {
+				v, err := s.Predict(ctx, data.Map{"x": data.Int(1), "y": data.Int(2)})
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Array{data.Int(1), data.Int(2)})
+			})
+		})
+	})
+}
+
+func TestCheckFeatureDim(t *testing.T) {
+	ctx := core.NewContext(&core.ContextConfig{})
+	Convey("Given a state enforcing feature dimension", t, func() {
+		s := &State{}
+		So(s.setParams(&MLParams{
+			BatchSize:         2,
+			EnforceFeatureDim: true,
+		}), ShouldBeNil)
+
+		Convey("When the dimension hasn't been recorded yet", func() {
+			Convey("Then any sample should be accepted", func() {
+				So(s.checkFeatureDim(data.Array{data.Int(1)}), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the dimension is recorded by a fit", func() {
+			s.recordFeatureDim(ctx, []data.Value{
+				data.Array{data.Int(1), data.Int(2), data.Int(3)},
+			})
+			So(s.expectedDim, ShouldEqual, 3)
+
+			Convey("Then a sample having the same dimension should be accepted", func() {
+				So(s.checkFeatureDim(data.Array{data.Int(4), data.Int(5), data.Int(6)}),
+					ShouldBeTrue)
+			})
+
+			Convey("Then a sample having a different dimension should be rejected", func() {
+				So(s.checkFeatureDim(data.Array{data.Int(4), data.Int(5)}), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the dimension is recorded by a fit of labeled samples", func() {
+			s.recordFeatureDim(ctx, []data.Value{
+				data.Map{"data": data.Array{data.Int(1), data.Int(2)}, "label": data.Int(9)},
+			})
+
+			Convey("Then the dimension of the features should be recorded", func() {
+				So(s.expectedDim, ShouldEqual, 2)
+			})
+
+			Convey("Then a labeled sample having a different dimension should be rejected", func() {
+				So(s.checkFeatureDim(data.Map{
+					"data":  data.Array{data.Int(1)},
+					"label": data.Int(9),
+				}), ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a state enforcing feature dimension with feature_order", t, func() {
+		s := &State{}
+		So(s.setParams(&MLParams{
+			BatchSize:         2,
+			EnforceFeatureDim: true,
+			FeatureOrder:      []string{"a", "b"},
+		}), ShouldBeNil)
+
+		Convey("When the dimension is recorded by a fit of maps", func() {
+			s.recordFeatureDim(ctx, []data.Value{
+				data.Map{"a": data.Int(1), "b": data.Int(2), "label": data.Int(0)},
+			})
+
+			Convey("Then the dimension of the assembled features should be recorded", func() {
+				So(s.expectedDim, ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestHandleNulls(t *testing.T) {
+	Convey("Given a map having null fields", t, func() {
+		v := data.Map{
+			"a": data.Int(1),
+			"b": data.Null{},
+			"c": data.Array{data.Map{"d": data.Null{}}, data.Null{}},
+		}
+
+		Convey("When handle nulls in none mode", func() {
+			res, err := handleNulls(nullHandlingNone, v)
+			Convey("Then the value should not be changed", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, v)
+			})
+		})
+
+		Convey("When handle nulls in skip mode", func() {
+			res, err := handleNulls(nullHandlingSkip, v)
+			Convey("Then null fields of maps should be removed", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Map{
+					"a": data.Int(1),
+					"c": data.Array{data.Map{}, data.Null{}},
+				})
+			})
+			Convey("Then the original value should not be modified", func() {
+				So(v, ShouldContainKey, "b")
+			})
+		})
+
+		Convey("When handle nulls in error mode", func() {
+			_, err := handleNulls(nullHandlingError, v)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an invalid null_handling", t, func() {
+		Convey("Then it should be rejected", func() {
+			So(validateNullHandling("ignore"), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,46 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+// feedback retains the last prediction of a state so that it can be given to
+// the next prediction as a feature. Only one prediction is retained per
+// state, so a RoutedState retains one per sub-model and the retained value is
+// released together with the sub-model.
+type feedback struct {
+	m    sync.Mutex
+	key  string
+	last data.Value
+}
+
+func newFeedback(key string) *feedback {
+	return &feedback{
+		key:  key,
+		last: data.Null{},
+	}
+}
+
+// apply returns a copy of dt having the last prediction under the feedback
+// key. dt must be a `data.Map`. The value is null before the first
+// prediction.
+func (f *feedback) apply(dt data.Value) (data.Value, error) {
+	m, err := data.AsMap(dt)
+	if err != nil {
+		return nil, fmt.Errorf("data must be a map when feedback is enabled: %v", err)
+	}
+	m = m.Copy().(data.Map)
+
+	f.m.Lock()
+	defer f.m.Unlock()
+	m[f.key] = f.last.Copy()
+	return m, nil
+}
+
+func (f *feedback) record(v data.Value) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.last = v.Copy()
+}
@@ -0,0 +1,58 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateFeedback(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with feedback", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "EchoClass",
+		}
+		params := data.Map{
+			"feedback":     data.True,
+			"feedback_key": data.String("prev"),
+		}
+		mp, err := extractMLParams(params)
+		So(err, ShouldBeNil)
+		s, err := New(baseParams, mp, params)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When predict for the first time", func() {
+			v, err := s.Predict(ctx, data.Map{"x": data.Int(1)})
+			So(err, ShouldBeNil)
+			Convey("Then the feedback value should be null", func() {
+				So(v, ShouldResemble, data.Map{
+					"x":    data.Int(1),
+					"prev": data.Null{},
+				})
+			})
+
+			Convey("Then the next prediction should be given the last one", func() {
+				v2, err := s.Predict(ctx, data.Map{"x": data.Int(2)})
+				So(err, ShouldBeNil)
+				m, err := data.AsMap(v2)
+				So(err, ShouldBeNil)
+				So(m["prev"], ShouldResemble, v)
+			})
+		})
+
+		Convey("When predict with data not being a map", func() {
+			_, err := s.Predict(ctx, data.Int(1))
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
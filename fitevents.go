@@ -0,0 +1,148 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+var (
+	lossPath     = data.MustCompilePath("loss")
+	accuracyPath = data.MustCompilePath("accuracy")
+)
+
+// fitEvents retains an event of each fit until it's taken by the fit events
+// stream. It has its own lock because fit is called while holding the read
+// lock of State.
+type fitEvents struct {
+	m       sync.Mutex
+	events  []data.Map
+	limit   int
+	dropped int64
+}
+
+func newFitEvents(limit int) *fitEvents {
+	return &fitEvents{limit: limit}
+}
+
+// add adds an event of a fit. The oldest event is dropped when the buffer is
+// full.
+func (f *fitEvents) add(metrics data.Value, batch int64, tuples int, elapsed time.Duration,
+	earlyStopped bool) {
+	e := data.Map{
+		"early_stopped": data.Bool(earlyStopped),
+		"batch":         data.Int(batch),
+		"tuples":        data.Int(tuples),
+		"duration":      data.Float(elapsed.Seconds()),
+		"timestamp":     data.Timestamp(time.Now()),
+		"loss":          data.Null{},
+		"accuracy":      data.Null{},
+		"metrics":       metrics.Copy(),
+	}
+	if m, err := data.AsMap(metrics); err == nil {
+		if v, err := m.Get(lossPath); err == nil {
+			e["loss"] = v.Copy()
+		}
+		if v, err := m.Get(accuracyPath); err == nil {
+			e["accuracy"] = v.Copy()
+		}
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+	if len(f.events) >= f.limit {
+		f.events = f.events[1:]
+		f.dropped++
+	}
+	f.events = append(f.events, e)
+}
+
+// take returns retained events and clears the buffer.
+func (f *fitEvents) take() []data.Map {
+	f.m.Lock()
+	defer f.m.Unlock()
+	es := f.events
+	f.events = nil
+	return es
+}
+
+func (f *fitEvents) droppedEvents() int64 {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.dropped
+}
+
+// fitEventsStream is a UDSF emitting a tuple per fit of a state.
+type fitEventsStream struct {
+	stateName string
+}
+
+// CreateFitEventsStream creates a UDSF which emits a tuple for each fit call
+// retained by the state since the last tuple arrived from the input stream.
+// The state must be created with fit_event_buffer. Unlike
+// pymlstate_metrics_stream, no fit is missed as long as the buffer doesn't
+// overflow, so a stream created with this UDSF can be queried with BQL to
+// build training dashboards. The input stream is typically a ticker and its
+// tuples are only used as triggers. An emitted tuple has the following
+// fields:
+//
+//	state: the name of the state
+//	batch: the index of the batch, starting from 1
+//	tuples: the number of tuples in the batch
+//	duration: the time spent in fit in seconds
+//	timestamp: when the fit finished
+//	loss: "loss" of the result of fit, or null
+//	accuracy: "accuracy" of the result of fit, or null
+//	metrics: the result of fit
+//	early_stopped: true when training was stopped by early stopping after
+//	               this fit
+//
+// Events are consumed by the stream, so only one stream should be created
+// for a state. It's registered as pymlstate_fit_events(stream, state_name).
+func CreateFitEventsStream(ctx *core.Context, decl udf.UDSFDeclarer, stream string,
+	stateName string) (udf.UDSF, error) {
+	if err := decl.Input(stream, nil); err != nil {
+		return nil, err
+	}
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	if s.events == nil {
+		return nil, fmt.Errorf("state '%v' doesn't have fit_event_buffer", stateName)
+	}
+	return &fitEventsStream{stateName: stateName}, nil
+}
+
+func (f *fitEventsStream) Process(ctx *core.Context, t *core.Tuple, w core.Writer) error {
+	s, err := lookupState(ctx, f.stateName)
+	if err != nil {
+		return err
+	}
+	s.rwm.RLock()
+	events := s.events
+	s.rwm.RUnlock()
+	if events == nil {
+		return nil
+	}
+
+	now := time.Now()
+	for _, e := range events.take() {
+		e["state"] = data.String(f.stateName)
+		if err := w.Write(ctx, &core.Tuple{
+			Data:          e,
+			Timestamp:     t.Timestamp,
+			ProcTimestamp: now,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fitEventsStream) Terminate(ctx *core.Context) error {
+	return nil
+}
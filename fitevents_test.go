@@ -0,0 +1,64 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestFitEventsStream(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a fit events stream of a pymlstate", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "MetricsClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:      1,
+			FitEventBuffer: 2,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("fit_events_test", "pymlstate", s), ShouldBeNil)
+		Reset(func() {
+			ctx.SharedStates.Remove("fit_events_test")
+			s.Terminate(ctx)
+		})
+
+		fs := &fitEventsStream{stateName: "fit_events_test"}
+		var emitted []*core.Tuple
+		w := core.WriterFunc(func(ctx *core.Context, t *core.Tuple) error {
+			emitted = append(emitted, t)
+			return nil
+		})
+		tick := &core.Tuple{Data: data.Map{}, Timestamp: time.Now()}
+
+		Convey("When it's pulsed after fits", func() {
+			for i := 0; i < 3; i++ {
+				_, err := s.Fit(ctx, []data.Value{data.Int(1)})
+				So(err, ShouldBeNil)
+			}
+			So(fs.Process(ctx, tick, w), ShouldBeNil)
+
+			Convey("Then it should emit a tuple per retained fit", func() {
+				So(len(emitted), ShouldEqual, 2)
+				d := emitted[0].Data
+				So(d["state"], ShouldEqual, data.String("fit_events_test"))
+				So(d["batch"], ShouldEqual, data.Int(2))
+				So(d["loss"], ShouldEqual, data.Float(0.5))
+				So(d["accuracy"], ShouldEqual, data.Float(0.8))
+				So(emitted[1].Data["batch"], ShouldEqual, data.Int(3))
+				So(s.Status()["dropped_fit_events"], ShouldEqual, data.Int(1))
+			})
+
+			Convey("Then it shouldn't emit the same events again", func() {
+				So(fs.Process(ctx, tick, w), ShouldBeNil)
+				So(len(emitted), ShouldEqual, 2)
+			})
+		})
+	})
+}
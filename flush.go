@@ -0,0 +1,70 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"time"
+)
+
+// scheduleFlush schedules a flush of the bucket after max_flush_interval. It's
+// called when the first tuple of a bucket is written. The caller must hold
+// the write lock.
+func (s *State) scheduleFlush(ctx *core.Context) {
+	s.bucketSince = time.Now()
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+	}
+	s.flushTimer = time.AfterFunc(s.params.MaxFlushInterval, func() {
+		s.flushExpired(ctx)
+	})
+}
+
+// rescheduleFlush schedules a flush of tuples left in the bucket, e.g. by
+// Resume or Update, at max_flush_interval after bucketSince, when the oldest
+// of them was written. The caller must hold the write lock.
+func (s *State) rescheduleFlush(ctx *core.Context) {
+	if s.params.MaxFlushInterval <= 0 || len(s.bucket) == 0 {
+		return
+	}
+	d := s.params.MaxFlushInterval - time.Since(s.bucketSince)
+	if d < 0 {
+		d = 0
+	}
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+	}
+	s.flushTimer = time.AfterFunc(d, func() {
+		s.flushExpired(ctx)
+	})
+}
+
+// flushExpired trains the model with tuples in the bucket when the bucket has
+// been pending for max_flush_interval. With fit_on_write = false, all tuples in
+// the bucket are trained at once as pymlstate_flush does. A bucket held while
+// paused isn't flushed, and it's rescheduled by Resume.
+func (s *State) flushExpired(ctx *core.Context) {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if s.flushTimer == nil || s.checkTermination() != nil {
+		return
+	}
+	if s.paused || len(s.bucket) == 0 {
+		return
+	}
+	if time.Since(s.bucketSince) < s.params.MaxFlushInterval {
+		// The bucket was filled and a new one was started after the flush
+		// was scheduled.
+		return
+	}
+
+	_, err := s.fit(ctx, s.bucket)
+	size := len(s.bucket)
+	if err == nil {
+		s.recordFeatureDim(ctx, s.bucket)
+	}
+	s.bucket = s.bucket[:0]
+	s.timedFlushes++
+	if err != nil {
+		ctx.ErrLog(err).WithField("bucket_size", size).
+			Error("pymlstate's training of a bucket pending for max_flush_interval failed")
+	}
+}
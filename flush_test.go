@@ -0,0 +1,149 @@
+package pymlstate
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestPyMLStateMaxFlushInterval(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with max_flush_interval", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:        10,
+			MaxFlushInterval: 10 * time.Millisecond,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When write fewer tuples than batch_train_size", func() {
+			for i := 0; i < 3; i++ {
+				t := &core.Tuple{Data: data.Map{"data": data.Int(i)}}
+				So(s.Write(ctx, t), ShouldBeNil)
+			}
+			So(s.Status()["bucket_size"], ShouldEqual, data.Int(3))
+
+			Convey("Then the bucket should be flushed after the interval", func() {
+				deadline := time.Now().Add(time.Second)
+				for s.Status()["timed_flushes"] == data.Int(0) && time.Now().Before(deadline) {
+					time.Sleep(5 * time.Millisecond)
+				}
+				st := s.Status()
+				So(st["timed_flushes"], ShouldEqual, data.Int(1))
+				So(st["bucket_size"], ShouldEqual, data.Int(0))
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When resume it after writing tuples while paused", func() {
+			So(s.Pause(ctx), ShouldBeNil)
+			for i := 0; i < 3; i++ {
+				t := &core.Tuple{Data: data.Map{"data": data.Int(i)}}
+				So(s.Write(ctx, t), ShouldBeNil)
+			}
+			So(s.Resume(ctx), ShouldBeNil)
+
+			Convey("Then the remaining tuples should be flushed after the interval", func() {
+				deadline := time.Now().Add(time.Second)
+				for s.Status()["timed_flushes"] == data.Int(0) && time.Now().Before(deadline) {
+					time.Sleep(5 * time.Millisecond)
+				}
+				st := s.Status()
+				So(st["timed_flushes"], ShouldEqual, data.Int(1))
+				So(st["bucket_size"], ShouldEqual, data.Int(0))
+			})
+		})
+	})
+}
+
+func TestPyMLStateMaxFlushIntervalWithDeferredFit(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with max_flush_interval and fit_on_write = false", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:        2,
+			MaxFlushInterval: 10 * time.Millisecond,
+			DeferFit:         true,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("Then max_bucket_size should have the default value", func() {
+			So(s.params.MaxBucketSize, ShouldEqual, defaultDeferredMaxBucketSize)
+		})
+
+		Convey("When write tuples", func() {
+			for i := 0; i < 3; i++ {
+				t := &core.Tuple{Data: data.Map{"data": data.Int(i)}}
+				So(s.Write(ctx, t), ShouldBeNil)
+			}
+
+			Convey("Then the whole bucket should be flushed after the interval", func() {
+				deadline := time.Now().Add(time.Second)
+				for s.Status()["timed_flushes"] == data.Int(0) && time.Now().Before(deadline) {
+					time.Sleep(5 * time.Millisecond)
+				}
+				st := s.Status()
+				So(st["timed_flushes"], ShouldEqual, data.Int(1))
+				So(st["bucket_size"], ShouldEqual, data.Int(0))
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, data.Int(1))
+			})
+		})
+	})
+}
+
+func TestPyMLStateFlushOnTerminate(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate having tuples in its bucket", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		for _, flush := range []bool{true, false} {
+			flush := flush
+			Convey(fmt.Sprintf("When terminate it with flush_on_terminate = %v", flush), func() {
+				s, err := New(baseParams, &MLParams{
+					BatchSize:        10,
+					FlushOnTerminate: flush,
+				}, data.Map{})
+				So(err, ShouldBeNil)
+				t := &core.Tuple{Data: data.Map{"data": data.Int(1)}}
+				So(s.Write(ctx, t), ShouldBeNil)
+				So(s.Terminate(ctx), ShouldBeNil)
+
+				Convey("Then remaining tuples should be trained only when it's true", func() {
+					batches := data.Int(0)
+					if flush {
+						batches = data.Int(1)
+					}
+					So(s.stats.snapshot()["batches"], ShouldEqual, batches)
+				})
+			})
+		}
+	})
+}
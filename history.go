@@ -0,0 +1,132 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// defaultPredictionHistorySize is the default value of
+// prediction_history_size.
+const defaultPredictionHistorySize = 100
+
+// predictionHistory is a ring buffer keeping recent predictions recorded by
+// pymlstate_predict_record.
+type predictionHistory struct {
+	m       sync.Mutex
+	entries []data.Map
+	next    int
+	full    bool
+}
+
+func newPredictionHistory(size int) *predictionHistory {
+	return &predictionHistory{
+		entries: make([]data.Map, size),
+	}
+}
+
+func (h *predictionHistory) add(e data.Map) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if len(h.entries) == 0 {
+		return
+	}
+	h.entries[h.next] = e
+	h.next++
+	if h.next == len(h.entries) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// list returns recorded entries from the oldest one.
+func (h *predictionHistory) list() data.Array {
+	h.m.Lock()
+	defer h.m.Unlock()
+	var res data.Array
+	if h.full {
+		res = make(data.Array, 0, len(h.entries))
+		for _, e := range h.entries[h.next:] {
+			res = append(res, e.Copy())
+		}
+	} else {
+		res = make(data.Array, 0, h.next)
+	}
+	for _, e := range h.entries[:h.next] {
+		res = append(res, e.Copy())
+	}
+	return res
+}
+
+// summarizeInput returns a short description of dt so that the history
+// doesn't keep large inputs.
+func summarizeInput(dt data.Value) data.Map {
+	m := data.Map{
+		"type": data.String(dt.Type().String()),
+	}
+	switch v := dt.(type) {
+	case data.Array:
+		m["length"] = data.Int(len(v))
+	case data.Map:
+		m["length"] = data.Int(len(v))
+	case data.Blob:
+		m["length"] = data.Int(len(v))
+	case data.String:
+		m["length"] = data.Int(len(v))
+	default:
+		m["value"] = dt
+	}
+	return m
+}
+
+// PredictRecord applies the model to dt and records the prediction with tag
+// to the prediction history of the state.
+func (s *State) PredictRecord(ctx *core.Context, dt data.Value, tag string) (data.Value, error) {
+	res, err := s.Predict(ctx, dt)
+	if err != nil {
+		return nil, err
+	}
+
+	s.rwm.RLock()
+	h := s.history
+	s.rwm.RUnlock()
+	h.add(data.Map{
+		"tag":           data.String(tag),
+		"input_summary": summarizeInput(dt),
+		"prediction":    res,
+		"timestamp":     data.Timestamp(time.Now()),
+	})
+	return res, nil
+}
+
+// PredictionHistory returns predictions recorded by PredictRecord from the
+// oldest one.
+func (s *State) PredictionHistory() data.Array {
+	s.rwm.RLock()
+	h := s.history
+	s.rwm.RUnlock()
+	return h.list()
+}
+
+// PredictRecord applies the model to the given data and records the result
+// to the prediction history with tag. It returns the prediction.
+func PredictRecord(ctx *core.Context, stateName string, dt data.Value, tag string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.PredictRecord(ctx, dt, tag)
+}
+
+// PredictionHistory returns predictions recorded by pymlstate_predict_record
+// as an array of maps having tag, input_summary, prediction, and timestamp.
+func PredictionHistory(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.PredictionHistory(), nil
+}
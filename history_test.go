@@ -0,0 +1,48 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPredictionHistory(t *testing.T) {
+	Convey("Given a prediction history with size 3", t, func() {
+		h := newPredictionHistory(3)
+		Convey("When add less entries than the size", func() {
+			h.add(data.Map{"tag": data.String("a")})
+			h.add(data.Map{"tag": data.String("b")})
+			Convey("Then all entries should be listed in order", func() {
+				So(h.list(), ShouldResemble, data.Array{
+					data.Map{"tag": data.String("a")},
+					data.Map{"tag": data.String("b")},
+				})
+			})
+		})
+
+		Convey("When add more entries than the size", func() {
+			for _, t := range []string{"a", "b", "c", "d", "e"} {
+				h.add(data.Map{"tag": data.String(t)})
+			}
+			Convey("Then only the latest entries should be listed in order", func() {
+				So(h.list(), ShouldResemble, data.Array{
+					data.Map{"tag": data.String("c")},
+					data.Map{"tag": data.String("d")},
+					data.Map{"tag": data.String("e")},
+				})
+			})
+		})
+	})
+}
+
+func TestPredictionHistorySizeDefault(t *testing.T) {
+	Convey("Given a state created without prediction_history_size", t, func() {
+		s := &State{}
+		So(s.setParams(&MLParams{BatchSize: 1}), ShouldBeNil)
+
+		Convey("Then the default size should be used", func() {
+			So(s.params.PredictionHistorySize, ShouldEqual, defaultPredictionHistorySize)
+			So(len(s.history.entries), ShouldEqual, defaultPredictionHistorySize)
+		})
+	})
+}
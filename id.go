@@ -0,0 +1,40 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// attachID returns a `data.Map` having the prediction res as "prediction"
+// and the value of the id field of dt as "id". The id is null when dt
+// doesn't have the field unless required is true. res is returned as it is
+// when path is nil, i.e. id_field isn't given.
+func attachID(path data.Path, required bool, dt, res data.Value) (data.Value, error) {
+	if path == nil {
+		return res, nil
+	}
+	var id data.Value = data.Null{}
+	if m, err := data.AsMap(dt); err == nil {
+		if v, err := m.Get(path); err == nil {
+			id = v
+		}
+	}
+	if required && id.Type() == data.TypeNull {
+		return nil, fmt.Errorf("the data doesn't have the id field")
+	}
+	return data.Map{
+		"id":         id,
+		"prediction": res,
+	}, nil
+}
+
+func (s *State) attachID(dt, res data.Value) (data.Value, error) {
+	s.rwm.RLock()
+	path, required := s.idPath, s.params.IDRequired
+	s.rwm.RUnlock()
+	return attachID(path, required, dt, res)
+}
+
+func (r *RoutedState) attachID(dt, res data.Value) (data.Value, error) {
+	return attachID(r.idPath, r.mlParams.IDRequired, dt, res)
+}
@@ -0,0 +1,78 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateIDField(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with id_field", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		mp := &MLParams{
+			BatchSize: 1,
+			IDField:   "request_id",
+		}
+
+		Convey("When predict data having the id", func() {
+			s, err := New(baseParams, mp, data.Map{})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("id_test", "pymlstate", s), ShouldBeNil)
+			Reset(func() {
+				ctx.SharedStates.Remove("id_test")
+				s.Terminate(ctx)
+			})
+			v, err := Predict(ctx, "id_test", data.Map{"request_id": data.String("r1")})
+
+			Convey("Then the id should be returned with the prediction", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Map{
+					"id":         data.String("r1"),
+					"prediction": data.String("predict called"),
+				})
+			})
+		})
+
+		Convey("When predict data without the id", func() {
+			s, err := New(baseParams, mp, data.Map{})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("id_test", "pymlstate", s), ShouldBeNil)
+			Reset(func() {
+				ctx.SharedStates.Remove("id_test")
+				s.Terminate(ctx)
+			})
+			v, err := Predict(ctx, "id_test", data.Map{})
+
+			Convey("Then the id should be null", func() {
+				So(err, ShouldBeNil)
+				m, err := data.AsMap(v)
+				So(err, ShouldBeNil)
+				So(m["id"], ShouldResemble, data.Null{})
+			})
+		})
+
+		Convey("When predict data without the id when it's required", func() {
+			mp.IDRequired = true
+			s, err := New(baseParams, mp, data.Map{})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("id_test", "pymlstate", s), ShouldBeNil)
+			Reset(func() {
+				ctx.SharedStates.Remove("id_test")
+				s.Terminate(ctx)
+			})
+			_, err = Predict(ctx, "id_test", data.Map{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// FeatureImportance returns the result of `feature_importances` method of the
+// model as a `data.Array`. When feature_order is configured, it returns a
+// `data.Map` whose keys are feature names instead.
+func (s *State) FeatureImportance(ctx *core.Context) (data.Value, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	v, err := s.callOptionalServing("feature importance", "feature_importances")
+	if err != nil {
+		return nil, err
+	}
+
+	arr, err := data.AsArray(v)
+	if err != nil {
+		return nil, fmt.Errorf("feature_importances must return an array: %v", err)
+	}
+	if len(s.params.FeatureOrder) == 0 {
+		return arr, nil
+	}
+	if len(arr) != len(s.params.FeatureOrder) {
+		return nil, fmt.Errorf("feature_importances returned %v values but feature_order has %v features",
+			len(arr), len(s.params.FeatureOrder))
+	}
+	m := make(data.Map, len(arr))
+	for i, name := range s.params.FeatureOrder {
+		m[name] = arr[i]
+	}
+	return m, nil
+}
+
+// FeatureImportance returns the feature importance of the model. The Python
+// class must define `feature_importances` method.
+func FeatureImportance(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.FeatureImportance(ctx)
+}
+
+// Explain returns an attribution of each input feature computed by `explain`
+// method of the model, or `saliency` method when `explain` isn't defined. The
+// result is a `data.Array` having the same length as the input features.
+func (s *State) Explain(ctx *core.Context, dt data.Value) (data.Value, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	dt, err := s.convertInput(dt)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := s.callOptionalServing("explanation", "explain", dt)
+	if err != nil && isNotSupported(err) {
+		v, err = s.callOptionalServing("explanation", "saliency", dt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	arr, err := data.AsArray(v)
+	if err != nil {
+		return nil, fmt.Errorf("explain must return an array: %v", err)
+	}
+	if d := featureDim(dt); d >= 0 && d != len(arr) {
+		return nil, fmt.Errorf("explain returned %v values but the input has %v features",
+			len(arr), d)
+	}
+	return arr, nil
+}
+
+// Explain returns the attribution of each feature of the given data, e.g. a
+// saliency map of an image. The Python class must define `explain` or
+// `saliency` method.
+func Explain(ctx *core.Context, stateName string, dt data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Explain(ctx, dt)
+}
@@ -0,0 +1,99 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateFeatureImportance(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate having feature_importances", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When get feature importance", func() {
+			v, err := s.FeatureImportance(ctx)
+			Convey("Then it should be an array", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Array{data.Float(0.25), data.Float(0.75)})
+			})
+		})
+
+		Convey("When get feature importance with feature_order", func() {
+			So(s.setParams(&MLParams{
+				BatchSize:    1,
+				FeatureOrder: []string{"x", "y"},
+			}), ShouldBeNil)
+			v, err := s.FeatureImportance(ctx)
+			Convey("Then it should be keyed by feature names", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Map{
+					"x": data.Float(0.25),
+					"y": data.Float(0.75),
+				})
+			})
+		})
+	})
+
+	Convey("Given a pymlstate having saliency", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When explain an input", func() {
+			v, err := s.Explain(ctx, data.Array{data.Int(-1), data.Int(2)})
+			Convey("Then saliency should be returned instead of explain", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Array{data.Int(1), data.Int(2)})
+			})
+		})
+	})
+
+	Convey("Given a pymlstate not having feature_importances", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "MinimalClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When get feature importance", func() {
+			_, err := s.FeatureImportance(ctx)
+			Convey("Then it should fail as not supported", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "not supported")
+			})
+		})
+
+		Convey("When explain an input", func() {
+			_, err := s.Explain(ctx, data.Array{data.Int(1)})
+			Convey("Then it should fail as not supported", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "not supported")
+			})
+		})
+	})
+}
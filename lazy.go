@@ -0,0 +1,109 @@
+package pymlstate
+
+import (
+	"errors"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// errTerminated is returned when a state terminated before its Python
+// instance was created is used.
+var errTerminated = errors.New("the state has already been terminated")
+
+// py returns the Python instance of the state. When lazy_init is true, the
+// instance is created by the first call. A failed creation is retried by the
+// next call.
+func (s *State) py() (*pystate.Base, error) {
+	s.initM.Lock()
+	defer s.initM.Unlock()
+	if s.terminated {
+		return nil, errTerminated
+	}
+	if s.base != nil {
+		return s.base, nil
+	}
+	if s.lazyBaseParams == nil {
+		return nil, errTerminated
+	}
+
+	b, err := newBase(s.lazyBaseParams, s.lazyParams)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSparseSupport(b, s.params.SparseThreshold); err != nil {
+		b.Terminate(nil)
+		return nil, err
+	}
+	if err := checkOutputs(s.lazyBaseParams, s.params.Outputs); err != nil {
+		b.Terminate(nil)
+		return nil, err
+	}
+	if err := s.warmup(b); err != nil {
+		b.Terminate(nil)
+		return nil, err
+	}
+	s.base = b
+	s.lazyBaseParams = nil
+	s.lazyParams = nil
+	return b, nil
+}
+
+// initialized returns true when the Python instance has been created.
+func (s *State) initialized() bool {
+	s.initM.Lock()
+	defer s.initM.Unlock()
+	return s.base != nil
+}
+
+// newBase creates a Python instance. When the module doesn't have the class,
+// the returned error lists classes the module defines.
+func newBase(baseParams *pystate.BaseParams, params data.Map) (*pystate.Base, error) {
+	b, err := pystate.NewBase(baseParams, params)
+	if err != nil {
+		if derr := diagnoseMissingClass(baseParams); derr != nil {
+			return nil, derr
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *State) checkTermination() error {
+	b, err := s.py()
+	if err != nil {
+		return err
+	}
+	return b.CheckTermination()
+}
+
+// call calls the method of the Python instance. The method may update the
+// model, so it doesn't run concurrently with other calls. It fails while a
+// call which timed out is still running instead of waiting for it.
+func (s *State) call(name string, args ...data.Value) (data.Value, error) {
+	b, err := s.py()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.timeouts.checkOutstanding(); err != nil {
+		return nil, err
+	}
+	s.modelM.Lock()
+	defer s.modelM.Unlock()
+	return b.Call(name, args...)
+}
+
+// callReadOnly calls a method which doesn't update the model, such as
+// predict. It can run concurrently with other read-only calls but not with
+// call. It fails while a call which timed out is still running as call does.
+func (s *State) callReadOnly(name string, args ...data.Value) (data.Value, error) {
+	b, err := s.py()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.timeouts.checkOutstanding(); err != nil {
+		return nil, err
+	}
+	s.modelM.RLock()
+	defer s.modelM.RUnlock()
+	return b.Call(name, args...)
+}
@@ -0,0 +1,73 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateLazyInit(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with lazy_init", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1, LazyInit: true}, data.Map{})
+		So(err, ShouldBeNil)
+
+		Convey("When it isn't used yet", func() {
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			Convey("Then the Python instance should not be created", func() {
+				So(s.Status()["initialized"], ShouldEqual, data.False)
+			})
+		})
+
+		Convey("When predict for the first time", func() {
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			v, err := s.Predict(ctx, data.Int(1))
+			Convey("Then the Python instance should be created", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, "predict called")
+				So(s.Status()["initialized"], ShouldEqual, data.True)
+			})
+		})
+
+		Convey("When terminate it without using", func() {
+			So(s.Terminate(ctx), ShouldBeNil)
+			Convey("Then it should not be usable", func() {
+				_, err := s.Predict(ctx, data.Int(1))
+				So(err, ShouldNotBeNil)
+				So(s.Status()["initialized"], ShouldEqual, data.False)
+			})
+		})
+	})
+
+	Convey("Given a pymlstate with lazy_init and a missing class", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "NoSuchClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1, LazyInit: true}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When predict for the first time", func() {
+			_, err := s.Predict(ctx, data.Int(1))
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,58 @@
+package pymlstate
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// MaxStatesEnv is the name of the environment variable which sets the initial
+// value of the maximum number of States which can coexist in a process.
+const MaxStatesEnv = "PYMLSTATE_MAX_STATES"
+
+var (
+	stateCountMutex sync.Mutex
+	stateCount      int
+	maxStates       = maxStatesFromEnv()
+)
+
+func maxStatesFromEnv() int {
+	n, err := strconv.Atoi(os.Getenv(MaxStatesEnv))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// SetMaxStates sets the maximum number of States which can coexist in a
+// process. Creating a State fails once the limit is reached until another
+// State is terminated. 0 means no limit. Each sub-model of a RoutedState is
+// counted as a State. The initial value is taken from PYMLSTATE_MAX_STATES.
+func SetMaxStates(n int) {
+	stateCountMutex.Lock()
+	defer stateCountMutex.Unlock()
+	if n < 0 {
+		n = 0
+	}
+	maxStates = n
+}
+
+func acquireStateSlot() error {
+	stateCountMutex.Lock()
+	defer stateCountMutex.Unlock()
+	if maxStates > 0 && stateCount >= maxStates {
+		return fmt.Errorf("cannot create a pymlstate: the number of states reached the limit (%v)",
+			maxStates)
+	}
+	stateCount++
+	return nil
+}
+
+func releaseStateSlot() {
+	stateCountMutex.Lock()
+	defer stateCountMutex.Unlock()
+	if stateCount > 0 {
+		stateCount--
+	}
+}
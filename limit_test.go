@@ -0,0 +1,45 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestMaxStates(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given the maximum number of states set to 1", t, func() {
+		SetMaxStates(1)
+		Reset(func() {
+			SetMaxStates(0)
+		})
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+
+		Convey("When create a state", func() {
+			s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+
+			Convey("Then creating another state should fail", func() {
+				_, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then another state can be created after termination", func() {
+				So(s.Terminate(ctx), ShouldBeNil)
+				s2, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+				So(err, ShouldBeNil)
+				So(s2.Terminate(ctx), ShouldBeNil)
+			})
+		})
+	})
+}
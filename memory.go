@@ -0,0 +1,35 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// ReleaseMemory calls `release_memory` method of the model, or `empty_cache`
+// method when `release_memory` isn't defined, so that the model can free
+// memory cached by its framework, e.g. GPU memory, without being destroyed.
+// It returns the result of the method. The state is locked exclusively so
+// that memory isn't released during fit or predict.
+func (s *State) ReleaseMemory(ctx *core.Context) (data.Value, error) {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.timeouts.checkOutstanding(); err != nil {
+		return nil, err
+	}
+	v, err := s.callOptional("memory release", "release_memory")
+	if err != nil && isNotSupported(err) {
+		v, err = s.callOptional("memory release", "empty_cache")
+	}
+	return v, err
+}
+
+// ReleaseMemory makes the model free memory cached by its framework. The
+// Python class must define `release_memory` or `empty_cache` method.
+func ReleaseMemory(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ReleaseMemory(ctx)
+}
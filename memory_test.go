@@ -0,0 +1,49 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateReleaseMemory(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given pymlstates", t, func() {
+		newState := func(className string) *State {
+			baseParams := &pystate.BaseParams{
+				ModulePath: "./",
+				ModuleName: "_test_pymlstate",
+				ClassName:  className,
+			}
+			s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+			So(err, ShouldBeNil)
+			return s
+		}
+
+		Convey("When release memory of a model having empty_cache", func() {
+			s := newState("TestClass")
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			v, err := s.ReleaseMemory(ctx)
+			Convey("Then empty_cache should be called", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.String("cache released"))
+			})
+		})
+
+		Convey("When release memory of a model having neither method", func() {
+			s := newState("MinimalClass")
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			_, err := s.ReleaseMemory(ctx)
+			Convey("Then it should fail as not supported", func() {
+				So(isNotSupported(err), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,236 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+// fitStats keeps the result of the latest fit and cumulative statistics of
+// fits. It has its own lock because fit is called while holding the read lock
+// of State.
+type fitStats struct {
+	m        sync.Mutex
+	batches  int64
+	failures int64
+	tuples   int64
+	elapsed  time.Duration
+	last     data.Value
+	lastAt   time.Time
+
+	// extracted has metrics extracted by the metrics parameter from the
+	// result of the latest fit.
+	extracted data.Map
+}
+
+// record records res of a fit trained with the given number of tuples in
+// elapsed time, and returns the number of fitted batches including it.
+func (f *fitStats) record(res data.Value, tuples int, elapsed time.Duration) int64 {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.batches++
+	f.tuples += int64(tuples)
+	f.elapsed += elapsed
+	f.last = res.Copy()
+	f.lastAt = time.Now()
+	return f.batches
+}
+
+// recordFailure records a failed fit which took elapsed time.
+func (f *fitStats) recordFailure(elapsed time.Duration) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.failures++
+	f.elapsed += elapsed
+}
+
+// status returns cumulative statistics of fits and the result of the latest
+// fit. fit_time is the total time spent in fit in seconds including failed
+// ones.
+func (f *fitStats) status() data.Map {
+	f.m.Lock()
+	defer f.m.Unlock()
+	m := data.Map{
+		"fit_calls":        data.Int(f.batches),
+		"failed_fits":      data.Int(f.failures),
+		"trained_tuples":   data.Int(f.tuples),
+		"fit_time":         data.Float(f.elapsed.Seconds()),
+		"last_fit_metrics": data.Null{},
+		"last_fit_at":      data.Null{},
+	}
+	if f.last != nil {
+		m["last_fit_metrics"] = f.last.Copy()
+		m["last_fit_at"] = data.Timestamp(f.lastAt)
+	}
+	if f.extracted != nil {
+		m["fit_metrics"] = f.extracted.Copy()
+	}
+	return m
+}
+
+// recordExtracted records metrics extracted from the result of the latest
+// fit.
+func (f *fitStats) recordExtracted(m data.Map) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.extracted = m
+}
+
+// snapshot returns the number of fitted batches, the result of the latest
+// fit, and when it was done. The result is null before the first fit.
+func (f *fitStats) snapshot() data.Map {
+	f.m.Lock()
+	defer f.m.Unlock()
+	m := data.Map{
+		"batches":     data.Int(f.batches),
+		"metrics":     data.Null{},
+		"last_fit_at": data.Null{},
+	}
+	if f.last != nil {
+		m["metrics"] = f.last.Copy()
+		m["last_fit_at"] = data.Timestamp(f.lastAt)
+	}
+	return m
+}
+
+// namedMetrics converts res into a `data.Map` keyed by names when res is an
+// array having as many elements as names. Otherwise, res is returned as it
+// is.
+func namedMetrics(names []string, res data.Value) data.Value {
+	if len(names) == 0 {
+		return res
+	}
+	arr, err := data.AsArray(res)
+	if err != nil || len(arr) != len(names) {
+		return res
+	}
+	m := make(data.Map, len(names))
+	for i, n := range names {
+		m[n] = arr[i]
+	}
+	return m
+}
+
+// extractMetrics extracts metrics given by the metrics parameter from a result
+// of fit, and records and logs them.
+func (s *State) extractMetrics(ctx *core.Context, metrics data.Value) {
+	m, _ := data.AsMap(metrics)
+	extracted := make(data.Map, len(s.metricPaths))
+	for i, p := range s.metricPaths {
+		var v data.Value = data.Null{}
+		if m != nil {
+			if x, err := m.Get(p); err == nil {
+				v = x
+			}
+		}
+		extracted[s.params.Metrics[i]] = v
+	}
+	s.stats.recordExtracted(extracted)
+
+	l := ctx.Log()
+	for k, v := range extracted {
+		l = l.WithField(k, v)
+	}
+	l.Debug("pymlstate's fit metrics")
+}
+
+const (
+	invalidMetricsWarn  = "warn"
+	invalidMetricsError = "error"
+)
+
+func validateOnInvalidMetrics(policy string) error {
+	switch policy {
+	case invalidMetricsWarn, invalidMetricsError:
+		return nil
+	default:
+		return fmt.Errorf("on_invalid_metrics must be '%v' or '%v': %v",
+			invalidMetricsWarn, invalidMetricsError, policy)
+	}
+}
+
+// invalidMetric returns the name and the value of the first non-numeric
+// metric in metrics. Null is regarded as a missing metric and is allowed. It
+// returns false when metrics isn't a map, because such results are opaque
+// messages rather than metrics.
+func invalidMetric(metrics data.Value) (string, data.Value, bool) {
+	m, err := data.AsMap(metrics)
+	if err != nil {
+		return "", nil, false
+	}
+	for k, v := range m {
+		switch v.Type() {
+		case data.TypeInt, data.TypeFloat, data.TypeNull:
+		default:
+			return k, v, true
+		}
+	}
+	return "", nil, false
+}
+
+// checkMetrics handles a non-numeric metric in metrics according to
+// on_invalid_metrics.
+func (s *State) checkMetrics(ctx *core.Context, metrics data.Value) error {
+	name, v, found := invalidMetric(metrics)
+	if !found {
+		return nil
+	}
+	if s.params.OnInvalidMetrics == invalidMetricsError {
+		return fmt.Errorf("fit returned a non-numeric metric '%v' of type %v", name, v.Type())
+	}
+	ctx.Log().WithField("metric", name).WithField("type", v.Type().String()).
+		Warn("pymlstate's fit returned a non-numeric metric")
+	return nil
+}
+
+// metricsStream is a UDSF emitting the latest fit metrics of a state every
+// time it receives a tuple.
+type metricsStream struct {
+	stateName string
+}
+
+// CreateMetricsStream creates a UDSF which emits the latest fit metrics of
+// the state each time a tuple arrives from the input stream, so that training
+// curves can be written by sinks. The input stream is typically a ticker and
+// its tuples are only used as triggers. An emitted tuple has the following
+// fields:
+//
+//	state: the name of the state
+//	batches: the number of batches the model has been trained with
+//	metrics: the result of the latest fit, or null before the first fit
+//	last_fit_at: when the latest fit was done, or null before the first fit
+//
+// It's registered as pymlstate_metrics_stream(stream, state_name).
+func CreateMetricsStream(ctx *core.Context, decl udf.UDSFDeclarer, stream string,
+	stateName string) (udf.UDSF, error) {
+	if err := decl.Input(stream, nil); err != nil {
+		return nil, err
+	}
+	if _, err := lookupState(ctx, stateName); err != nil {
+		return nil, err
+	}
+	return &metricsStream{stateName: stateName}, nil
+}
+
+func (m *metricsStream) Process(ctx *core.Context, t *core.Tuple, w core.Writer) error {
+	s, err := lookupState(ctx, m.stateName)
+	if err != nil {
+		return err
+	}
+	d := s.stats.snapshot()
+	d["state"] = data.String(m.stateName)
+
+	now := time.Now()
+	return w.Write(ctx, &core.Tuple{
+		Data:          d,
+		Timestamp:     t.Timestamp,
+		ProcTimestamp: now,
+	})
+}
+
+func (m *metricsStream) Terminate(ctx *core.Context) error {
+	return nil
+}
@@ -0,0 +1,248 @@
+package pymlstate
+
+import (
+	"bytes"
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestMetricsStream(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a metrics stream of a pymlstate", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "MetricsClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("metrics_stream_test", "pymlstate", s), ShouldBeNil)
+		Reset(func() {
+			ctx.SharedStates.Remove("metrics_stream_test")
+			s.Terminate(ctx)
+		})
+
+		ms := &metricsStream{stateName: "metrics_stream_test"}
+		var emitted []*core.Tuple
+		w := core.WriterFunc(func(ctx *core.Context, t *core.Tuple) error {
+			emitted = append(emitted, t)
+			return nil
+		})
+		tick := &core.Tuple{Data: data.Map{}, Timestamp: time.Now()}
+
+		Convey("When it's pulsed before fit", func() {
+			So(ms.Process(ctx, tick, w), ShouldBeNil)
+			Convey("Then it should emit empty metrics", func() {
+				So(len(emitted), ShouldEqual, 1)
+				So(emitted[0].Data["batches"], ShouldEqual, data.Int(0))
+				So(emitted[0].Data["metrics"], ShouldResemble, data.Null{})
+			})
+		})
+
+		Convey("When it's pulsed after fit", func() {
+			_, err := s.Fit(ctx, []data.Value{data.Int(1), data.Int(2)})
+			So(err, ShouldBeNil)
+			So(ms.Process(ctx, tick, w), ShouldBeNil)
+			Convey("Then it should emit the latest metrics", func() {
+				So(len(emitted), ShouldEqual, 1)
+				d := emitted[0].Data
+				So(d["state"], ShouldEqual, data.String("metrics_stream_test"))
+				So(d["batches"], ShouldEqual, data.Int(1))
+				m, err := data.AsMap(d["metrics"])
+				So(err, ShouldBeNil)
+				So(m["count"], ShouldEqual, data.Int(2))
+				So(d["last_fit_at"].Type(), ShouldEqual, data.TypeTimestamp)
+				So(emitted[0].Timestamp, ShouldResemble, tick.Timestamp)
+			})
+		})
+
+		Convey("When fit twice", func() {
+			for i := 0; i < 2; i++ {
+				_, err := s.Fit(ctx, []data.Value{data.Int(1), data.Int(2)})
+				So(err, ShouldBeNil)
+			}
+			Convey("Then Status should report cumulative statistics", func() {
+				st := s.Status()
+				So(st["fit_calls"], ShouldEqual, data.Int(2))
+				So(st["failed_fits"], ShouldEqual, data.Int(0))
+				So(st["trained_tuples"], ShouldEqual, data.Int(4))
+				ft, err := data.AsFloat(st["fit_time"])
+				So(err, ShouldBeNil)
+				So(ft, ShouldBeGreaterThan, 0)
+				m, err := data.AsMap(st["last_fit_metrics"])
+				So(err, ShouldBeNil)
+				So(m["loss"], ShouldEqual, data.Float(0.5))
+			})
+		})
+	})
+}
+
+func TestFitMetricsPositions(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given pymlstates with metrics_positions", t, func() {
+		newState := func(className string) *State {
+			baseParams := &pystate.BaseParams{
+				ModulePath: "./",
+				ModuleName: "_test_pymlstate",
+				ClassName:  className,
+			}
+			s, err := New(baseParams, &MLParams{
+				BatchSize:        1,
+				MetricsPositions: []string{"loss", "accuracy"},
+			}, data.Map{})
+			So(err, ShouldBeNil)
+			return s
+		}
+
+		Convey("When fit returns a tuple", func() {
+			s := newState("TupleMetricsClass")
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			_, err := s.Fit(ctx, []data.Value{data.Int(1)})
+			So(err, ShouldBeNil)
+			Convey("Then metrics should be keyed by the names", func() {
+				So(s.stats.snapshot()["metrics"], ShouldResemble, data.Map{
+					"loss":     data.Float(0.5),
+					"accuracy": data.Float(0.8),
+				})
+			})
+		})
+
+		Convey("When fit returns a dict", func() {
+			s := newState("MetricsClass")
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			_, err := s.Fit(ctx, []data.Value{data.Int(1)})
+			So(err, ShouldBeNil)
+			Convey("Then metrics should be recorded as they are", func() {
+				So(s.stats.snapshot()["metrics"], ShouldResemble, data.Map{
+					"loss":     data.Float(0.5),
+					"accuracy": data.Float(0.8),
+					"count":    data.Int(1),
+				})
+			})
+		})
+	})
+}
+
+func TestPyMLStateInvalidMetrics(t *testing.T) {
+	Convey("Given a pymlstate whose fit returns a non-numeric metric", t, func() {
+		buf := bytes.NewBuffer(nil)
+		logger := logrus.New()
+		logger.Out = buf
+		ctx := core.NewContext(&core.ContextConfig{Logger: logger})
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "ValidationClass",
+		}
+		// ValidationClass returns the first sample as val_accuracy.
+		bucket := []data.Value{data.String("bad")}
+
+		Convey("When fit with the default policy", func() {
+			s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			_, err = s.Fit(ctx, bucket)
+
+			Convey("Then it should succeed with a warning naming the type", func() {
+				So(err, ShouldBeNil)
+				So(buf.String(), ShouldContainSubstring, "non-numeric metric")
+				So(buf.String(), ShouldContainSubstring, "val_accuracy")
+				So(buf.String(), ShouldContainSubstring, "string")
+			})
+		})
+
+		Convey("When fit with on_invalid_metrics = error", func() {
+			s, err := New(baseParams, &MLParams{
+				BatchSize:        1,
+				OnInvalidMetrics: invalidMetricsError,
+			}, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			_, err = s.Fit(ctx, bucket)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "val_accuracy")
+			})
+		})
+
+		Convey("When fit with numeric metrics", func() {
+			s, err := New(baseParams, &MLParams{
+				BatchSize:        1,
+				OnInvalidMetrics: invalidMetricsError,
+			}, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			_, err = s.Fit(ctx, []data.Value{data.Float(0.5)})
+
+			Convey("Then it should succeed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestFitMetricsExtraction(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with metrics", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "MetricsClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize: 1,
+			Metrics:   []string{"accuracy", "f1"},
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When fit is called", func() {
+			_, err := s.Fit(ctx, []data.Value{data.Int(1)})
+			So(err, ShouldBeNil)
+
+			Convey("Then Status should report the extracted metrics", func() {
+				So(s.Status()["fit_metrics"], ShouldResemble, data.Map{
+					"accuracy": data.Float(0.8),
+					"f1":       data.Null{},
+				})
+			})
+		})
+	})
+
+	Convey("Given an invalid metric path", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "MetricsClass",
+		}
+		_, err := New(baseParams, &MLParams{
+			BatchSize: 1,
+			Metrics:   []string{"a["},
+		}, data.Map{})
+
+		Convey("Then the state shouldn't be created", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
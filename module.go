@@ -0,0 +1,78 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/py.v0"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+// listClassesExpr is evaluated by Python to list names of classes defined in a
+// module. %q is replaced with the module name.
+const listClassesExpr = `[n for n, v in vars(__import__(%q, fromlist=['*'])).items() ` +
+	`if __import__('inspect').isclass(v)]`
+
+// diagnoseMissingClass returns an error describing that the module doesn't
+// have the class specified by bp, listing the classes the module defines so
+// that a typo can easily be fixed. It returns nil when the module has the
+// class or the module itself cannot be loaded, so that the original error is
+// reported in those cases.
+func diagnoseMissingClass(bp *pystate.BaseParams) error {
+	mdl, err := py.LoadModule(bp.ModuleName)
+	if err != nil {
+		return nil
+	}
+	defer mdl.DecRef()
+
+	cls, err := mdl.GetClass(bp.ClassName)
+	if err == nil {
+		cls.DecRef()
+		return nil
+	}
+
+	classes, err := listClasses(bp.ModuleName)
+	if err != nil {
+		return fmt.Errorf("module '%v' doesn't have class '%v'", bp.ModuleName,
+			bp.ClassName)
+	}
+	return fmt.Errorf("module '%v' doesn't have class '%v', defined classes are %v",
+		bp.ModuleName, bp.ClassName, classes)
+}
+
+// listClasses returns sorted names of classes defined in the module.
+func listClasses(moduleName string) ([]string, error) {
+	v, err := evalPython(fmt.Sprintf(listClassesExpr, moduleName))
+	if err != nil {
+		return nil, err
+	}
+	arr, err := data.AsArray(v)
+	if err != nil {
+		return nil, err
+	}
+	classes := make([]string, len(arr))
+	for i, c := range arr {
+		if classes[i], err = data.AsString(c); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(classes)
+	return classes, nil
+}
+
+// evalPython evaluates the Python expression and returns its value.
+func evalPython(expr string) (data.Value, error) {
+	var builtins py.ObjectModule
+	var err error
+	for _, n := range []string{"__builtin__", "builtins"} {
+		if builtins, err = py.LoadModule(n); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer builtins.DecRef()
+
+	return builtins.CallDirect("eval", []data.Value{data.String(expr)}, data.Map{})
+}
@@ -0,0 +1,57 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+// LifecycleObserver is notified of lifecycle events of states so that they
+// can be integrated with external event systems.
+type LifecycleObserver interface {
+	// OnCreate is called after StateCreator or RoutedStateCreator tries to
+	// create a state. err is nil when the state was successfully created.
+	// Because a UDS creator doesn't know the name of the state, name is
+	// "<module_name>.<class_name>" of the Python class.
+	OnCreate(name string, err error)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) OnCreate(name string, err error) {}
+
+var (
+	observerMutex sync.RWMutex
+	observer      LifecycleObserver = nopObserver{}
+)
+
+// SetLifecycleObserver registers the observer notified of lifecycle events.
+// Passing nil restores the default observer which does nothing. Observers
+// are called in a separate goroutine, so they never block state creation.
+func SetLifecycleObserver(o LifecycleObserver) {
+	observerMutex.Lock()
+	defer observerMutex.Unlock()
+	if o == nil {
+		o = nopObserver{}
+	}
+	observer = o
+}
+
+func notifyCreate(name string, err error) {
+	observerMutex.RLock()
+	o := observer
+	observerMutex.RUnlock()
+	go o.OnCreate(name, err)
+}
+
+// observedName returns the name passed to LifecycleObserver. It must be called
+// before pystate.ExtractBaseParams removes the parameters.
+func observedName(params data.Map) string {
+	var module, class string
+	if v, ok := params["module_name"]; ok {
+		module, _ = data.ToString(v)
+	}
+	if v, ok := params["class_name"]; ok {
+		class, _ = data.ToString(v)
+	}
+	return module + "." + class
+}
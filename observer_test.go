@@ -0,0 +1,82 @@
+package pymlstate
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+type testObserver struct {
+	ch chan error
+}
+
+func (o *testObserver) OnCreate(name string, err error) {
+	if err == nil {
+		err = errors.New(name)
+	}
+	o.ch <- err
+}
+
+func TestLifecycleObserver(t *testing.T) {
+	ctx := &core.Context{}
+	Convey("Given a registered lifecycle observer", t, func() {
+		o := &testObserver{ch: make(chan error, 1)}
+		SetLifecycleObserver(o)
+		Reset(func() {
+			SetLifecycleObserver(nil)
+		})
+		sc := StateCreator{}
+
+		Convey("When create a state successfully", func() {
+			params := data.Map{
+				"module_path": data.String("./"),
+				"module_name": data.String("_test_pymlstate"),
+				"class_name":  data.String("TestClass"),
+			}
+			s, err := sc.CreateState(ctx, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			Convey("Then the observer should be notified with the name", func() {
+				err := <-o.ch
+				So(err.Error(), ShouldEqual, "_test_pymlstate.TestClass")
+			})
+		})
+
+		Convey("When fail to create a state", func() {
+			params := data.Map{
+				"module_path":      data.String("./"),
+				"module_name":      data.String("_test_pymlstate"),
+				"class_name":       data.String("TestClass"),
+				"batch_train_size": data.Int(0),
+			}
+			_, err := sc.CreateState(ctx, params)
+			So(err, ShouldNotBeNil)
+			Convey("Then the observer should be notified with the error", func() {
+				So(<-o.ch, ShouldEqual, err)
+			})
+		})
+
+		Convey("When create a routed state", func() {
+			rsc := RoutedStateCreator{}
+			params := data.Map{
+				"module_path":   data.String("./"),
+				"module_name":   data.String("_test_pymlstate"),
+				"class_name":    data.String("TestClass"),
+				"routing_field": data.String("tenant"),
+			}
+			s, err := rsc.CreateState(ctx, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			Convey("Then the observer should also be notified", func() {
+				err := <-o.ch
+				So(err.Error(), ShouldEqual, "_test_pymlstate.TestClass")
+			})
+		})
+	})
+}
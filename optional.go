@@ -0,0 +1,72 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+)
+
+// isMissingAttribute returns true when err is caused by AttributeError of
+// Python, which is raised when the called method isn't defined.
+func isMissingAttribute(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "AttributeError") ||
+		strings.Contains(msg, "has no attribute")
+}
+
+// notSupportedError is returned when an optional method isn't defined by the
+// Python class.
+type notSupportedError struct {
+	feature string
+	method  string
+}
+
+func (e *notSupportedError) Error() string {
+	return fmt.Sprintf("%v is not supported by the model: '%v' method is not defined",
+		e.feature, e.method)
+}
+
+func isNotSupported(err error) bool {
+	_, ok := err.(*notSupportedError)
+	return ok
+}
+
+// callOptional calls a method which a Python class doesn't have to define.
+// When the method isn't defined, it returns an error telling that feature
+// isn't supported by the model. The caller must hold the lock.
+func (s *State) callOptional(feature, method string, args ...data.Value) (data.Value, error) {
+	if err := s.checkTermination(); err != nil {
+		return nil, err
+	}
+
+	v, err := s.call(method, args...)
+	if err != nil {
+		return nil, optionalError(feature, method, err)
+	}
+	return v, nil
+}
+
+// callOptionalServing is callOptional for read-only inference methods. When
+// double_buffer is true, it calls the method of the serving instance so that
+// the call doesn't run on the instance being trained. The caller must hold
+// the lock.
+func (s *State) callOptionalServing(feature, method string, args ...data.Value) (data.Value, error) {
+	if err := s.checkTermination(); err != nil {
+		return nil, err
+	}
+
+	v, err := s.callServing(method, args...)
+	if err != nil {
+		return nil, optionalError(feature, method, err)
+	}
+	return v, nil
+}
+
+// optionalError converts err returned by an optional method to
+// notSupportedError when the method isn't defined.
+func optionalError(feature, method string, err error) error {
+	if isMissingAttribute(err) {
+		return &notSupportedError{feature: feature, method: method}
+	}
+	return err
+}
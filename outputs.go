@@ -0,0 +1,81 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+	"strings"
+)
+
+// missingMethodsExpr is evaluated by Python to list names of methods a class
+// doesn't have. The first %v is replaced with a list of method names, and the
+// rest are replaced with the module name and the class name.
+const missingMethodsExpr = `[m for m in %v if not callable(getattr(getattr(` +
+	`__import__(%q, fromlist=['*']), %q), m, None))]`
+
+func parseOutputs(m data.Map) (map[string]string, error) {
+	outputs := make(map[string]string, len(m))
+	for name, v := range m {
+		method, err := data.AsString(v)
+		if err != nil {
+			return nil, fmt.Errorf("method of output '%v' must be a string: %v", name, err)
+		}
+		if method == "" {
+			return nil, fmt.Errorf("method of output '%v' must not be empty", name)
+		}
+		outputs[name] = method
+	}
+	return outputs, nil
+}
+
+// checkOutputs returns an error when the class specified by bp doesn't have
+// some of methods of outputs. The module must have been loaded.
+func checkOutputs(bp *pystate.BaseParams, outputs map[string]string) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(outputs))
+	for n := range outputs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	methods := make([]string, len(names))
+	for i, n := range names {
+		methods[i] = fmt.Sprintf("%q", outputs[n])
+	}
+
+	v, err := evalPython(fmt.Sprintf(missingMethodsExpr,
+		"["+strings.Join(methods, ", ")+"]", bp.ModuleName, bp.ClassName))
+	if err != nil {
+		return err
+	}
+	missing, err := data.AsArray(v)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("class '%v' doesn't have methods of outputs: %v",
+			bp.ClassName, missing)
+	}
+	return nil
+}
+
+// PredictOutput applies the method of the output to the data. The output
+// must be defined in outputs parameter. Input is converted in the same way as
+// Predict, but the result is returned as it is without being recorded nor
+// formatted.
+func (s *State) PredictOutput(ctx *core.Context, dt data.Value, output string) (data.Value, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	method, ok := s.params.Outputs[output]
+	if !ok {
+		return nil, fmt.Errorf("output '%v' isn't defined", output)
+	}
+	dt, err := s.convertInput(dt)
+	if err != nil {
+		return nil, err
+	}
+	return s.callServing(method, s.sparsify(dt))
+}
@@ -0,0 +1,84 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateOutputs(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate having outputs", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize: 1,
+			Outputs: map[string]string{
+				"class":     "predict",
+				"embedding": "embed",
+				"proba":     "predict_proba",
+			},
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("outputs_test", "pymlstate", s), ShouldBeNil)
+		Reset(func() {
+			ctx.SharedStates.Remove("outputs_test")
+			s.Terminate(ctx)
+		})
+
+		Convey("When predict with each output", func() {
+			c, err := Predict(ctx, "outputs_test", data.Int(1), "class")
+			So(err, ShouldBeNil)
+			e, err := Predict(ctx, "outputs_test", data.Int(1), "embedding")
+			So(err, ShouldBeNil)
+			p, err := Predict(ctx, "outputs_test", data.Int(1), "proba")
+			So(err, ShouldBeNil)
+
+			Convey("Then the method of each output should be called", func() {
+				So(c, ShouldEqual, data.String("predict called"))
+				So(e, ShouldResemble, data.Array{data.Float(0.5), data.Float(0.5)})
+				So(p, ShouldResemble, data.Array{data.Float(0.1), data.Float(0.4),
+					data.Float(0.4), data.Float(0.1)})
+			})
+		})
+
+		Convey("When predict without an output", func() {
+			v, err := Predict(ctx, "outputs_test", data.Int(1))
+			Convey("Then predict should be called", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.String("predict called"))
+			})
+		})
+
+		Convey("When predict with an undefined output", func() {
+			_, err := Predict(ctx, "outputs_test", data.Int(1), "logits")
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an output whose method doesn't exist", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "MinimalClass",
+		}
+		Convey("When create a pymlstate", func() {
+			_, err := New(baseParams, &MLParams{
+				BatchSize: 1,
+				Outputs:   map[string]string{"embedding": "embed"},
+			}, data.Map{})
+			Convey("Then it should fail naming the method", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "embed")
+			})
+		})
+	})
+}
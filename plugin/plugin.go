@@ -5,13 +5,89 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
 )
 
+// init registers UDFs, UDSFs, and UDS creators. Each UDF is a thin wrapper of the
+// exported function of pymlstate package having the same name without the
+// "pymlstate_" prefix in CamelCase, e.g. pymlstate_call is CallMethod, so
+// that Go programs can use the same features without BQL.
 func init() {
 	udf.MustRegisterGlobalUDSCreator("pymlstate", &pymlstate.StateCreator{})
+	udf.MustRegisterGlobalUDSCreator("pymlstate_routed",
+		&pymlstate.RoutedStateCreator{})
+	udf.MustRegisterGlobalUDSFCreator("pymlstate_metrics_stream",
+		udf.MustConvertToUDSFCreator(pymlstate.CreateMetricsStream))
+	udf.MustRegisterGlobalUDSFCreator("pymlstate_fit_events",
+		udf.MustConvertToUDSFCreator(pymlstate.CreateFitEventsStream))
+	udf.MustRegisterGlobalUDSFCreator("pymlstate_predict_stream",
+		udf.MustConvertToUDSFCreator(pymlstate.CreatePredictStream))
 
 	udf.MustRegisterGlobalUDF("pymlstate_fit",
 		udf.MustConvertGeneric(pymlstate.Fit))
+	udf.MustRegisterGlobalUDF("pymlstate_partial_fit",
+		udf.MustConvertGeneric(pymlstate.PartialFit))
 	udf.MustRegisterGlobalUDF("pymlstate_predict",
 		udf.MustConvertGeneric(pymlstate.Predict))
 	udf.MustRegisterGlobalUDF("pymlstate_flush",
 		udf.MustConvertGeneric(pymlstate.Flush))
+	udf.MustRegisterGlobalUDF("pymlstate_call",
+		udf.MustConvertGeneric(pymlstate.CallMethod))
+	udf.MustRegisterGlobalUDF("pymlstate_ensemble_predict",
+		udf.MustConvertGeneric(pymlstate.EnsemblePredict))
+	udf.MustRegisterGlobalUDF("pymlstate_ensemble_vote",
+		udf.MustConvertGeneric(pymlstate.EnsembleVote))
+	udf.MustRegisterGlobalUDF("pymlstate_compare",
+		udf.MustConvertGeneric(pymlstate.Compare))
+	udf.MustRegisterGlobalUDF("pymlstate_calibration",
+		udf.MustConvertGeneric(pymlstate.Calibration))
+	udf.MustRegisterGlobalUDF("pymlstate_evaluate",
+		udf.MustConvertGeneric(pymlstate.Evaluate))
+	udf.MustRegisterGlobalUDF("pymlstate_explain",
+		udf.MustConvertGeneric(pymlstate.Explain))
+	udf.MustRegisterGlobalUDF("pymlstate_feature_importance",
+		udf.MustConvertGeneric(pymlstate.FeatureImportance))
+	udf.MustRegisterGlobalUDF("pymlstate_predict_entropy",
+		udf.MustConvertGeneric(pymlstate.PredictEntropy))
+	udf.MustRegisterGlobalUDF("pymlstate_predict_batch",
+		udf.MustConvertGeneric(pymlstate.PredictBatch))
+	udf.MustRegisterGlobalUDF("pymlstate_predict_proba",
+		udf.MustConvertGeneric(pymlstate.PredictProba))
+	udf.MustRegisterGlobalUDF("pymlstate_predict_topk",
+		udf.MustConvertGeneric(pymlstate.PredictTopK))
+	udf.MustRegisterGlobalUDF("pymlstate_predict_routed",
+		udf.MustConvertGeneric(pymlstate.PredictRouted))
+	udf.MustRegisterGlobalUDF("pymlstate_checkpoint_routed",
+		udf.MustConvertGeneric(pymlstate.CheckpointRouted))
+	udf.MustRegisterGlobalUDF("pymlstate_predict_record",
+		udf.MustConvertGeneric(pymlstate.PredictRecord))
+	udf.MustRegisterGlobalUDF("pymlstate_prediction_history",
+		udf.MustConvertGeneric(pymlstate.PredictionHistory))
+	udf.MustRegisterGlobalUDF("pymlstate_release_memory",
+		udf.MustConvertGeneric(pymlstate.ReleaseMemory))
+	udf.MustRegisterGlobalUDF("pymlstate_repr",
+		udf.MustConvertGeneric(pymlstate.Repr))
+	udf.MustRegisterGlobalUDF("pymlstate_export_onnx",
+		udf.MustConvertGeneric(pymlstate.ExportONNX))
+	udf.MustRegisterGlobalUDF("pymlstate_save",
+		udf.MustConvertGeneric(pymlstate.Save))
+	udf.MustRegisterGlobalUDF("pymlstate_load",
+		udf.MustConvertGeneric(pymlstate.Load))
+	udf.MustRegisterGlobalUDF("pymlstate_save_bytes",
+		udf.MustConvertGeneric(pymlstate.SaveBytes))
+	udf.MustRegisterGlobalUDF("pymlstate_pause",
+		udf.MustConvertGeneric(pymlstate.Pause))
+	udf.MustRegisterGlobalUDF("pymlstate_resume",
+		udf.MustConvertGeneric(pymlstate.Resume))
+	udf.MustRegisterGlobalUDF("pymlstate_quiesce",
+		udf.MustConvertGeneric(pymlstate.Quiesce))
+	udf.MustRegisterGlobalUDF("pymlstate_selftest",
+		udf.MustConvertGeneric(pymlstate.SelfTest))
+	udf.MustRegisterGlobalUDF("pymlstate_score",
+		udf.MustConvertGeneric(pymlstate.Score))
+	udf.MustRegisterGlobalUDF("pymlstate_transform",
+		udf.MustConvertGeneric(pymlstate.Transform))
+	udf.MustRegisterGlobalUDF("pymlstate_set_params",
+		udf.MustConvertGeneric(pymlstate.SetParams))
+	udf.MustRegisterGlobalUDF("pymlstate_get_params",
+		udf.MustConvertGeneric(pymlstate.GetParams))
+	udf.MustRegisterGlobalUDF("pymlstate_status",
+		udf.MustConvertGeneric(pymlstate.Status))
 }
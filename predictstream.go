@@ -0,0 +1,308 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"time"
+)
+
+const (
+	predictStreamOnErrorFail = "fail"
+	predictStreamOnErrorNull = "null"
+)
+
+var (
+	psBatchSizePath       = data.MustCompilePath("batch_size")
+	psPredictionFieldPath = data.MustCompilePath("prediction_field")
+	psOverwritePath       = data.MustCompilePath("overwrite")
+	psMaxWaitPath         = data.MustCompilePath("max_wait")
+	psPredictTimeoutPath  = data.MustCompilePath("predict_timeout")
+	psOnErrorPath         = data.MustCompilePath("on_error")
+	psErrorFieldPath      = data.MustCompilePath("error_field")
+)
+
+// predictStream is a UDSF emitting tuples of the input stream with
+// predictions of a state.
+type predictStream struct {
+	stateName string
+
+	batchSize  int
+	field      string
+	overwrite  bool
+	maxWait    time.Duration
+	timeout    time.Duration
+	onError    string
+	errorField string
+
+	// m protects fields below because pending tuples are also predicted by
+	// the timer of max_wait. ctx and w are the ones given to the last
+	// Process, and they're used when pending tuples are predicted outside
+	// Process.
+	m       sync.Mutex
+	pending []*core.Tuple
+	timer   *time.Timer
+	gen     int64
+	ctx     *core.Context
+	w       core.Writer
+}
+
+// CreatePredictStream creates a UDSF which applies the model of the state to
+// "data" field of tuples from the input stream and emits each tuple with the
+// prediction added. Predictions are formatted in the same way as
+// pymlstate_predict. params is a map having the following optional
+// parameters:
+//
+//	batch_size: the number of tuples predicted at once. A batch is predicted
+//	            by one call of `predict_batch` method, or the method given by
+//	            predict_batch_method, when the class defines it, and by
+//	            `predict` for each tuple otherwise. The default value is 1.
+//	prediction_field: the name of the field having the prediction. The
+//	                  default value is "prediction".
+//	overwrite: true when the prediction can overwrite the field of the input
+//	           tuple having the same name. Otherwise, such tuples result in
+//	           an error. The default value is false.
+//	max_wait: the maximum time in seconds a tuple waits for its batch to
+//	          become full. When it elapses, the incomplete batch is
+//	          predicted. The default value is 1. 0 means no limit.
+//	predict_timeout: the timeout of a prediction in seconds, which overrides
+//	                 predict_timeout of the state. See
+//	                 MLParams.PredictTimeout for details.
+//	on_error: "fail" or "null". When a prediction fails, e.g. by a timeout,
+//	          "fail" makes Process fail and tuples of the batch are dropped.
+//	          "null" emits them with a null prediction and the error message
+//	          in the field given by error_field, which is null for tuples
+//	          predicted successfully. Because a batch is predicted at once,
+//	          all tuples of the batch get the error. The default value is
+//	          "fail".
+//	error_field: the name of the field having the error message when
+//	             on_error is "null". The default value is "prediction_error".
+//
+// Tuples are emitted in the order they arrived. Tuples remaining when the
+// stream is stopped are predicted before it stops.
+//
+// It's registered as pymlstate_predict_stream(stream, state_name, params).
+func CreatePredictStream(ctx *core.Context, decl udf.UDSFDeclarer, stream string,
+	stateName string, params data.Map) (udf.UDSF, error) {
+	p, err := newPredictStream(stateName, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := decl.Input(stream, nil); err != nil {
+		return nil, err
+	}
+	if _, err := lookupState(ctx, stateName); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func newPredictStream(stateName string, params data.Map) (*predictStream, error) {
+	p := &predictStream{
+		stateName:  stateName,
+		batchSize:  1,
+		field:      "prediction",
+		maxWait:    time.Second,
+		timeout:    -1,
+		onError:    predictStreamOnErrorFail,
+		errorField: "prediction_error",
+	}
+
+	if v, err := params.Get(psBatchSizePath); err == nil {
+		bs, err := data.AsInt(v)
+		if err != nil {
+			return nil, err
+		}
+		if bs <= 0 {
+			return nil, fmt.Errorf("batch_size must be greater than 0")
+		}
+		p.batchSize = int(bs)
+	}
+	if v, err := params.Get(psPredictionFieldPath); err == nil {
+		if p.field, err = data.AsString(v); err != nil {
+			return nil, err
+		}
+		if p.field == "" {
+			return nil, fmt.Errorf("prediction_field must not be empty")
+		}
+	}
+	if v, err := params.Get(psOverwritePath); err == nil {
+		if p.overwrite, err = data.AsBool(v); err != nil {
+			return nil, err
+		}
+	}
+	if v, err := params.Get(psMaxWaitPath); err == nil {
+		sec, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if sec < 0 {
+			return nil, fmt.Errorf("max_wait must not be negative")
+		}
+		p.maxWait = time.Duration(sec * float64(time.Second))
+	}
+	if v, err := params.Get(psPredictTimeoutPath); err == nil {
+		sec, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if sec < 0 {
+			return nil, fmt.Errorf("predict_timeout must not be negative")
+		}
+		p.timeout = time.Duration(sec * float64(time.Second))
+	}
+	if v, err := params.Get(psOnErrorPath); err == nil {
+		if p.onError, err = data.AsString(v); err != nil {
+			return nil, err
+		}
+		switch p.onError {
+		case predictStreamOnErrorFail, predictStreamOnErrorNull:
+		default:
+			return nil, fmt.Errorf("on_error must be '%v' or '%v': %v",
+				predictStreamOnErrorFail, predictStreamOnErrorNull, p.onError)
+		}
+	}
+	if v, err := params.Get(psErrorFieldPath); err == nil {
+		if p.errorField, err = data.AsString(v); err != nil {
+			return nil, err
+		}
+		if p.errorField == "" {
+			return nil, fmt.Errorf("error_field must not be empty")
+		}
+	}
+	if p.onError == predictStreamOnErrorNull && p.errorField == p.field {
+		return nil, fmt.Errorf("error_field must differ from prediction_field")
+	}
+	return p, nil
+}
+
+func (p *predictStream) Process(ctx *core.Context, t *core.Tuple, w core.Writer) error {
+	if _, err := t.Data.Get(datPath); err != nil {
+		return fmt.Errorf("the tuple doesn't have data field: %v", err)
+	}
+	if !p.overwrite {
+		if _, ok := t.Data[p.field]; ok {
+			return fmt.Errorf("the tuple already has '%v' field", p.field)
+		}
+		if _, ok := t.Data[p.errorField]; ok && p.onError == predictStreamOnErrorNull {
+			return fmt.Errorf("the tuple already has '%v' field", p.errorField)
+		}
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.ctx = ctx
+	p.w = w
+	p.pending = append(p.pending, t)
+	if len(p.pending) >= p.batchSize {
+		return p.flush()
+	}
+	if len(p.pending) == 1 && p.maxWait > 0 {
+		gen := p.gen
+		p.timer = time.AfterFunc(p.maxWait, func() {
+			p.flushExpired(gen)
+		})
+	}
+	return nil
+}
+
+// flushExpired predicts pending tuples when the batch started in the
+// generation gen is still pending after max_wait.
+func (p *predictStream) flushExpired(gen int64) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if gen != p.gen || len(p.pending) == 0 {
+		return
+	}
+	if err := p.flush(); err != nil {
+		p.ctx.ErrLog(err).WithField("state", p.stateName).
+			Error("pymlstate_predict_stream cannot predict an incomplete batch")
+	}
+}
+
+// flush predicts pending tuples and emits them. The caller must hold p.m.
+func (p *predictStream) flush() error {
+	batch := p.pending
+	p.pending = nil
+	p.gen++
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	s, err := lookupState(p.ctx, p.stateName)
+	if err != nil {
+		return err
+	}
+	preds, errs := p.predict(p.ctx, s, batch)
+	for i, t := range batch {
+		pred, err := preds[i], errs[i]
+		if err == nil {
+			pred, err = s.formatPrediction(pred)
+		}
+		if err != nil && p.onError == predictStreamOnErrorFail {
+			return err
+		}
+
+		out := t.Copy()
+		if err != nil {
+			out.Data[p.field] = data.Null{}
+			out.Data[p.errorField] = data.String(err.Error())
+		} else {
+			out.Data[p.field] = pred
+			if p.onError == predictStreamOnErrorNull {
+				out.Data[p.errorField] = data.Null{}
+			}
+		}
+		if err := p.w.Write(p.ctx, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// predict returns a prediction or an error of each tuple in batch. When the
+// batch is predicted at once, all tuples get the same error on a failure.
+func (p *predictStream) predict(ctx *core.Context, s *State, batch []*core.Tuple) (
+	[]data.Value, []error) {
+	samples := make([]data.Value, len(batch))
+	for i, t := range batch {
+		samples[i], _ = t.Data.Get(datPath)
+	}
+	preds := make([]data.Value, len(samples))
+	errs := make([]error, len(samples))
+
+	if len(samples) > 1 {
+		res, err := s.predictBatch(ctx, samples, p.timeout)
+		if err == nil {
+			copy(preds, res)
+			return preds, errs
+		}
+		if !isNotSupported(err) {
+			for i := range errs {
+				errs[i] = err
+			}
+			return preds, errs
+		}
+	}
+
+	for i, dt := range samples {
+		preds[i], errs[i] = s.predict(ctx, dt, p.timeout)
+	}
+	return preds, errs
+}
+
+// Terminate predicts tuples remaining in the batch and emits them.
+func (p *predictStream) Terminate(ctx *core.Context) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if len(p.pending) == 0 || p.w == nil {
+		return nil
+	}
+	return p.flush()
+}
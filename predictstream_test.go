@@ -0,0 +1,198 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPredictStream(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given predict streams of pymlstates", t, func() {
+		newState := func(name, className string, params *MLParams) *State {
+			baseParams := &pystate.BaseParams{
+				ModulePath: "./",
+				ModuleName: "_test_pymlstate",
+				ClassName:  className,
+			}
+			s, err := New(baseParams, params, data.Map{})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add(name, "pymlstate", s), ShouldBeNil)
+			Reset(func() {
+				ctx.SharedStates.Remove(name)
+				for i := 0; i < 100 && s.timeouts.checkOutstanding() != nil; i++ {
+					time.Sleep(10 * time.Millisecond)
+				}
+				s.Terminate(ctx)
+			})
+			return s
+		}
+		newStream := func(name string, params data.Map) *predictStream {
+			ps, err := newPredictStream(name, params)
+			So(err, ShouldBeNil)
+			return ps
+		}
+		var (
+			m       sync.Mutex
+			emitted []*core.Tuple
+		)
+		w := core.WriterFunc(func(ctx *core.Context, t *core.Tuple) error {
+			m.Lock()
+			defer m.Unlock()
+			emitted = append(emitted, t)
+			return nil
+		})
+		numEmitted := func() int {
+			m.Lock()
+			defer m.Unlock()
+			return len(emitted)
+		}
+		tuple := func(i int) *core.Tuple {
+			return &core.Tuple{
+				Data: data.Map{
+					"id":   data.Int(i),
+					"data": data.Int(i),
+				},
+				Timestamp: time.Now(),
+			}
+		}
+
+		Convey("When tuples are written to a stream of a state having predict_batch", func() {
+			newState("predict_stream_test", "TestClass", &MLParams{BatchSize: 1})
+			ps := newStream("predict_stream_test", data.Map{
+				"batch_size": data.Int(2),
+				"max_wait":   data.Int(0),
+			})
+			So(ps.Process(ctx, tuple(1), w), ShouldBeNil)
+
+			Convey("Then nothing should be emitted until the batch becomes full", func() {
+				So(emitted, ShouldBeEmpty)
+			})
+
+			Convey("Then tuples should be emitted with predictions after the batch becomes full", func() {
+				So(ps.Process(ctx, tuple(2), w), ShouldBeNil)
+				So(len(emitted), ShouldEqual, 2)
+				for i, t := range emitted {
+					So(t.Data["id"], ShouldEqual, data.Int(i+1))
+					So(t.Data["prediction"], ShouldEqual, data.String("predict called"))
+				}
+			})
+
+			Convey("Then the incomplete batch should be predicted on stop", func() {
+				So(ps.Terminate(ctx), ShouldBeNil)
+				So(len(emitted), ShouldEqual, 1)
+				So(emitted[0].Data["prediction"], ShouldEqual, data.String("predict called"))
+			})
+		})
+
+		Convey("When an incomplete batch waits longer than max_wait", func() {
+			newState("predict_stream_test", "TestClass", &MLParams{BatchSize: 1})
+			ps := newStream("predict_stream_test", data.Map{
+				"batch_size": data.Int(10),
+				"max_wait":   data.Float(0.05),
+			})
+			So(ps.Process(ctx, tuple(1), w), ShouldBeNil)
+
+			Convey("Then it should be predicted without waiting for other tuples", func() {
+				for i := 0; i < 100 && numEmitted() == 0; i++ {
+					time.Sleep(10 * time.Millisecond)
+				}
+				So(numEmitted(), ShouldEqual, 1)
+				So(ps.Terminate(ctx), ShouldBeNil)
+				So(numEmitted(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When tuples are written to a stream of a state not having predict_batch", func() {
+			newState("predict_stream_test2", "PartialClass", &MLParams{
+				BatchSize:     1,
+				PredictMethod: "forward",
+			})
+			ps := newStream("predict_stream_test2", data.Map{"batch_size": data.Int(2)})
+			So(ps.Process(ctx, tuple(1), w), ShouldBeNil)
+			So(ps.Process(ctx, tuple(2), w), ShouldBeNil)
+
+			Convey("Then each tuple should be predicted separately", func() {
+				So(len(emitted), ShouldEqual, 2)
+				for _, t := range emitted {
+					So(t.Data["prediction"], ShouldEqual, data.String("forward called"))
+				}
+			})
+		})
+
+		Convey("When prediction_field is given", func() {
+			newState("predict_stream_test", "TestClass", &MLParams{BatchSize: 1})
+			ps := newStream("predict_stream_test", data.Map{"prediction_field": data.String("id")})
+
+			Convey("Then a tuple having the field should be rejected", func() {
+				So(ps.Process(ctx, tuple(1), w), ShouldNotBeNil)
+				So(emitted, ShouldBeEmpty)
+			})
+
+			Convey("Then the field should be overwritten when overwrite is true", func() {
+				ps.overwrite = true
+				So(ps.Process(ctx, tuple(1), w), ShouldBeNil)
+				So(len(emitted), ShouldEqual, 1)
+				So(emitted[0].Data["id"], ShouldEqual, data.String("predict called"))
+			})
+		})
+
+		Convey("When a batch times out", func() {
+			newState("predict_stream_test", "TestClass", &MLParams{
+				BatchSize:          1,
+				PredictBatchMethod: "slow_predict_batch",
+			})
+			params := data.Map{
+				"batch_size":      data.Int(2),
+				"predict_timeout": data.Float(0.01),
+			}
+
+			Convey("Then it should fail by default", func() {
+				ps := newStream("predict_stream_test", params)
+				So(ps.Process(ctx, tuple(1), w), ShouldBeNil)
+				So(ps.Process(ctx, tuple(2), w), ShouldNotBeNil)
+				So(emitted, ShouldBeEmpty)
+			})
+
+			Convey("Then tuples should be emitted with null predictions and errors when on_error is null", func() {
+				params["on_error"] = data.String("null")
+				ps := newStream("predict_stream_test", params)
+				So(ps.Process(ctx, tuple(1), w), ShouldBeNil)
+				So(ps.Process(ctx, tuple(2), w), ShouldBeNil)
+				So(len(emitted), ShouldEqual, 2)
+				for _, t := range emitted {
+					So(t.Data["prediction"], ShouldEqual, data.Null{})
+					So(t.Data["prediction_error"], ShouldHaveSameTypeAs, data.String(""))
+				}
+			})
+		})
+
+		Convey("When a tuple without data is written", func() {
+			ps := newStream("predict_stream_test", data.Map{})
+			err := ps.Process(ctx, &core.Tuple{Data: data.Map{}}, w)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a stream is created with invalid params", func() {
+			Convey("Then it should fail", func() {
+				for _, p := range []data.Map{
+					{"batch_size": data.Int(0)},
+					{"max_wait": data.Int(-1)},
+					{"on_error": data.String("ignore")},
+					{"on_error": data.String("null"), "error_field": data.String("prediction")},
+				} {
+					_, err := newPredictStream("predict_stream_test", p)
+					So(err, ShouldNotBeNil)
+				}
+			})
+		})
+	})
+}
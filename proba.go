@@ -0,0 +1,230 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// probaSumTolerance is the tolerance of the difference between 1 and the
+	// sum of probabilities returned by `predict_proba`.
+	probaSumTolerance = 1e-3
+
+	// normalizeWarnInterval is the minimum interval of warnings logged when
+	// normalize_proba significantly changes probabilities.
+	normalizeWarnInterval = time.Minute
+)
+
+// predictProba calls `predict_proba` method of the model and returns the
+// probability of each class as a float64 slice.
+func (s *State) predictProba(ctx *core.Context, dt data.Value) ([]float64, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	dt, err := s.convertInput(dt)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.callOptionalServing("probability prediction", "predict_proba", dt)
+	if err != nil {
+		return nil, err
+	}
+	proba, err := toFloatVector(res)
+	if err != nil {
+		return nil, fmt.Errorf("predict_proba must return an array of numbers: %v", err)
+	}
+	if s.params.NormalizeProba {
+		significant, err := normalizeProba(proba)
+		if err != nil {
+			return nil, err
+		}
+		if significant && s.allowNormalizeWarn() {
+			ctx.Log().WithField("proba", res).
+				Warn("pymlstate significantly normalized probabilities returned by predict_proba")
+		}
+	}
+	return proba, nil
+}
+
+// normalizeProba clamps each probability to [0, 1] and scales them so that
+// they sum up to 1 in place. It returns true when a probability is clamped or
+// the sum differs from 1 by more than probaSumTolerance, which may indicate a
+// bug of the model.
+func normalizeProba(proba []float64) (bool, error) {
+	significant := false
+	sum := 0.0
+	for i, p := range proba {
+		if math.IsNaN(p) {
+			return false, fmt.Errorf("predict_proba returned NaN")
+		}
+		c := math.Min(math.Max(p, 0), 1)
+		if math.Abs(c-p) > probaSumTolerance {
+			significant = true
+		}
+		proba[i] = c
+		sum += c
+	}
+	if sum == 0 {
+		return false, fmt.Errorf("predict_proba returned no positive probability")
+	}
+	if math.Abs(sum-1) > probaSumTolerance {
+		significant = true
+	}
+	for i := range proba {
+		proba[i] /= sum
+	}
+	return significant, nil
+}
+
+// allowNormalizeWarn returns true when a warning of normalize_proba hasn't
+// been logged for normalizeWarnInterval. It can be called concurrently.
+func (s *State) allowNormalizeWarn() bool {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&s.normalizeWarnedAt)
+	if last != 0 && now-last < int64(normalizeWarnInterval) {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&s.normalizeWarnedAt, last, now)
+}
+
+// PredictProba returns the probability of each class computed by
+// `predict_proba` method of the model as an array of floats. Probabilities
+// are normalized when normalize_proba is true.
+func (s *State) PredictProba(ctx *core.Context, dt data.Value) (data.Value, error) {
+	proba, err := s.predictProba(ctx, dt)
+	if err != nil {
+		return nil, err
+	}
+	res := make(data.Array, len(proba))
+	for i, p := range proba {
+		res[i] = data.Float(p)
+	}
+	return res, nil
+}
+
+// PredictTopK returns the k most probable classes computed by `predict_proba`
+// method of the model. See TopK for the format of the return value.
+func (s *State) PredictTopK(ctx *core.Context, dt data.Value, k int) (data.Value, error) {
+	proba, err := s.predictProba(ctx, dt)
+	if err != nil {
+		return nil, err
+	}
+	return topK(proba, k)
+}
+
+// topK returns an array of maps having "label" and "score" sorted by score in
+// descending order. Classes having the same score are sorted by the label
+// index in ascending order.
+func topK(scores []float64, k int) (data.Array, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("k must be greater than 0")
+	}
+	if k > len(scores) {
+		return nil, fmt.Errorf("k (%v) must not be greater than the number of classes (%v)",
+			k, len(scores))
+	}
+
+	idx := make([]int, len(scores))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return scores[idx[i]] > scores[idx[j]]
+	})
+
+	res := make(data.Array, k)
+	for i := 0; i < k; i++ {
+		res[i] = data.Map{
+			"label": data.Int(idx[i]),
+			"score": data.Float(scores[idx[i]]),
+		}
+	}
+	return res, nil
+}
+
+// PredictEntropy returns the Shannon entropy of the probabilities computed by
+// `predict_proba` method of the model together with the most probable class.
+// The entropy is in nats, i.e. the natural logarithm is used. A warning is
+// logged when the probabilities don't sum up to 1.
+//
+// It returns a `data.Map` having "label", which is the index of the most
+// probable class, "score", which is its probability, and "entropy".
+func (s *State) PredictEntropy(ctx *core.Context, dt data.Value) (data.Value, error) {
+	proba, err := s.predictProba(ctx, dt)
+	if err != nil {
+		return nil, err
+	}
+	label := argmax(proba)
+	if label < 0 {
+		return nil, fmt.Errorf("predict_proba returned an empty array")
+	}
+
+	sum := 0.0
+	for _, p := range proba {
+		sum += p
+	}
+	if !s.params.NormalizeProba && math.Abs(sum-1) > probaSumTolerance {
+		ctx.Log().WithField("sum", sum).
+			Warn("Probabilities returned by predict_proba don't sum up to 1")
+	}
+
+	return data.Map{
+		"label":   data.Int(label),
+		"score":   data.Float(proba[label]),
+		"entropy": data.Float(entropy(proba)),
+	}, nil
+}
+
+// entropy returns the Shannon entropy of proba in nats. Non-positive
+// probabilities don't contribute to the entropy.
+func entropy(proba []float64) float64 {
+	h := 0.0
+	for _, p := range proba {
+		if p > 0 {
+			h -= p * math.Log(p)
+		}
+	}
+	return h
+}
+
+// PredictEntropy returns the most probable class of the given data and the
+// entropy of its probabilities so that uncertain samples can be selected,
+// e.g. for active learning. The model must have `predict_proba` method. See
+// State.PredictEntropy for details.
+func PredictEntropy(ctx *core.Context, stateName string, dt data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.PredictEntropy(ctx, dt)
+}
+
+// PredictProba returns the probability of each class of the given data as an
+// array so that BQL can threshold or rank classes. The model must have
+// `predict_proba` method.
+func PredictProba(ctx *core.Context, stateName string, dt data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.PredictProba(ctx, dt)
+}
+
+// PredictTopK returns the k most probable classes of the given data as an
+// array of maps having "label" and "score" in descending order of score. The
+// model must have `predict_proba` method.
+func PredictTopK(ctx *core.Context, stateName string, dt data.Value, k int) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.PredictTopK(ctx, dt, k)
+}
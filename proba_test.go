@@ -0,0 +1,154 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"testing"
+)
+
+func TestTopK(t *testing.T) {
+	Convey("Given a score vector having ties", t, func() {
+		scores := []float64{0.1, 0.3, 0.2, 0.3, 0.1}
+		Convey("When get top 3 classes", func() {
+			res, err := topK(scores, 3)
+			Convey("Then classes should be sorted by score and then label", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Array{
+					data.Map{"label": data.Int(1), "score": data.Float(0.3)},
+					data.Map{"label": data.Int(3), "score": data.Float(0.3)},
+					data.Map{"label": data.Int(2), "score": data.Float(0.2)},
+				})
+			})
+		})
+
+		Convey("When k is greater than the number of classes", func() {
+			_, err := topK(scores, 6)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When k is 0", func() {
+			_, err := topK(scores, 0)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestEntropy(t *testing.T) {
+	Convey("Given probability vectors", t, func() {
+		Convey("When compute the entropy of a certain prediction", func() {
+			h := entropy([]float64{0, 1, 0})
+			Convey("Then it should be 0", func() {
+				So(h, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When compute the entropy of a uniform distribution", func() {
+			h := entropy([]float64{0.25, 0.25, 0.25, 0.25})
+			Convey("Then it should be the log of the number of classes", func() {
+				So(h, ShouldAlmostEqual, math.Log(4), 1e-9)
+			})
+		})
+	})
+}
+
+func TestNormalizeProba(t *testing.T) {
+	Convey("Given probabilities", t, func() {
+		Convey("When normalize a valid distribution", func() {
+			p := []float64{0.25, 0.75}
+			significant, err := normalizeProba(p)
+			Convey("Then it should not be changed", func() {
+				So(err, ShouldBeNil)
+				So(significant, ShouldBeFalse)
+				So(p, ShouldResemble, []float64{0.25, 0.75})
+			})
+		})
+
+		Convey("When normalize probabilities out of range", func() {
+			p := []float64{-0.5, 1.5, 0.5}
+			significant, err := normalizeProba(p)
+			Convey("Then they should be clamped and renormalized", func() {
+				So(err, ShouldBeNil)
+				So(significant, ShouldBeTrue)
+				So(p[0], ShouldEqual, 0)
+				So(p[1], ShouldAlmostEqual, 2.0/3, 1e-9)
+				So(p[2], ShouldAlmostEqual, 1.0/3, 1e-9)
+			})
+		})
+
+		Convey("When normalize probabilities slightly off", func() {
+			p := []float64{0.5, 0.5001}
+			significant, err := normalizeProba(p)
+			Convey("Then they should be renormalized without a warning", func() {
+				So(err, ShouldBeNil)
+				So(significant, ShouldBeFalse)
+				So(p[0]+p[1], ShouldAlmostEqual, 1, 1e-12)
+			})
+		})
+
+		Convey("When normalize zeros", func() {
+			_, err := normalizeProba([]float64{0, 0})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestPyMLStatePredictTopK(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate having predict_proba", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When predict probabilities", func() {
+			res, err := s.PredictProba(ctx, data.String("c"))
+			Convey("Then the probability of each class should be returned", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Array{
+					data.Float(0.1), data.Float(0.4), data.Float(0.4), data.Float(0.1),
+				})
+			})
+		})
+
+		Convey("When predict top 2 classes", func() {
+			res, err := s.PredictTopK(ctx, data.String("c"), 2)
+			Convey("Then the most probable classes should be returned", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Array{
+					data.Map{"label": data.Int(1), "score": data.Float(0.4)},
+					data.Map{"label": data.Int(2), "score": data.Float(0.4)},
+				})
+			})
+		})
+
+		Convey("When predict with entropy", func() {
+			v, err := s.PredictEntropy(ctx, data.String("c"))
+			So(err, ShouldBeNil)
+			res, err := data.AsMap(v)
+			So(err, ShouldBeNil)
+			Convey("Then the most probable class and the entropy should be returned", func() {
+				So(res["label"], ShouldEqual, data.Int(1))
+				So(res["score"], ShouldEqual, data.Float(0.4))
+				h, err := data.AsFloat(res["entropy"])
+				So(err, ShouldBeNil)
+				So(h, ShouldAlmostEqual, -0.2*math.Log(0.1)-0.8*math.Log(0.4), 1e-9)
+			})
+		})
+	})
+}
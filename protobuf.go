@@ -0,0 +1,106 @@
+package pymlstate
+
+import (
+	"encoding/binary"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+)
+
+const (
+	predictFormatRaw      = "raw"
+	predictFormatProtobuf = "protobuf"
+)
+
+func validatePredictFormat(f string) error {
+	switch f {
+	case predictFormatRaw, predictFormatProtobuf:
+		return nil
+	default:
+		return fmt.Errorf("predict_format must be '%v' or '%v': %v",
+			predictFormatRaw, predictFormatProtobuf, f)
+	}
+}
+
+// formatPrediction converts a prediction according to predict_as_scores and
+// predict_format.
+func formatPrediction(p *MLParams, v data.Value) (data.Value, error) {
+	if p.PredictAsScores {
+		return classScores(p.ClassNames, p.NumClasses, v)
+	}
+	if p.PredictFormat != predictFormatProtobuf {
+		return v, nil
+	}
+	b, err := encodePredictionProtobuf(v)
+	if err != nil {
+		return nil, err
+	}
+	return data.Blob(b), nil
+}
+
+// encodePredictionProtobuf encodes a prediction as the following protobuf
+// message:
+//
+//	syntax = "proto3";
+//	message Prediction {
+//	  repeated double values = 1; // numeric prediction(s)
+//	  int64 label = 2;            // set when the prediction is an integer
+//	  string text = 3;            // set when the prediction is a string
+//	}
+//
+// A number is encoded as values having one element and an array of numbers
+// is encoded as values. An integer is also encoded as label. Other types of
+// predictions cannot be encoded.
+func encodePredictionProtobuf(v data.Value) ([]byte, error) {
+	var values []float64
+	var label *int64
+	var text *string
+
+	switch v.Type() {
+	case data.TypeInt:
+		i, _ := data.AsInt(v)
+		label = &i
+		values = []float64{float64(i)}
+	case data.TypeFloat:
+		f, _ := data.AsFloat(v)
+		values = []float64{f}
+	case data.TypeString:
+		s, _ := data.AsString(v)
+		text = &s
+	case data.TypeArray:
+		vec, err := toFloatVector(v)
+		if err != nil {
+			return nil, fmt.Errorf("prediction cannot be encoded as protobuf: %v", err)
+		}
+		values = vec
+	default:
+		return nil, fmt.Errorf("prediction of type %v cannot be encoded as protobuf",
+			v.Type())
+	}
+
+	var b []byte
+	tmp := make([]byte, binary.MaxVarintLen64)
+	appendUvarint := func(x uint64) {
+		n := binary.PutUvarint(tmp, x)
+		b = append(b, tmp[:n]...)
+	}
+
+	if len(values) > 0 {
+		appendUvarint(1<<3 | 2) // packed repeated double
+		appendUvarint(uint64(8 * len(values)))
+		for _, f := range values {
+			binary.LittleEndian.PutUint64(tmp, math.Float64bits(f))
+			b = append(b, tmp[:8]...)
+		}
+	}
+	if label != nil && *label != 0 {
+		appendUvarint(2 << 3) // varint
+		appendUvarint(uint64(*label))
+	}
+	if text != nil && *text != "" {
+		appendUvarint(3<<3 | 2) // length-delimited
+		appendUvarint(uint64(len(*text)))
+		b = append(b, *text...)
+	}
+	return b, nil
+}
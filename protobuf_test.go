@@ -0,0 +1,49 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestEncodePredictionProtobuf(t *testing.T) {
+	Convey("Given predictions", t, func() {
+		Convey("When encode an integer", func() {
+			b, err := encodePredictionProtobuf(data.Int(2))
+			Convey("Then it should have values and label", func() {
+				So(err, ShouldBeNil)
+				So(b, ShouldResemble, []byte{
+					0x0a, 0x08, 0, 0, 0, 0, 0, 0, 0, 0x40, // values: [2.0]
+					0x10, 0x02, // label: 2
+				})
+			})
+		})
+
+		Convey("When encode an array of numbers", func() {
+			b, err := encodePredictionProtobuf(data.Array{data.Float(1), data.Int(0)})
+			Convey("Then it should have packed values", func() {
+				So(err, ShouldBeNil)
+				So(b, ShouldResemble, []byte{
+					0x0a, 0x10,
+					0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // 1.0
+					0, 0, 0, 0, 0, 0, 0, 0, // 0.0
+				})
+			})
+		})
+
+		Convey("When encode a string", func() {
+			b, err := encodePredictionProtobuf(data.String("cat"))
+			Convey("Then it should have text", func() {
+				So(err, ShouldBeNil)
+				So(b, ShouldResemble, []byte{0x1a, 0x03, 'c', 'a', 't'})
+			})
+		})
+
+		Convey("When encode a map", func() {
+			_, err := encodePredictionProtobuf(data.Map{})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package pymlstate
+
+import (
+	"errors"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"os"
+)
+
+// errQuiesced is returned by Write after the state is quiesced.
+var errQuiesced = errors.New("the state is quiesced and doesn't accept tuples")
+
+// Quiesce prepares the state for termination without losing tuples. It makes
+// subsequent Write calls fail, trains the model with tuples remaining in the
+// bucket, and saves the state to checkpoint_path when it's given. When
+// async_fit is true, it waits for batches in the fit queue to be trained
+// before training the remaining tuples and saving the checkpoint. The state
+// can still be used for prediction, and it's safe to terminate it once
+// Quiesce returns. Quiesce on a quiesced state only saves the checkpoint
+// again.
+func (s *State) Quiesce(ctx *core.Context) error {
+	s.rwm.Lock()
+	if err := s.checkTermination(); err != nil {
+		s.rwm.Unlock()
+		return err
+	}
+	s.quiesced = true
+	s.rwm.Unlock()
+
+	// No batch is taken after quiesced is set, so all batches written before
+	// Quiesce are trained once this returns.
+	s.drainFitQueue()
+
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.checkTermination(); err != nil {
+		return err
+	}
+
+	if len(s.bucket) > 0 {
+		if _, err := s.fit(ctx, s.bucket); err != nil {
+			ctx.ErrLog(err).WithField("bucket_size", len(s.bucket)).
+				Error("pymlstate's training of remaining tuples on quiesce failed")
+			return err
+		}
+		s.bucket = s.bucket[:0]
+	}
+
+	if s.params.CheckpointPath == "" {
+		return nil
+	}
+	return s.saveFile(ctx, s.params.CheckpointPath)
+}
+
+// saveFile saves the state to path in the same format as Save. The file is
+// replaced atomically so that a partially written file isn't left at path.
+// The caller must hold the lock.
+func (s *State) saveFile(ctx *core.Context, path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := s.save(ctx, f, data.Map{}); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Quiesce stops accepting tuples, trains the model with remaining tuples, and
+// saves a checkpoint if configured, so that the state can be dropped without
+// losing tuples. It returns NULL.
+func Quiesce(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Quiesce(ctx); err != nil {
+		return nil, err
+	}
+	return data.Null{}, nil
+}
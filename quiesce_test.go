@@ -0,0 +1,74 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPyMLStateQuiesce(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate having tuples in the bucket", t, func() {
+		dir, err := ioutil.TempDir("", "pymlstate_quiesce")
+		So(err, ShouldBeNil)
+		path := filepath.Join(dir, "model.state")
+
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		mlParams := &MLParams{
+			BatchSize:      3,
+			CheckpointPath: path,
+		}
+		s, err := New(baseParams, mlParams, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+			os.RemoveAll(dir)
+		})
+		for i := 0; i < 2; i++ {
+			So(s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(i)}}), ShouldBeNil)
+		}
+
+		Convey("When quiesce the state", func() {
+			So(s.Quiesce(ctx), ShouldBeNil)
+
+			Convey("Then remaining tuples should be trained", func() {
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, 1)
+				So(len(s.bucket), ShouldEqual, 0)
+				So(s.Status()["quiesced"], ShouldEqual, data.True)
+			})
+
+			Convey("Then write should fail", func() {
+				err := s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(0)}})
+				So(err, ShouldEqual, errQuiesced)
+			})
+
+			Convey("Then the checkpoint should be loadable after termination", func() {
+				So(s.Terminate(ctx), ShouldBeNil)
+
+				f, err := os.Open(path)
+				So(err, ShouldBeNil)
+				defer f.Close()
+				sc := &StateCreator{}
+				st, err := sc.LoadState(ctx, f, data.Map{})
+				So(err, ShouldBeNil)
+				s2 := st.(*State)
+				defer s2.Terminate(ctx)
+				cnt, err := s2.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+)
+
+// replayBuffer retains the last batches given to fit so that a batch making
+// fit fail can be dumped and replayed offline.
+type replayBuffer struct {
+	m       sync.Mutex
+	batches []data.Map
+	next    int
+	full    bool
+	index   int64
+}
+
+func newReplayBuffer(size int) *replayBuffer {
+	return &replayBuffer{
+		batches: make([]data.Map, size),
+	}
+}
+
+// add retains a copy of batch and returns its index, which starts from 0.
+func (r *replayBuffer) add(batch []data.Value) int64 {
+	r.m.Lock()
+	defer r.m.Unlock()
+	idx := r.index
+	r.index++
+	r.batches[r.next] = data.Map{
+		"batch_index": data.Int(idx),
+		"batch":       data.Array(batch).Copy(),
+	}
+	r.next++
+	if r.next == len(r.batches) {
+		r.next = 0
+		r.full = true
+	}
+	return idx
+}
+
+// recent returns retained batches from the oldest one.
+func (r *replayBuffer) recent() data.Array {
+	r.m.Lock()
+	defer r.m.Unlock()
+	res := data.Array{}
+	if r.full {
+		for _, b := range r.batches[r.next:] {
+			res = append(res, b)
+		}
+	}
+	for _, b := range r.batches[:r.next] {
+		res = append(res, b)
+	}
+	return res
+}
+
+// dump reports the batch of idx which made fit fail with err. The dump has
+// "batch_index", "error", and "batches", which has the retained batches
+// including the failed one as the last element. It's written to a file in
+// dir when dir isn't empty, and to the log otherwise.
+func (r *replayBuffer) dump(ctx *core.Context, dir string, idx int64, fitErr error) {
+	d := data.Map{
+		"batch_index": data.Int(idx),
+		"error":       data.String(fitErr.Error()),
+		"batches":     r.recent(),
+	}
+
+	l := ctx.ErrLog(fitErr).WithField("batch_index", idx)
+	if dir == "" {
+		l.WithField("replay", d.String()).
+			Error("pymlstate's fit failed, dumping the replay buffer")
+		return
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("replay-%d.json", idx))
+	if err := ioutil.WriteFile(path, []byte(d.String()), 0644); err != nil {
+		ctx.ErrLog(err).WithField("path", path).
+			Error("Cannot write the replay buffer of pymlstate")
+		return
+	}
+	l.WithField("path", path).
+		Error("pymlstate's fit failed, the replay buffer was dumped")
+}
@@ -0,0 +1,68 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplayBuffer(t *testing.T) {
+	Convey("Given a replay buffer", t, func() {
+		r := newReplayBuffer(2)
+
+		Convey("When add more batches than its size", func() {
+			for i := 0; i < 3; i++ {
+				So(r.add([]data.Value{data.Int(i)}), ShouldEqual, i)
+			}
+			Convey("Then only the last batches should be retained", func() {
+				So(r.recent(), ShouldResemble, data.Array{
+					data.Map{"batch_index": data.Int(1), "batch": data.Array{data.Int(1)}},
+					data.Map{"batch_index": data.Int(2), "batch": data.Array{data.Int(2)}},
+				})
+			})
+		})
+	})
+}
+
+func TestPyMLStateReplayDump(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with replay_buffer", t, func() {
+		dir, err := ioutil.TempDir("", "pymlstate_replay")
+		So(err, ShouldBeNil)
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "EchoClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:      1,
+			ReplayBuffer:   2,
+			ReplayDumpPath: dir,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+			os.RemoveAll(dir)
+		})
+
+		Convey("When fit fails", func() {
+			_, err := s.Fit(ctx, []data.Value{data.String("ok")})
+			So(err, ShouldBeNil)
+			_, err = s.Fit(ctx, []data.Value{data.String("crash")})
+			So(err, ShouldNotBeNil)
+
+			Convey("Then the failed batch should be dumped with its index", func() {
+				b, err := ioutil.ReadFile(filepath.Join(dir, "replay-1.json"))
+				So(err, ShouldBeNil)
+				So(string(b), ShouldContainSubstring, "crash")
+				So(string(b), ShouldContainSubstring, "ok")
+			})
+		})
+	})
+}
@@ -0,0 +1,56 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// compileRetryErrors compiles retry_errors.
+func compileRetryErrors(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of retry_errors '%v': %v", p, err)
+		}
+		res[i] = re
+	}
+	return res, nil
+}
+
+// retryable returns true when err should be retried. Timeouts are never
+// retried because the timed out call is still running.
+func (s *State) retryable(err error) bool {
+	if _, ok := err.(*timeoutError); ok {
+		return false
+	}
+	if len(s.retryErrors) == 0 {
+		return true
+	}
+	msg := err.Error()
+	for _, re := range s.retryErrors {
+		if re.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// callWithRetry calls f up to retry_max_attempts times while it fails with a
+// retryable error. The wait before each retry starts from retry_backoff and
+// doubles every attempt.
+func (s *State) callWithRetry(f func() (data.Value, error)) (data.Value, error) {
+	wait := s.params.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		res, err := f()
+		if err == nil || attempt >= s.params.RetryMaxAttempts || !s.retryable(err) {
+			return res, err
+		}
+		atomic.AddInt64(&s.retries, 1)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
@@ -0,0 +1,88 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestPyMLStateRetry(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate whose fit fails twice", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "FlakyClass",
+		}
+		newState := func(attempts int, patterns ...string) *State {
+			s, err := New(baseParams, &MLParams{
+				BatchSize:        1,
+				RetryMaxAttempts: attempts,
+				RetryBackoff:     time.Millisecond,
+				RetryErrors:      patterns,
+			}, data.Map{})
+			So(err, ShouldBeNil)
+			return s
+		}
+
+		Convey("When fit is retried enough times", func() {
+			s := newState(3, "out of memory")
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			_, err := s.Fit(ctx, []data.Value{data.Int(1)})
+
+			Convey("Then it should succeed", func() {
+				So(err, ShouldBeNil)
+				So(s.Status()["retries"], ShouldEqual, data.Int(2))
+			})
+		})
+
+		Convey("When fit isn't retried enough times", func() {
+			s := newState(2)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			_, err := s.Fit(ctx, []data.Value{data.Int(1)})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(s.Status()["retries"], ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When the error doesn't match retry_errors", func() {
+			s := newState(3, "file lock")
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			_, err := s.Fit(ctx, []data.Value{data.Int(1)})
+
+			Convey("Then it shouldn't be retried", func() {
+				So(err, ShouldNotBeNil)
+				So(s.Status()["retries"], ShouldEqual, data.Int(0))
+			})
+		})
+	})
+
+	Convey("Given an invalid pattern of retry_errors", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "FlakyClass",
+		}
+		_, err := New(baseParams, &MLParams{
+			BatchSize:        1,
+			RetryMaxAttempts: 2,
+			RetryErrors:      []string{"("},
+		}, data.Map{})
+
+		Convey("Then the state shouldn't be created", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,595 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/bql/udf"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	routingFieldPath    = data.MustCompilePath("routing_field")
+	maxRoutedModelsPath = data.MustCompilePath("max_routed_models")
+	evictSavePathPath   = data.MustCompilePath("evict_save_path")
+)
+
+// RoutedStateCreator is used by BQL to create a RoutedState as a UDS.
+type RoutedStateCreator struct {
+}
+
+var _ udf.UDSCreator = &RoutedStateCreator{}
+
+// CreateState creates a RoutedState. It accepts the same parameters as
+// StateCreator and the following parameter:
+//
+// routing_field: a path to the field of a tuple whose value selects the
+// sub-model [required]
+//
+// max_routed_models: the maximum number of sub-models (default: 0, which
+// means no limit). When a new sub-model would exceed it, the least recently
+// used sub-model is evicted.
+//
+// evict_save_path: a directory to which evicted sub-models are saved
+// (default: ""). When it's empty, evicted sub-models are discarded.
+//
+// All other parameters are used as a template to create each sub-model.
+//
+// A LifecycleObserver registered by SetLifecycleObserver is notified of the
+// result.
+func (c *RoutedStateCreator) CreateState(ctx *core.Context, params data.Map) (
+	core.SharedState, error) {
+	name := observedName(params)
+	s, err := c.createState(ctx, params)
+	notifyCreate(name, err)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *RoutedStateCreator) createState(ctx *core.Context, params data.Map) (
+	*RoutedState, error) {
+	rp := &RoutedParams{}
+	rf, err := params.Get(routingFieldPath)
+	if err != nil {
+		return nil, err
+	}
+	if rp.RoutingField, err = data.AsString(rf); err != nil {
+		return nil, err
+	}
+	delete(params, "routing_field")
+
+	if mrm, err := params.Get(maxRoutedModelsPath); err == nil {
+		maxModels, err := data.AsInt(mrm)
+		if err != nil {
+			return nil, err
+		}
+		if maxModels < 0 {
+			return nil, fmt.Errorf("max_routed_models must not be negative")
+		}
+		rp.MaxModels = int(maxModels)
+		delete(params, "max_routed_models")
+	}
+
+	if esp, err := params.Get(evictSavePathPath); err == nil {
+		if rp.EvictSavePath, err = data.AsString(esp); err != nil {
+			return nil, err
+		}
+		delete(params, "evict_save_path")
+	}
+
+	bp, err := pystate.ExtractBaseParams(params, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateWorkerID(params); err != nil {
+		return nil, err
+	}
+
+	mp, err := extractMLParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mergeConstructorArgs(params); err != nil {
+		return nil, err
+	}
+
+	return NewRouted(rp, bp, mp, params)
+}
+
+// RoutedParams is parameters of RoutedState.
+type RoutedParams struct {
+	// RoutingField is a path to the field of a tuple whose value selects the
+	// sub-model.
+	RoutingField string
+
+	// MaxModels is the maximum number of sub-models. When a new sub-model
+	// would exceed it, the least recently used sub-model is evicted: it's
+	// saved to EvictSavePath if it's given, and terminated. 0 means no limit.
+	MaxModels int
+
+	// EvictSavePath is a directory to which evicted sub-models are saved. A
+	// sub-model is saved as a file named after its escaped routing key with
+	// ".state" extension. When the routing key is given again, the sub-model
+	// is restored from the file instead of being created from the template,
+	// and Predict can also restore it. Tuples left in the bucket of an
+	// evicted sub-model are discarded.
+	EvictSavePath string
+}
+
+// RoutedState holds multiple States keyed by the value of a tuple field, which
+// is called a routing key. Each sub-model is lazily created from the same
+// template parameters when a new routing key is given to Write or Fit.
+type RoutedState struct {
+	routingField  string
+	routingPath   data.Path
+	idPath        data.Path
+	maxModels     int
+	evictSavePath string
+
+	baseParams pystate.BaseParams
+	mlParams   MLParams
+	params     data.Map
+
+	states map[string]*State
+
+	// lastUsed has the time each sub-model was last used in Unix nanoseconds.
+	// Values are updated atomically so that they can be updated while
+	// holding the read lock.
+	lastUsed map[string]*int64
+	evicted  int64
+
+	// pins has the number of calls using each sub-model. pending has
+	// channels closed when sub-models being created or evicted without
+	// holding the lock are ready. creating is the number of sub-models being
+	// created.
+	pins     map[string]*sync.WaitGroup
+	pending  map[string]chan struct{}
+	creating int
+	rwm      sync.RWMutex
+}
+
+// NewRouted creates a RoutedState. baseParams, mlParams, and params are used
+// to create each sub-model.
+func NewRouted(rp *RoutedParams, baseParams *pystate.BaseParams,
+	mlParams *MLParams, params data.Map) (*RoutedState, error) {
+	p, err := data.CompilePath(rp.RoutingField)
+	if err != nil {
+		return nil, err
+	}
+	var idPath data.Path
+	if mlParams.IDField != "" {
+		if idPath, err = data.CompilePath(mlParams.IDField); err != nil {
+			return nil, err
+		}
+	}
+
+	return &RoutedState{
+		routingField:  rp.RoutingField,
+		routingPath:   p,
+		idPath:        idPath,
+		maxModels:     rp.MaxModels,
+		evictSavePath: rp.EvictSavePath,
+		baseParams:    *baseParams,
+		mlParams:      *mlParams,
+		params:        params,
+		states:        map[string]*State{},
+		lastUsed:      map[string]*int64{},
+		pins:          map[string]*sync.WaitGroup{},
+		pending:       map[string]chan struct{}{},
+	}, nil
+}
+
+// Terminate terminates all sub-models after calls using them return.
+func (r *RoutedState) Terminate(ctx *core.Context) error {
+	r.rwm.Lock()
+	states, pins := r.states, r.pins
+	r.states = nil
+	r.pins = nil
+	r.lastUsed = nil
+	r.rwm.Unlock()
+
+	var lastErr error
+	for k, s := range states {
+		pins[k].Wait()
+		if err := s.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).WithField("routing_key", k).
+				Error("Cannot terminate a sub-model of pymlstate")
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Write routes a tuple to the sub-model selected by its routing key.
+func (r *RoutedState) Write(ctx *core.Context, t *core.Tuple) error {
+	key, err := r.routingKey(t.Data)
+	if err != nil {
+		return err
+	}
+
+	return r.withModel(ctx, key, true, func(s *State) error {
+		return s.Write(ctx, t)
+	})
+}
+
+// Fit splits bucket by routing keys and trains each sub-model with its own
+// part. Each element of bucket must be a `data.Map` having the routing field.
+// It returns a `data.Map` whose keys are routing keys and values are results
+// of fit.
+func (r *RoutedState) Fit(ctx *core.Context, bucket []data.Value) (data.Value, error) {
+	buckets := map[string][]data.Value{}
+	for _, v := range bucket {
+		m, err := data.AsMap(v)
+		if err != nil {
+			return nil, err
+		}
+		key, err := r.routingKey(m)
+		if err != nil {
+			return nil, err
+		}
+		buckets[key] = append(buckets[key], v)
+	}
+
+	res := data.Map{}
+	for key, b := range buckets {
+		var v data.Value
+		if err := r.withModel(ctx, key, true, func(s *State) (err error) {
+			v, err = s.Fit(ctx, b)
+			return
+		}); err != nil {
+			return nil, err
+		}
+		res[key] = v
+	}
+	return res, nil
+}
+
+// Predict applies the sub-model selected by the routing key of dt. dt must be
+// a `data.Map` having the routing field. It returns an error when no
+// sub-model has been created for the routing key and it cannot be restored
+// from evict_save_path.
+func (r *RoutedState) Predict(ctx *core.Context, dt data.Value) (data.Value, error) {
+	m, err := data.AsMap(dt)
+	if err != nil {
+		return nil, err
+	}
+	key, err := r.routingKey(m)
+	if err != nil {
+		return nil, err
+	}
+	return r.PredictKey(ctx, key, dt)
+}
+
+// PredictKey applies the sub-model of the routing key to dt, which doesn't
+// have to have the routing field. It returns an error when no sub-model has
+// been created for the key and it cannot be restored from evict_save_path.
+func (r *RoutedState) PredictKey(ctx *core.Context, key string, dt data.Value) (data.Value, error) {
+	var res data.Value
+	if err := r.withModel(ctx, key, false, func(s *State) (err error) {
+		res, err = s.Predict(ctx, dt)
+		return
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CheckpointAll saves all sub-models to evict_save_path in the same way as
+// eviction, so that they can be restored after a restart. It returns a
+// `data.Map` from routing keys to paths of saved files.
+func (r *RoutedState) CheckpointAll(ctx *core.Context) (data.Map, error) {
+	if r.evictSavePath == "" {
+		return nil, fmt.Errorf("evict_save_path is required to checkpoint sub-models")
+	}
+	r.rwm.RLock()
+	defer r.rwm.RUnlock()
+	res := data.Map{}
+	for k, s := range r.states {
+		if err := r.checkpoint(ctx, k, s); err != nil {
+			return nil, fmt.Errorf("cannot checkpoint the sub-model of routing key '%v': %v", k, err)
+		}
+		res[k] = data.String(r.savePath(k))
+	}
+	return res, nil
+}
+
+func (r *RoutedState) formatPrediction(v data.Value) (data.Value, error) {
+	return formatPrediction(&r.mlParams, v)
+}
+
+// Status returns the status of all sub-models keyed by their routing keys.
+func (r *RoutedState) Status() data.Map {
+	r.rwm.RLock()
+	defer r.rwm.RUnlock()
+	models := data.Map{}
+	lastUsed := data.Map{}
+	for k, s := range r.states {
+		models[k] = s.Status()
+		lastUsed[k] = data.Timestamp(time.Unix(0, atomic.LoadInt64(r.lastUsed[k])))
+	}
+	return data.Map{
+		"routing_field":     data.String(r.routingField),
+		"num_models":        data.Int(len(r.states)),
+		"models":            models,
+		"max_routed_models": data.Int(r.maxModels),
+		"evicted_models":    data.Int(atomic.LoadInt64(&r.evicted)),
+		"last_used":         lastUsed,
+	}
+}
+
+func (r *RoutedState) routingKey(m data.Map) (string, error) {
+	v, err := m.Get(r.routingPath)
+	if err != nil {
+		return "", fmt.Errorf("routing field '%v' is missing: %v", r.routingField, err)
+	}
+	return data.ToString(v)
+}
+
+// withModel calls f with the sub-model of key. The sub-model is pinned during
+// the call so that its eviction waits for the call before saving and
+// terminating it, while calls of other sub-models aren't blocked. When no
+// sub-model exists for key, it's restored from evict_save_path if it has been
+// saved there, and otherwise created only when create is true.
+func (r *RoutedState) withModel(ctx *core.Context, key string, create bool,
+	f func(s *State) error) error {
+	for {
+		r.rwm.RLock()
+		s, ok := r.states[key]
+		pin := r.pins[key]
+		if ok {
+			r.touch(key)
+			pin.Add(1)
+		}
+		done, busy := r.pending[key]
+		r.rwm.RUnlock()
+		if ok {
+			defer pin.Done()
+			return f(s)
+		}
+		if busy {
+			// The sub-model is being created or evicted.
+			<-done
+			continue
+		}
+
+		if !create && !r.saved(key) {
+			return fmt.Errorf("no model exists for routing key '%v'", key)
+		}
+		// The new sub-model can be evicted by other goroutines before it's
+		// pinned, so it's looked up again in the loop.
+		if err := r.createModel(ctx, key); err != nil {
+			return err
+		}
+	}
+}
+
+// eviction is a sub-model removed from RoutedState to be evicted.
+type eviction struct {
+	key      string
+	s        *State
+	pin      *sync.WaitGroup
+	lastUsed *int64
+	done     chan struct{}
+}
+
+// createModel creates the sub-model of key or restores it from
+// evict_save_path. It does nothing when the sub-model already exists, and
+// waits for another goroutine creating or evicting it. When there're
+// max_routed_models sub-models, the least recently used one is evicted
+// first. The lock isn't held while sub-models are created and evicted.
+func (r *RoutedState) createModel(ctx *core.Context, key string) error {
+	r.rwm.Lock()
+	if r.states == nil {
+		r.rwm.Unlock()
+		return fmt.Errorf("the state has already been terminated")
+	}
+	if _, ok := r.states[key]; ok {
+		r.rwm.Unlock()
+		return nil
+	}
+	if done, ok := r.pending[key]; ok {
+		r.rwm.Unlock()
+		<-done
+		return nil
+	}
+	var ev *eviction
+	if r.maxModels > 0 && len(r.states)+r.creating >= r.maxModels {
+		ev = r.takeLRU()
+	}
+	done := make(chan struct{})
+	r.pending[key] = done
+	r.creating++
+	r.rwm.Unlock()
+
+	s, err := r.newModel(ctx, key, ev)
+
+	r.rwm.Lock()
+	defer r.rwm.Unlock()
+	r.creating--
+	delete(r.pending, key)
+	close(done)
+	if err != nil {
+		return err
+	}
+	if r.states == nil {
+		s.Terminate(ctx)
+		return fmt.Errorf("the state has already been terminated")
+	}
+	r.states[key] = s
+	r.pins[key] = &sync.WaitGroup{}
+	r.lastUsed[key] = new(int64)
+	r.touch(key)
+	return nil
+}
+
+// newModel evicts ev when it isn't nil and creates the sub-model of key.
+func (r *RoutedState) newModel(ctx *core.Context, key string, ev *eviction) (*State, error) {
+	if ev != nil {
+		if err := r.evict(ctx, ev); err != nil {
+			return nil, err
+		}
+	}
+	if r.saved(key) {
+		return r.restore(ctx, key)
+	}
+	bp := r.baseParams
+	return New(&bp, &r.mlParams, r.params.Copy().(data.Map))
+}
+
+// touch records that the sub-model of key is used now. The caller must hold
+// the lock.
+func (r *RoutedState) touch(key string) {
+	atomic.StoreInt64(r.lastUsed[key], time.Now().UnixNano())
+}
+
+// takeLRU removes the least recently used sub-model so that it can be
+// evicted by evict without holding the lock. It returns nil when there's no
+// sub-model. The caller must hold the write lock.
+func (r *RoutedState) takeLRU() *eviction {
+	lruKey := ""
+	var lruTime int64
+	for k, t := range r.lastUsed {
+		if lt := atomic.LoadInt64(t); lruKey == "" || lt < lruTime {
+			lruKey, lruTime = k, lt
+		}
+	}
+	if lruKey == "" {
+		return nil
+	}
+
+	ev := &eviction{
+		key:      lruKey,
+		s:        r.states[lruKey],
+		pin:      r.pins[lruKey],
+		lastUsed: r.lastUsed[lruKey],
+		done:     make(chan struct{}),
+	}
+	delete(r.states, lruKey)
+	delete(r.pins, lruKey)
+	delete(r.lastUsed, lruKey)
+	r.pending[lruKey] = ev.done
+	return ev
+}
+
+// evict waits for calls using the sub-model taken by takeLRU, saves it to
+// evict_save_path when it's given, and terminates it. When it cannot be
+// saved, the sub-model is put back because it cannot be restored later. It
+// must be called without holding the lock.
+func (r *RoutedState) evict(ctx *core.Context, ev *eviction) error {
+	ev.pin.Wait()
+	var err error
+	if r.evictSavePath != "" {
+		err = r.checkpoint(ctx, ev.key, ev.s)
+	}
+	if err == nil {
+		if terr := ev.s.Terminate(ctx); terr != nil {
+			ctx.ErrLog(terr).WithField("routing_key", ev.key).
+				Error("Cannot terminate an evicted sub-model of pymlstate")
+		}
+	}
+
+	r.rwm.Lock()
+	defer r.rwm.Unlock()
+	delete(r.pending, ev.key)
+	close(ev.done)
+	if err != nil {
+		if r.states == nil {
+			ev.s.Terminate(ctx)
+		} else {
+			r.states[ev.key] = ev.s
+			r.pins[ev.key] = ev.pin
+			r.lastUsed[ev.key] = ev.lastUsed
+		}
+		return err
+	}
+	atomic.AddInt64(&r.evicted, 1)
+	return nil
+}
+
+// savePath returns the path of the file to which the sub-model of key is
+// saved when it's evicted.
+func (r *RoutedState) savePath(key string) string {
+	return filepath.Join(r.evictSavePath, url.PathEscape(key)+".state")
+}
+
+// saved returns true when the sub-model of key has been saved on eviction.
+func (r *RoutedState) saved(key string) bool {
+	if r.evictSavePath == "" {
+		return false
+	}
+	_, err := os.Stat(r.savePath(key))
+	return err == nil
+}
+
+func lookupRoutedState(ctx *core.Context, stateName string) (*RoutedState, error) {
+	st, err := ctx.SharedStates.Get(stateName)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := st.(*RoutedState); ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("state '%v' isn't a RoutedState", stateName)
+}
+
+// PredictRouted applies the sub-model of the routing key of a RoutedState to
+// the data. Unlike Predict, the data doesn't have to have the routing field.
+// The result is formatted in the same way as Predict.
+func PredictRouted(ctx *core.Context, stateName string, key string, dt data.Value) (
+	data.Value, error) {
+	r, err := lookupRoutedState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.PredictKey(ctx, key, dt)
+	if err != nil {
+		return nil, err
+	}
+	if res, err = r.formatPrediction(res); err != nil {
+		return nil, err
+	}
+	return r.attachID(dt, res)
+}
+
+// CheckpointRouted saves all sub-models of a RoutedState to its
+// evict_save_path and returns a map from routing keys to saved files.
+func CheckpointRouted(ctx *core.Context, stateName string) (data.Value, error) {
+	r, err := lookupRoutedState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return r.CheckpointAll(ctx)
+}
+
+// checkpoint saves the sub-model of key to evict_save_path. The file is
+// replaced atomically so that a failed save doesn't leave a truncated file
+// regarded as restorable.
+func (r *RoutedState) checkpoint(ctx *core.Context, key string, s *State) error {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	return s.saveFile(ctx, r.savePath(key))
+}
+
+func (r *RoutedState) restore(ctx *core.Context, key string) (*State, error) {
+	f, err := os.Open(r.savePath(key))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := &State{}
+	if err := s.load(ctx, f, data.Map{}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
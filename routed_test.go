@@ -0,0 +1,247 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoutedState(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a routed state creator", t, func() {
+		sc := RoutedStateCreator{}
+		Convey("When create a routed state without routing_field", func() {
+			params := data.Map{
+				"module_path": data.String("./"),
+				"module_name": data.String("_test_pymlstate"),
+				"class_name":  data.String("TestClass"),
+			}
+			_, err := sc.CreateState(ctx, params)
+			Convey("Then creator should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When create a routed state", func() {
+			params := data.Map{
+				"module_path":      data.String("./"),
+				"module_name":      data.String("_test_pymlstate"),
+				"class_name":       data.String("TestClass"),
+				"batch_train_size": data.Int(2),
+				"routing_field":    data.String("tenant"),
+			}
+			st, err := sc.CreateState(ctx, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				st.Terminate(ctx)
+			})
+			rs, ok := st.(*RoutedState)
+			So(ok, ShouldBeTrue)
+
+			Convey("And when write tuples having different routing keys", func() {
+				for _, k := range []string{"a", "b", "a"} {
+					tu := &core.Tuple{
+						Data: data.Map{
+							"tenant": data.String(k),
+							"data":   data.String("1"),
+						},
+					}
+					So(rs.Write(ctx, tu), ShouldBeNil)
+				}
+
+				Convey("Then a sub-model should be created for each key", func() {
+					So(len(rs.states), ShouldEqual, 2)
+					ac, err := rs.states["a"].base.Call("confirm_to_call_fit")
+					So(err, ShouldBeNil)
+					So(ac, ShouldEqual, 1)
+					bc, err := rs.states["b"].base.Call("confirm_to_call_fit")
+					So(err, ShouldBeNil)
+					So(bc, ShouldEqual, 0)
+				})
+
+				Convey("Then status should have each key", func() {
+					st := rs.Status()
+					So(st["num_models"], ShouldEqual, data.Int(2))
+					models, err := data.AsMap(st["models"])
+					So(err, ShouldBeNil)
+					So(models, ShouldContainKey, "a")
+					So(models, ShouldContainKey, "b")
+				})
+
+				Convey("Then predict should be routed by the key", func() {
+					ac, err := rs.Predict(ctx, data.Map{"tenant": data.String("b")})
+					So(err, ShouldBeNil)
+					So(ac, ShouldEqual, "predict called")
+				})
+
+				Convey("Then predict with an explicit key should use its sub-model", func() {
+					ac, err := rs.PredictKey(ctx, "a", data.Int(1))
+					So(err, ShouldBeNil)
+					So(ac, ShouldEqual, "predict called")
+					_, err = rs.PredictKey(ctx, "c", data.Int(1))
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("Then checkpoint without evict_save_path should fail", func() {
+					_, err := rs.CheckpointAll(ctx)
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("Then predict with an unknown key should fail", func() {
+					_, err := rs.Predict(ctx, data.Map{"tenant": data.String("c")})
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("When create a routed state with max_routed_models", func() {
+			dir, err := ioutil.TempDir("", "pymlstate_routed")
+			So(err, ShouldBeNil)
+			params := data.Map{
+				"module_path":       data.String("./"),
+				"module_name":       data.String("_test_pymlstate"),
+				"class_name":        data.String("TestClass"),
+				"routing_field":     data.String("tenant"),
+				"max_routed_models": data.Int(1),
+				"evict_save_path":   data.String(dir),
+			}
+			st, err := sc.CreateState(ctx, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				st.Terminate(ctx)
+				os.RemoveAll(dir)
+			})
+			rs, ok := st.(*RoutedState)
+			So(ok, ShouldBeTrue)
+
+			Convey("And when write tuples having different routing keys", func() {
+				for _, k := range []string{"a", "b"} {
+					tu := &core.Tuple{
+						Data: data.Map{
+							"tenant": data.String(k),
+							"data":   data.String("1"),
+						},
+					}
+					So(rs.Write(ctx, tu), ShouldBeNil)
+				}
+
+				Convey("Then the least recently used sub-model should be evicted", func() {
+					So(len(rs.states), ShouldEqual, 1)
+					So(rs.states, ShouldContainKey, "b")
+					st := rs.Status()
+					So(st["evicted_models"], ShouldEqual, data.Int(1))
+					lastUsed, err := data.AsMap(st["last_used"])
+					So(err, ShouldBeNil)
+					So(lastUsed, ShouldContainKey, "b")
+				})
+
+				Convey("Then the evicted sub-model should be saved", func() {
+					_, err := os.Stat(filepath.Join(dir, "a.state"))
+					So(err, ShouldBeNil)
+				})
+
+				Convey("Then active sub-models should be checkpointed", func() {
+					res, err := rs.CheckpointAll(ctx)
+					So(err, ShouldBeNil)
+					So(res, ShouldResemble, data.Map{
+						"b": data.String(filepath.Join(dir, "b.state")),
+					})
+					_, err = os.Stat(filepath.Join(dir, "b.state"))
+					So(err, ShouldBeNil)
+				})
+
+				Convey("Then predict should restore the evicted sub-model", func() {
+					ac, err := rs.Predict(ctx, data.Map{"tenant": data.String("a")})
+					So(err, ShouldBeNil)
+					So(ac, ShouldEqual, "predict called")
+					cnt, err := rs.states["a"].base.Call("confirm_to_call_fit")
+					So(err, ShouldBeNil)
+					So(cnt, ShouldEqual, 1)
+				})
+
+				Convey("Then concurrent predicts shouldn't use sub-models being evicted", func() {
+					var wg sync.WaitGroup
+					errs := make([]error, 20)
+					for i := range errs {
+						wg.Add(1)
+						go func(i int) {
+							defer wg.Done()
+							key := []string{"a", "b"}[i%2]
+							_, errs[i] = rs.PredictKey(ctx, key, data.Int(1))
+						}(i)
+					}
+					wg.Wait()
+					for _, err := range errs {
+						So(err, ShouldBeNil)
+					}
+				})
+			})
+		})
+
+		Convey("When create a routed state with max_routed_models = 2", func() {
+			dir, err := ioutil.TempDir("", "pymlstate_routed")
+			So(err, ShouldBeNil)
+			params := data.Map{
+				"module_path":       data.String("./"),
+				"module_name":       data.String("_test_pymlstate"),
+				"class_name":        data.String("TestClass"),
+				"routing_field":     data.String("tenant"),
+				"max_routed_models": data.Int(2),
+				"evict_save_path":   data.String(dir),
+			}
+			st, err := sc.CreateState(ctx, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				st.Terminate(ctx)
+				os.RemoveAll(dir)
+			})
+			rs, ok := st.(*RoutedState)
+			So(ok, ShouldBeTrue)
+			for _, k := range []string{"a", "b"} {
+				So(rs.Write(ctx, &core.Tuple{Data: data.Map{
+					"tenant": data.String(k),
+					"data":   data.String("1"),
+				}}), ShouldBeNil)
+			}
+
+			Convey("And when the least recently used sub-model is in use while a new one is created", func() {
+				pin := rs.pins["a"]
+				pin.Add(1)
+				created := make(chan error, 1)
+				go func() {
+					created <- rs.Write(ctx, &core.Tuple{Data: data.Map{
+						"tenant": data.String("c"),
+						"data":   data.String("1"),
+					}})
+				}()
+
+				Convey("Then the eviction should wait only for the sub-model", func() {
+					_, err := rs.PredictKey(ctx, "b", data.Int(1))
+					So(err, ShouldBeNil)
+					var werr error
+					waiting := true
+					select {
+					case werr = <-created:
+						waiting = false
+					case <-time.After(20 * time.Millisecond):
+					}
+					pin.Done()
+					if waiting {
+						werr = <-created
+					}
+					So(waiting, ShouldBeTrue)
+					So(werr, ShouldBeNil)
+					_, err = os.Stat(filepath.Join(dir, "a.state"))
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,57 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strconv"
+)
+
+// validateClassScores validates parameters of predict_as_scores.
+func validateClassScores(asScores bool, names []string, numClasses int, format string) error {
+	if numClasses < 0 {
+		return fmt.Errorf("num_classes must not be negative")
+	}
+	if len(names) > 0 && numClasses > 0 && len(names) != numClasses {
+		return fmt.Errorf("class_names has %v names but num_classes is %v",
+			len(names), numClasses)
+	}
+	if !asScores {
+		return nil
+	}
+	if len(names) == 0 && numClasses == 0 {
+		return fmt.Errorf("predict_as_scores requires class_names or num_classes")
+	}
+	if format == predictFormatProtobuf {
+		return fmt.Errorf("predict_as_scores cannot be used with predict_format '%v'",
+			predictFormatProtobuf)
+	}
+	return nil
+}
+
+// classScores converts an array of scores into a `data.Map` from a class name
+// to its score. When names is empty, indices written as strings are used as
+// names.
+func classScores(names []string, numClasses int, v data.Value) (data.Value, error) {
+	arr, err := data.AsArray(v)
+	if err != nil {
+		return nil, fmt.Errorf("prediction must be an array of scores: %v", err)
+	}
+	n := numClasses
+	if len(names) > 0 {
+		n = len(names)
+	}
+	if len(arr) != n {
+		return nil, fmt.Errorf("prediction has %v scores but there are %v classes",
+			len(arr), n)
+	}
+
+	m := make(data.Map, n)
+	for i, s := range arr {
+		if len(names) > 0 {
+			m[names[i]] = s
+		} else {
+			m[strconv.Itoa(i)] = s
+		}
+	}
+	return m, nil
+}
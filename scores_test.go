@@ -0,0 +1,70 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestClassScores(t *testing.T) {
+	Convey("Given an MNIST-style output having 10 scores", t, func() {
+		out := make(data.Array, 10)
+		for i := range out {
+			out[i] = data.Float(float64(i) / 45)
+		}
+
+		Convey("When convert it with num_classes", func() {
+			v, err := formatPrediction(&MLParams{PredictAsScores: true, NumClasses: 10}, out)
+			Convey("Then it should be keyed by class indices", func() {
+				So(err, ShouldBeNil)
+				m, err := data.AsMap(v)
+				So(err, ShouldBeNil)
+				So(len(m), ShouldEqual, 10)
+				So(m["0"], ShouldEqual, data.Float(0))
+				So(m["9"], ShouldEqual, data.Float(0.2))
+			})
+		})
+
+		Convey("When convert it with class_names", func() {
+			names := []string{"zero", "one", "two", "three", "four", "five",
+				"six", "seven", "eight", "nine"}
+			v, err := classScores(names, 0, out)
+			Convey("Then it should be keyed by class names", func() {
+				So(err, ShouldBeNil)
+				m, err := data.AsMap(v)
+				So(err, ShouldBeNil)
+				So(m["nine"], ShouldEqual, data.Float(0.2))
+			})
+		})
+
+		Convey("When convert it with a different number of classes", func() {
+			_, err := classScores(nil, 5, out)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given parameters of predict_as_scores", t, func() {
+		Convey("When neither class_names nor num_classes is given", func() {
+			err := validateClassScores(true, nil, 0, predictFormatRaw)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When class_names and num_classes don't match", func() {
+			err := validateClassScores(true, []string{"a", "b"}, 3, predictFormatRaw)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When it's used with protobuf format", func() {
+			err := validateClassScores(true, nil, 2, predictFormatProtobuf)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,155 @@
+package pymlstate
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// selfTestBatchSize is the number of synthetic samples used by SelfTest.
+const selfTestBatchSize = 2
+
+// syntheticSample returns a sample of zeros. When shape is empty, the shape is
+// inferred from feature_order or the recorded feature dimension. The caller
+// must hold the lock.
+func (s *State) syntheticSample(shape []int) (data.Value, error) {
+	if len(shape) == 0 {
+		if len(s.featurePaths) > 0 {
+			m := data.Map{}
+			for _, p := range s.featurePaths {
+				if err := m.Set(p, data.Float(0)); err != nil {
+					return nil, err
+				}
+			}
+			return m, nil
+		}
+		if s.expectedDim == 0 {
+			return nil, fmt.Errorf("the shape of the input must be given because the feature dimension is unknown")
+		}
+		shape = []int{s.expectedDim}
+	}
+	return zeros(shape)
+}
+
+// zeros returns a nested `data.Array` of zeros having the shape.
+func zeros(shape []int) (data.Value, error) {
+	if shape[0] <= 0 {
+		return nil, fmt.Errorf("each dimension of the shape must be greater than 0")
+	}
+	arr := make(data.Array, shape[0])
+	for i := range arr {
+		if len(shape) == 1 {
+			arr[i] = data.Float(0)
+			continue
+		}
+		v, err := zeros(shape[1:])
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+	return arr, nil
+}
+
+// scratchInstance creates a throwaway Python instance used by SelfTest. It's
+// created with the parameters given to New, or by saving and loading the
+// model when the state was loaded. The caller must hold the lock.
+func (s *State) scratchInstance(ctx *core.Context) (*pystate.Base, error) {
+	if s.baseParams != nil {
+		return newBase(s.baseParams, s.createParams)
+	}
+	b, err := s.py()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.timeouts.checkOutstanding(); err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	s.modelM.RLock()
+	err = b.Save(ctx, buf, data.Map{})
+	s.modelM.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return pystate.LoadBase(ctx, buf, data.Map{})
+}
+
+// SelfTest runs fit and predict with a tiny synthetic batch of zeros to check
+// that the Python class, conversions, and the state work end-to-end. The
+// shape of each sample is given by shape, e.g. [28, 28], or inferred from
+// feature_order or the feature dimension of the first fit when it's empty.
+//
+// The test runs on a throwaway instance of the class, which is terminated
+// afterwards, so the deployed model isn't trained with the synthetic batch.
+// It doesn't affect the state either: fit statistics, early stopping, drift
+// statistics, save_best, checkpoints, and feedback aren't updated.
+//
+// It returns a `data.Map` having "passed", which is true when both fit and
+// predict succeeded, "stage", which is the stage that failed, and "error".
+// "stage" and "error" are null when the test passed. "stage" is "instance"
+// when the throwaway instance cannot be created.
+func (s *State) SelfTest(ctx *core.Context, shape []int) data.Map {
+	res := data.Map{
+		"passed": data.False,
+		"stage":  data.Null{},
+		"error":  data.Null{},
+	}
+	fail := func(stage string, err error) data.Map {
+		res["stage"] = data.String(stage)
+		res["error"] = data.String(err.Error())
+		return res
+	}
+
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	sample, err := s.syntheticSample(shape)
+	if err != nil {
+		return fail("input", err)
+	}
+	batch := make([]data.Value, selfTestBatchSize)
+	for i := range batch {
+		batch[i] = sample.Copy()
+	}
+	_, arg, err := s.convertSamples(batch)
+	if err != nil {
+		return fail("input", err)
+	}
+	dt, err := s.convertInput(sample)
+	if err != nil {
+		return fail("input", err)
+	}
+
+	b, err := s.scratchInstance(ctx)
+	if err != nil {
+		return fail("instance", err)
+	}
+	defer func() {
+		if err := b.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Error("pymlstate cannot terminate the instance used by the self test")
+		}
+	}()
+
+	if _, err := b.Call(s.fitMethod(), arg); err != nil {
+		return fail("fit", err)
+	}
+	if _, err := b.Call(s.predictMethod(), s.sparsify(dt)); err != nil {
+		return fail("predict", err)
+	}
+	res["passed"] = data.True
+	return res
+}
+
+// SelfTest runs fit and predict of the class of the state with a synthetic
+// batch on a throwaway instance and returns whether they succeeded. The shape of each synthetic sample can be
+// given as additional arguments. See State.SelfTest for details.
+func SelfTest(ctx *core.Context, stateName string, shape ...int) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.SelfTest(ctx, shape), nil
+}
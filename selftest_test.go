@@ -0,0 +1,106 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestZeros(t *testing.T) {
+	Convey("Given a shape", t, func() {
+		Convey("When create zeros of a 2-dimensional shape", func() {
+			v, err := zeros([]int{2, 1})
+			Convey("Then it should be a nested array", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Array{
+					data.Array{data.Float(0)},
+					data.Array{data.Float(0)},
+				})
+			})
+		})
+
+		Convey("When create zeros of an invalid shape", func() {
+			_, err := zeros([]int{2, 0})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestPyMLStateSelfTest(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given pymlstates", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "EchoClass",
+		}
+
+		Convey("When run a self test with a shape", func() {
+			s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			res := s.SelfTest(ctx, []int{3})
+			Convey("Then it should pass", func() {
+				So(res["passed"], ShouldEqual, data.True)
+				So(res["error"], ShouldResemble, data.Null{})
+			})
+		})
+
+		Convey("When run a self test with feature_order", func() {
+			s, err := New(baseParams, &MLParams{
+				BatchSize:    1,
+				FeatureOrder: []string{"x", "y"},
+			}, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			res := s.SelfTest(ctx, nil)
+			Convey("Then it should pass", func() {
+				So(res["passed"], ShouldEqual, data.True)
+			})
+		})
+
+		Convey("When run a self test of a state having a trained model", func() {
+			s, err := New(&pystate.BaseParams{
+				ModulePath: "./",
+				ModuleName: "_test_pymlstate",
+				ClassName:  "TestClass",
+			}, &MLParams{BatchSize: 1}, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			So(s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(1)}}), ShouldBeNil)
+			res := s.SelfTest(ctx, []int{3})
+			So(res["passed"], ShouldEqual, data.True)
+
+			Convey("Then the live model and the state shouldn't be affected", func() {
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, data.Int(1))
+				So(s.stats.snapshot()["batches"], ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When run a self test without a known shape", func() {
+			s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+			res := s.SelfTest(ctx, nil)
+			Convey("Then it should fail at the input stage", func() {
+				So(res["passed"], ShouldEqual, data.False)
+				So(res["stage"], ShouldEqual, data.String("input"))
+			})
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package pymlstate
+
+import (
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// estimateSize returns the estimated size of v in bytes. Numbers and
+// timestamps are 8 bytes, strings and blobs are their lengths, and arrays and
+// maps are the sum of their elements including keys.
+func estimateSize(v data.Value) int64 {
+	switch v.Type() {
+	case data.TypeInt, data.TypeFloat, data.TypeTimestamp:
+		return 8
+	case data.TypeString:
+		s, _ := data.AsString(v)
+		return int64(len(s))
+	case data.TypeBlob:
+		b, _ := data.AsBlob(v)
+		return int64(len(b))
+	case data.TypeArray:
+		arr, _ := data.AsArray(v)
+		n := int64(0)
+		for _, e := range arr {
+			n += estimateSize(e)
+		}
+		return n
+	case data.TypeMap:
+		m, _ := data.AsMap(v)
+		n := int64(0)
+		for k, e := range m {
+			n += int64(len(k)) + estimateSize(e)
+		}
+		return n
+	default:
+		return 1
+	}
+}
+
+// recomputeBucketBytes recomputes bucketBytes from tuples in the bucket. It's
+// called when tuples are added or removed other than by Write.
+func (s *State) recomputeBucketBytes() {
+	s.bucketBytes = 0
+	if s.params.MaxBatchBytes <= 0 {
+		return
+	}
+	for _, v := range s.bucket {
+		s.bucketBytes += estimateSize(v)
+	}
+}
+
+// bucketTooLarge returns true when the estimated size of the bucket reaches
+// max_batch_bytes.
+func (s *State) bucketTooLarge() bool {
+	return s.params.MaxBatchBytes > 0 && s.bucketBytes >= s.params.MaxBatchBytes
+}
@@ -0,0 +1,57 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestEstimateSize(t *testing.T) {
+	Convey("Given values", t, func() {
+		Convey("When estimate their sizes", func() {
+			Convey("Then they should be estimated from their contents", func() {
+				So(estimateSize(data.Int(1)), ShouldEqual, 8)
+				So(estimateSize(data.String("abc")), ShouldEqual, 3)
+				So(estimateSize(data.Blob("abcd")), ShouldEqual, 4)
+				So(estimateSize(data.Array{data.Float(1), data.Float(2)}), ShouldEqual, 16)
+				So(estimateSize(data.Map{"ab": data.String("cd")}), ShouldEqual, 4)
+				So(estimateSize(data.Null{}), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestPyMLStateMaxBatchBytes(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with max_batch_bytes", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:     100,
+			MaxBatchBytes: 10,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When write tuples larger than the limit in total", func() {
+			for _, d := range []string{"aaaa", "bbbb", "cccc", "d"} {
+				So(s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.String(d)}}), ShouldBeNil)
+			}
+
+			Convey("Then fit should be triggered by the size", func() {
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, data.Int(1))
+				So(s.Status()["bucket_size"], ShouldEqual, data.Int(1))
+			})
+		})
+	})
+}
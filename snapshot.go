@@ -0,0 +1,70 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"os"
+)
+
+// SaveFile saves the state to path in the same format as SAVE STATE. The
+// file is replaced atomically.
+func (s *State) SaveFile(ctx *core.Context, path string) error {
+	if path == "" {
+		return fmt.Errorf("path must not be empty")
+	}
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	if err := s.checkTermination(); err != nil {
+		return err
+	}
+	return s.saveFile(ctx, path)
+}
+
+// LoadFile loads the state from path saved by SaveFile or SAVE STATE. The
+// model and parameters of the state are replaced by the loaded ones.
+func (s *State) LoadFile(ctx *core.Context, path string) error {
+	if path == "" {
+		return fmt.Errorf("path must not be empty")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.checkTermination(); err != nil {
+		return err
+	}
+	return s.load(ctx, f, data.Map{})
+}
+
+// Save saves the state to the file at path, independently of SAVE STATE, so
+// that ad-hoc snapshots can be taken from BQL. It returns NULL. See
+// State.SaveFile for details.
+func Save(ctx *core.Context, stateName string, path string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SaveFile(ctx, path); err != nil {
+		return nil, err
+	}
+	return data.Null{}, nil
+}
+
+// Load loads the state from the file at path, e.g. to warm-start the model
+// from a snapshot taken by pymlstate_save. It returns NULL. See
+// State.LoadFile for details.
+func Load(ctx *core.Context, stateName string, path string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.LoadFile(ctx, path); err != nil {
+		return nil, err
+	}
+	return data.Null{}, nil
+}
@@ -0,0 +1,63 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPyMLStateSaveLoadFile(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a trained pymlstate", t, func() {
+		dir, err := ioutil.TempDir("", "pymlstate_snapshot")
+		So(err, ShouldBeNil)
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("snapshot_test", "pymlstate", s), ShouldBeNil)
+		Reset(func() {
+			ctx.SharedStates.Remove("snapshot_test")
+			s.Terminate(ctx)
+			os.RemoveAll(dir)
+		})
+		_, err = s.Fit(ctx, []data.Value{data.Int(1)})
+		So(err, ShouldBeNil)
+		path := filepath.Join(dir, "model.state")
+		fitCount := func() data.Value {
+			cnt, err := s.base.Call("confirm_to_call_fit")
+			So(err, ShouldBeNil)
+			return cnt
+		}
+
+		Convey("When save it to a file and train it more", func() {
+			_, err := Save(ctx, "snapshot_test", path)
+			So(err, ShouldBeNil)
+			_, err = s.Fit(ctx, []data.Value{data.Int(2)})
+			So(err, ShouldBeNil)
+			So(fitCount(), ShouldEqual, data.Int(2))
+
+			Convey("Then loading the file should restore the snapshot", func() {
+				_, err := Load(ctx, "snapshot_test", path)
+				So(err, ShouldBeNil)
+				So(fitCount(), ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When load a file which doesn't exist", func() {
+			_, err := Load(ctx, "snapshot_test", filepath.Join(dir, "missing"))
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// checkSparseSupport checks that the Python class declares support of sparse
+// inputs by `supports_sparse` method returning true when threshold, which is
+// sparse_threshold, is given.
+func checkSparseSupport(b *pystate.Base, threshold float64) error {
+	if threshold <= 0 {
+		return nil
+	}
+	v, err := b.Call("supports_sparse")
+	if err != nil {
+		if isMissingAttribute(err) {
+			return &notSupportedError{feature: "sparse input", method: "supports_sparse"}
+		}
+		return err
+	}
+	if b, err := data.ToBool(v); err != nil || !b {
+		return fmt.Errorf("sparse_threshold requires supports_sparse method to return true")
+	}
+	return nil
+}
+
+// sparsify converts v into a sparse representation when it's an array of
+// numbers and the fraction of its non-zero elements is less than
+// sparse_threshold. The sparse representation is a `data.Map` having
+// "indices" and "values" of non-zero elements and "size", which is the length
+// of the original array. Other values are returned as they are.
+func (s *State) sparsify(v data.Value) data.Value {
+	if s.params.SparseThreshold <= 0 {
+		return v
+	}
+	arr, err := data.AsArray(v)
+	if err != nil || len(arr) == 0 {
+		return v
+	}
+
+	nonZero := 0
+	for _, e := range arr {
+		f, err := data.ToFloat(e)
+		if err != nil {
+			return v
+		}
+		if f != 0 {
+			nonZero++
+		}
+	}
+	if float64(nonZero)/float64(len(arr)) >= s.params.SparseThreshold {
+		return v
+	}
+
+	indices := make(data.Array, 0, nonZero)
+	values := make(data.Array, 0, nonZero)
+	for i, e := range arr {
+		f, _ := data.ToFloat(e)
+		if f != 0 {
+			indices = append(indices, data.Int(i))
+			values = append(values, data.Float(f))
+		}
+	}
+	return data.Map{
+		"indices": indices,
+		"values":  values,
+		"size":    data.Int(len(arr)),
+	}
+}
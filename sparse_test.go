@@ -0,0 +1,100 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateSparse(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate supporting sparse inputs", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "EchoClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1, SparseThreshold: 0.5}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When predict with a sparse vector", func() {
+			v, err := s.Predict(ctx, data.Array{data.Int(0), data.Float(2), data.Int(0)})
+			Convey("Then it should be passed as a sparse representation", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Map{
+					"indices": data.Array{data.Int(1)},
+					"values":  data.Array{data.Float(2)},
+					"size":    data.Int(3),
+				})
+			})
+		})
+
+		Convey("When predict with a dense vector", func() {
+			in := data.Array{data.Int(1), data.Float(2), data.Int(0)}
+			v, err := s.Predict(ctx, in)
+			Convey("Then it should be passed as it is", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, in)
+			})
+		})
+	})
+
+	Convey("Given a class not supporting sparse inputs", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "MinimalClass",
+		}
+		Convey("When create a state with sparse_threshold", func() {
+			_, err := New(baseParams, &MLParams{BatchSize: 1, SparseThreshold: 0.5}, data.Map{})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func benchmarkPredictSparseVector(b *testing.B, threshold float64) {
+	ctx := core.NewContext(&core.ContextConfig{})
+	baseParams := &pystate.BaseParams{
+		ModulePath: "./",
+		ModuleName: "_test_pymlstate",
+		ClassName:  "EchoClass",
+	}
+	s, err := New(baseParams, &MLParams{BatchSize: 1, SparseThreshold: threshold}, data.Map{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Terminate(ctx)
+
+	// 1% of 10000 features are non-zero.
+	vec := make(data.Array, 10000)
+	for i := range vec {
+		if i%100 == 0 {
+			vec[i] = data.Float(1)
+		} else {
+			vec[i] = data.Float(0)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Predict(ctx, vec); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPredictDenseVector(b *testing.B) {
+	benchmarkPredictSparseVector(b, 0)
+}
+
+func BenchmarkPredictSparseVector(b *testing.B) {
+	benchmarkPredictSparseVector(b, 0.1)
+}
@@ -1,6 +1,7 @@
 package pymlstate
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -9,7 +10,11 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"io"
+	"io/ioutil"
+	"regexp"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -19,11 +24,154 @@ var (
 // State is python instance specialized to multiple layer classification.
 // The python instance and this struct must not be coppied directly by assignment
 // statement because it doesn't increase reference count of instance.
+//
+// A State can be used from multiple streams and UDFs at once. Methods
+// changing the bucket or fields of State, such as Write and Flush, hold the
+// write lock, and methods only calling Python, such as Predict and Fit, hold
+// the read lock so that they can run concurrently. Python's GIL only
+// serializes individual bytecodes, not whole method calls, so calls to the
+// Python instance are serialized by modelM: calls which may update the model,
+// such as fit, are exclusive, and read-only calls, such as predict, can run
+// concurrently with each other. Fields updated while holding the read lock
+// have their own locks or are updated atomically.
 type State struct {
 	base   *pystate.Base
 	params MLParams
 	bucket []data.Value
 	rwm    sync.RWMutex
+
+	// modelM serializes calls to the Python instance. call holds the write
+	// lock and callReadOnly holds the read lock. servingM does the same for
+	// the serving instance of double_buffer.
+	modelM   sync.RWMutex
+	servingM sync.RWMutex
+
+	// initM protects base while it's lazily created. lazyBaseParams and
+	// lazyParams are used to create base when lazy_init is true, and they're
+	// nil after base is created. terminated is true when the state was
+	// terminated while base is released later by a call which timed out.
+	initM          sync.Mutex
+	lazyBaseParams *pystate.BaseParams
+	lazyParams     data.Map
+	terminated     bool
+
+	// baseParams and createParams are parameters given to New. They're used
+	// to create throwaway instances of the class, e.g. by SelfTest. They're
+	// nil when the state is loaded.
+	baseParams   *pystate.BaseParams
+	createParams data.Map
+
+	// featurePaths is compiled from params.FeatureOrder.
+	featurePaths []data.Path
+
+	// tracePath is compiled from params.TraceField. It's nil when
+	// trace_field isn't given.
+	tracePath data.Path
+
+	// idPath is compiled from params.IDField. It's nil when id_field isn't
+	// given.
+	idPath data.Path
+
+	// metricPaths is compiled from params.Metrics.
+	metricPaths []data.Path
+
+	history *predictionHistory
+
+	// skippedNaN is the number of samples skipped by reject_nan_features.
+	skippedNaN int64
+
+	// paused is true while training via Write is paused by Pause.
+	paused bool
+
+	// dropped is the number of tuples dropped while paused.
+	dropped int64
+
+	// expectedDim is the feature dimension recorded at the first successful
+	// fit via Write. It's 0 until it's recorded.
+	expectedDim int
+
+	// skippedDim is the number of tuples skipped by enforce_feature_dim.
+	// unknownDimWarned is true after a warning that the dimension cannot be
+	// determined is logged.
+	skippedDim       int64
+	unknownDimWarned bool
+
+	// drift is set when drift_monitor is true.
+	drift *driftMonitor
+
+	// stats keeps the result of the latest fit.
+	stats fitStats
+
+	// timeouts has the numbers of fits and predictions which timed out.
+	timeouts timeouts
+
+	// retryErrors is compiled from params.RetryErrors. retries is the number
+	// of retried Python calls. It's updated atomically.
+	retryErrors []*regexp.Regexp
+	retries     int64
+
+	// events is set when fit_event_buffer is given.
+	events *fitEvents
+
+	// serving is the Python instance used by predictions when double_buffer
+	// is true. weightSync records copies of weights to it.
+	serving    *pystate.Base
+	weightSync weightSync
+
+	// early is set when early_stopping_patience is given.
+	// earlyStoppedTuples is the number of tuples skipped by Write after
+	// training was stopped by it.
+	early              *earlyStopping
+	earlyStoppedTuples int64
+
+	// best keeps the best metric when save_best is true.
+	best bestTracker
+
+	// checkpoint keeps the last periodic checkpoint when checkpoint_interval
+	// is given.
+	checkpoint checkpointer
+
+	// flushTimer flushes the bucket when it has been pending since
+	// bucketSince for max_flush_interval. timedFlushes is the number of such
+	// flushes.
+	flushTimer   *time.Timer
+	bucketSince  time.Time
+	timedFlushes int64
+
+	// bucketBytes is the estimated size of tuples in the bucket. It's only
+	// computed when max_batch_bytes is given.
+	bucketBytes int64
+
+	// fitQueue and fitDone are set while the goroutine training batches
+	// pushed by Write is running when async_fit is true. fitDone is closed
+	// when the goroutine exits. asyncStopped is true after the goroutine is
+	// stopped by Terminate.
+	fitQueue     *fitQueue
+	fitDone      chan struct{}
+	asyncStopped bool
+
+	// quiesced is true after Quiesce is called.
+	quiesced bool
+
+	// dedup and dedupPath are set when dedup_key is given.
+	dedup     *recentKeys
+	dedupPath data.Path
+
+	// skippedDup is the number of tuples skipped as duplicates.
+	skippedDup int64
+
+	// replay is set when replay_buffer is greater than 0.
+	replay *replayBuffer
+
+	// feedback is set when feedback is true.
+	feedback *feedback
+
+	// slotHeld is true while the state is counted for SetMaxStates.
+	slotHeld bool
+
+	// normalizeWarnedAt is when normalize_proba last logged a warning in
+	// Unix nanoseconds. It's accessed atomically.
+	normalizeWarnedAt int64
 }
 
 // MLParams is parameters pymlstate defines in addition to those pystate does.
@@ -34,53 +182,776 @@ type MLParams struct {
 	// tuples without training until it has tuples as many as batch_train_size.
 	// This is an optional parameter and its default value is 10.
 	BatchSize int `codec:"batch_train_size"`
+
+	// SaveMaxBytes is the maximum size of a model serialized in memory by
+	// SaveBytes. SaveBytes fails when the serialized model exceeds this size.
+	// This is an optional parameter and 0, the default value, means no limit.
+	SaveMaxBytes int `codec:"save_max_bytes"`
+
+	// FeatureOrder is a list of paths to features. When it's given, each data
+	// passed to fit or predict must be a `data.Map` and it's converted to a
+	// `data.Array` having values of the paths in this order. Fields not
+	// listed are ignored and missing fields result in an error. This is an
+	// optional parameter.
+	FeatureOrder []string `codec:"feature_order"`
+
+	// PredictionHistorySize is the number of predictions kept by
+	// pymlstate_predict_record. Older predictions are discarded. This is an
+	// optional parameter and its default value is 100, which is also used
+	// when it's 0, e.g. in parameters saved by older versions.
+	PredictionHistorySize int `codec:"prediction_history_size"`
+
+	// FeatureClipMin and FeatureClipMax clamp numeric features of tuples
+	// written to the state before they're passed to Python. Features are
+	// "data" field of labeled samples such as {"data": [...], "label": 1},
+	// values of feature_order paths when it's given, or the whole sample
+	// otherwise, so labels aren't clamped. These are optional parameters and
+	// values aren't clamped by default.
+	FeatureClipMin *float64 `codec:"feature_clip_min"`
+	FeatureClipMax *float64 `codec:"feature_clip_max"`
+
+	// RejectNaNFeatures makes Write skip samples having NaN or Inf in their
+	// features. When a tuple has a batch of samples, only such samples are
+	// skipped. The number of skipped samples is reported by Status as
+	// skipped_nan_tuples. This is an optional parameter and its default value
+	// is false.
+	RejectNaNFeatures bool `codec:"reject_nan_features"`
+
+	// PausePolicy is how Write handles tuples while the state is paused by
+	// pymlstate_pause. "buffer" stores them to the bucket and "drop" discards
+	// them. This is an optional parameter and its default value is "buffer".
+	PausePolicy string `codec:"pause_policy"`
+
+	// MaxBucketSize is the maximum number of tuples buffered in the bucket
+	// while the state is paused or DeferFit is true. Tuples exceeding it are
+	// dropped. This is an optional parameter and 0, the default value, means
+	// no limit. When DeferFit is true, 0 means 10000 instead so that the
+	// bucket doesn't grow without bound.
+	MaxBucketSize int `codec:"max_bucket_size"`
+
+	// ReprMaxLength is the maximum length of a string returned by
+	// pymlstate_repr. Longer strings are truncated. This is an optional
+	// parameter and its default value is 1024. 0 means no limit.
+	ReprMaxLength int `codec:"repr_max_length"`
+
+	// PredictFormat is the format of values returned by pymlstate_predict.
+	// "raw" returns a prediction as it is and "protobuf" returns a
+	// `data.Blob` having a serialized protobuf message whose schema is
+	// documented in protobuf.go. This is an optional parameter and its
+	// default value is "raw".
+	PredictFormat string `codec:"predict_format"`
+
+	// EnforceFeatureDim makes Write skip tuples whose feature vector has a
+	// length different from the one of the first successful fit. The feature
+	// vector is "data" field of a labeled sample or the sample itself,
+	// converted by feature_order when it's given. A warning is logged when
+	// the dimension of the first fit cannot be determined. The number of
+	// skipped tuples is reported by Status. This is an optional parameter and
+	// its default value is false.
+	EnforceFeatureDim bool `codec:"enforce_feature_dim"`
+
+	// NullHandling is how null values in maps passed to Python are handled.
+	// "none" passes them as None, "skip" removes the keys having null, and
+	// "error" makes fit or predict fail. This is an optional parameter and
+	// its default value is "none".
+	NullHandling string `codec:"null_handling"`
+
+	// DriftMonitor enables monitoring of drift between feature vectors given
+	// to fit and ones given to predict. Status reports the mean of the
+	// standardized mean shift of each dimension as drift_score, which is
+	// updated every DriftWindow predictions. Only arrays of numbers are
+	// monitored. This is an optional parameter and its default value is
+	// false.
+	DriftMonitor bool `codec:"drift_monitor"`
+
+	// DriftWindow is the number of predictions used to compute a drift
+	// score. This is an optional parameter and its default value is 1000.
+	DriftWindow int `codec:"drift_window"`
+
+	// Feedback makes the state retain its last prediction and add it to the
+	// next data given to predict under FeedbackKey, so that a recurrent model
+	// can use it as an input. Data given to predict must be a `data.Map`. The
+	// value is null before the first prediction, so the Python class needs to
+	// substitute its initial value, e.g. zeros. A RoutedState retains the last
+	// prediction of each sub-model separately. This is an optional parameter
+	// and its default value is false.
+	Feedback bool `codec:"feedback"`
+
+	// FeedbackKey is the key under which the last prediction is added. This
+	// is an optional parameter and its default value is "feedback".
+	FeedbackKey string `codec:"feedback_key"`
+
+	// ONNXExportMethod is the name of the method called by
+	// pymlstate_export_onnx. The method receives the path of the file to
+	// write. This is an optional parameter and its default value is
+	// "to_onnx".
+	ONNXExportMethod string `codec:"onnx_export_method"`
+
+	// DeferFit makes Write only buffer tuples without training, so that the
+	// model is trained only when pymlstate_flush is called or the bucket has
+	// been pending for MaxFlushInterval. It's set when fit_on_write is false.
+	// Because the bucket grows until it's flushed, MaxBucketSize defaults to
+	// 10000 with it. This is an optional parameter and its default value is
+	// false, i.e. fit_on_write is true.
+	DeferFit bool `codec:"defer_fit"`
+
+	// TraceField is a path to the field of tuples or data given to predict
+	// having a trace ID. When it's given, logs emitted by Write and Predict
+	// have the ID as trace_id field so that a specific event can be traced
+	// through the model. This is an optional parameter.
+	TraceField string `codec:"trace_field"`
+
+	// CheckpointPath is the path of the file to which pymlstate_quiesce and
+	// periodic checkpoints save the state. The file has the same format as
+	// SAVE STATE. This is an optional parameter and no checkpoint is saved by
+	// default.
+	CheckpointPath string `codec:"checkpoint_path"`
+
+	// CheckpointInterval is the minimum interval of periodic checkpoints.
+	// When it's greater than 0, the state is saved to CheckpointPath after a
+	// fit if the interval has passed since the last checkpoint, so that
+	// online training doesn't lose everything on a crash. Saving blocks the
+	// fit which triggered it. In BQL, it's given in seconds. This is an
+	// optional parameter and 0, the default value, disables periodic
+	// checkpoints.
+	CheckpointInterval time.Duration `codec:"checkpoint_interval"`
+
+	// CheckpointKeep is the number of periodic checkpoints retained. The
+	// latest one is saved at CheckpointPath and older ones are renamed to
+	// CheckpointPath with suffixes ".1", ".2", and so on. This is an optional
+	// parameter and its default value is 3.
+	CheckpointKeep int `codec:"checkpoint_keep"`
+
+	// MaxFlushInterval is the maximum time tuples written via Write wait in
+	// the bucket. When it's greater than 0 and the bucket isn't full after
+	// the interval since its first tuple was written, the model is trained
+	// with the tuples in the bucket, so that a slow stream doesn't leave a
+	// half-full bucket forever. With fit_on_write = false, the whole bucket
+	// is trained at once. Buckets held by Pause aren't flushed until Resume.
+	// In BQL, it's given in seconds. This is an optional parameter and 0, the
+	// default value, disables it.
+	MaxFlushInterval time.Duration `codec:"max_flush_interval"`
+
+	// FitTimeout is the maximum time a fit can take. When the method doesn't
+	// return in time, the fit fails with an error so that a hung model
+	// doesn't freeze the stream. Because Python code cannot be interrupted,
+	// the method keeps running in the background and its result is
+	// discarded. Note that the model may still be trained with the batch
+	// reported as failed. Until the method returns, the state is busy:
+	// fits, predictions, and other calls of the Python instance, Save, and
+	// Load fail immediately so that they don't run concurrently with the
+	// call. Terminate succeeds, but the instance is released after the
+	// method returns. In BQL, it's given in seconds.
+	// This is an optional parameter and 0, the default value, means no
+	// timeout.
+	FitTimeout time.Duration `codec:"fit_timeout"`
+
+	// PredictTimeout is the maximum time a prediction by Predict or
+	// PredictBatch can take. It behaves in the same way as FitTimeout,
+	// including the busy state after a timeout. In BQL, it's given in
+	// seconds. This is an optional parameter and 0, the default value, means
+	// no timeout.
+	PredictTimeout time.Duration `codec:"predict_timeout"`
+
+	// RetryMaxAttempts is the maximum number of attempts of a fit or a
+	// prediction by Predict failing with a retryable error, e.g. CUDA out of
+	// memory which may be resolved by the garbage collection. Note that a
+	// fit which failed in the middle of training may have already updated
+	// the model. Calls which timed out aren't retried. This is an optional
+	// parameter and its default value is 1, which means no retry.
+	RetryMaxAttempts int `codec:"retry_max_attempts"`
+
+	// RetryBackoff is the wait before the first retry. It doubles every
+	// retry. The lock of the state is held while waiting, so it should be
+	// kept short. In BQL, it's given in seconds. This is an optional
+	// parameter and its default value is 0.1 seconds.
+	RetryBackoff time.Duration `codec:"retry_backoff"`
+
+	// RetryErrors is a list of regular expressions of retryable error
+	// messages, e.g. ["out of memory", "Resource temporarily unavailable"].
+	// When it's empty, all errors are retryable. This is an optional
+	// parameter.
+	RetryErrors []string `codec:"retry_errors"`
+
+	// FlushOnTerminate is true when Terminate trains the model with tuples
+	// remaining in the bucket, including ones buffered by Pause or
+	// fit_on_write = false, before the Python instance is released. A failure
+	// of the final fit is logged and doesn't prevent the termination. This
+	// is an optional parameter and its default value is false, which
+	// discards remaining tuples.
+	FlushOnTerminate bool `codec:"flush_on_terminate"`
+
+	// FitMethod is the name of the method of the Python instance called to
+	// train the model, e.g. "partial_fit", so that existing classes can be
+	// used without wrappers. This is an optional parameter and its default
+	// value is "fit".
+	FitMethod string `codec:"fit_method"`
+
+	// PartialFit makes Write, Flush, and other paths training the model with
+	// written tuples call `partial_fit` method for incremental updates, while
+	// pymlstate_fit keeps calling `fit`, or the method given by FitMethod,
+	// for full retrains. This matches the split of scikit-learn's API.
+	// pymlstate_partial_fit always calls `partial_fit`. This is an optional
+	// parameter and its default value is false.
+	PartialFit bool `codec:"partial_fit"`
+
+	// AsyncFit is true when full buckets written via Write are pushed to a
+	// bounded queue and trained by a dedicated goroutine, so that Write
+	// doesn't block the upstream stream during fit unless the queue is full.
+	// Errors of fit are logged and counted by Status instead of being
+	// returned from Write. Terminate waits until queued batches are trained.
+	// It's implied by DoubleBuffer. This is an optional parameter and its
+	// default value is false.
+	AsyncFit bool `codec:"async_fit"`
+
+	// FitQueueSize is the maximum number of batches waiting in the queue of
+	// AsyncFit. This is an optional parameter and its default value is 4.
+	FitQueueSize int `codec:"fit_queue_size"`
+
+	// OverflowPolicy is what Write does when the queue of AsyncFit is full
+	// because fit cannot keep up with the stream. "block" waits until a batch
+	// is trained, "drop_oldest_batch" drops the oldest queued batch,
+	// "drop_newest_batch" drops the new batch, and "sample" drops one of the
+	// queued batches and the new one at random so that the trained batches
+	// are sampled uniformly from the stream. The number of dropped tuples is
+	// reported by Status. This is an optional parameter and its default value
+	// is "block".
+	OverflowPolicy string `codec:"overflow_policy"`
+
+	// MaxBatchBytes is the maximum estimated size of tuples in a bucket in
+	// bytes. When it's greater than 0, Write trains the model once the bucket
+	// reaches this size even if it has fewer tuples than BatchSize, so that
+	// variable-sized records such as texts or images don't blow up memory.
+	// The size is estimated from the data, e.g. 8 bytes for a number and the
+	// length for a string or a blob, and doesn't exactly match the size of
+	// the serialized batch. It only has effect when BatchSize is greater
+	// than 1. This is an optional parameter and 0, the default value, means
+	// no limit.
+	MaxBatchBytes int64 `codec:"max_batch_bytes"`
+
+	// PredictMethod is the name of the method of the Python instance called
+	// to predict, e.g. "forward". This is an optional parameter and its
+	// default value is "predict".
+	PredictMethod string `codec:"predict_method"`
+
+	// PredictBatchMethod is the name of the method of the Python instance
+	// called by pymlstate_predict_batch and pymlstate_predict_stream to
+	// predict a list of samples at once. This is an optional parameter and
+	// its default value is "predict_batch".
+	PredictBatchMethod string `codec:"predict_batch_method"`
+
+	// SparseThreshold makes fit and predict pass an array of numbers as a
+	// sparse representation when the fraction of its non-zero elements is
+	// less than this value. The Python class must define `supports_sparse`
+	// method returning true. See sparse.go for the representation. This is
+	// an optional parameter and 0, the default value, disables it.
+	SparseThreshold float64 `codec:"sparse_threshold"`
+
+	// LazyInit defers creation of the Python instance until it's used for the
+	// first time, e.g. by the first fit or predict, so that rarely used states
+	// don't consume memory. The first call takes longer because it creates
+	// the instance, and errors in the constructor are reported by that call
+	// instead of CREATE STATE. This is an optional parameter and its default
+	// value is false.
+	LazyInit bool `codec:"lazy_init"`
+
+	// WarmupSample is a sample given to `predict` method, or the method given
+	// by PredictMethod, right after the Python instance is created, so that
+	// caches such as CUDA contexts and JIT-compiled functions are initialized
+	// before the first real tuple arrives. The result is discarded, and the
+	// creation fails when the prediction fails. When LazyInit is true, it's
+	// given when the instance is created by the first use. It isn't saved by
+	// SAVE STATE. This is an optional parameter.
+	WarmupSample data.Value `codec:"-"`
+
+	// MetricsPositions is a list of metric names of values returned by fit as
+	// an array or a tuple, e.g. ["loss", "accuracy"] for `(loss, accuracy)`.
+	// When it's given, such a result is recorded as fit metrics in a
+	// `data.Map` keyed by these names. Results which aren't arrays of the
+	// same length are recorded as they are. This is an optional parameter.
+	MetricsPositions []string `codec:"metrics_positions"`
+
+	// Metrics is a list of paths of metrics extracted from a result of fit,
+	// e.g. ["f1", "auc"] or ["val.perplexity"]. Extracted metrics are logged
+	// at the debug level and reported by Status as "fit_metrics", a
+	// `data.Map` keyed by the paths. A metric missing in the result is
+	// reported as null. Paths are applied after MetricsPositions. This is an
+	// optional parameter.
+	Metrics []string `codec:"metrics"`
+
+	// FitEventBuffer is the number of fit events retained until they're
+	// emitted by pymlstate_fit_events, which emits a tuple per fit having
+	// its loss, accuracy, batch index, duration, and timestamp. The oldest
+	// event is dropped when the buffer is full. This is an optional
+	// parameter and 0, the default value, disables it.
+	FitEventBuffer int `codec:"fit_event_buffer"`
+
+	// EarlyStoppingPatience is the number of batches without improvement of
+	// the metric named EarlyStoppingMetric after which Write stops training
+	// the model. After that, the state only serves predictions and Write
+	// skips tuples until Resume is called, which restarts monitoring. Results
+	// of fit not having the metric are ignored. When it stops training, a
+	// message is logged and the event emitted by pymlstate_fit_events has
+	// "early_stopped" set to true. This is an optional parameter and 0, the
+	// default value, disables it.
+	EarlyStoppingPatience int `codec:"early_stopping_patience"`
+
+	// EarlyStoppingMinDelta is the minimum decrease of the metric regarded
+	// as an improvement. This is an optional parameter and its default value
+	// is 0.
+	EarlyStoppingMinDelta float64 `codec:"early_stopping_min_delta"`
+
+	// EarlyStoppingMetric is the name of the metric monitored by early
+	// stopping. A smaller value is regarded as better. This is an optional
+	// parameter and its default value is "loss".
+	EarlyStoppingMetric string `codec:"early_stopping_metric"`
+
+	// DoubleBuffer creates two Python instances of the class: one is trained
+	// by fit and the other serves predictions and other read-only inference
+	// methods: predict_proba, transform, evaluate, score,
+	// feature_importances, explain, and saliency. After each fit, weights are
+	// copied from the training instance to the serving instance by calling
+	// `get_weights` of the former and `set_weights` of the latter with its
+	// result, so the class must have both methods. This keeps predictions
+	// consistent while a long fit is running and lets the class release the
+	// GIL or its own locks independently for each instance. Because a
+	// synchronous fit by Write holds the write lock of the state, which
+	// blocks predictions, DoubleBuffer implies AsyncFit so that fits run
+	// outside the lock. Fits by pymlstate_fit only hold the read lock and
+	// don't block predictions. It cannot be used with lazy_init. This is an
+	// optional parameter and its default value is false.
+	DoubleBuffer bool `codec:"double_buffer"`
+
+	// ReplayBuffer is the number of the last batches given to fit retained in
+	// memory. When fit fails, the retained batches are dumped with the index
+	// of the failed batch and the error so that the failure can be
+	// reproduced offline. Batches are retained before conversions such as
+	// feature_order are applied. Because it copies every batch, it should
+	// only be enabled for debugging. This is an optional parameter and 0, the
+	// default value, disables it.
+	ReplayBuffer int `codec:"replay_buffer"`
+
+	// ReplayDumpPath is a directory to which the replay buffer is dumped as
+	// a JSON file named "replay-<batch index>.json". The buffer is dumped
+	// to the log when it's empty. This is an optional parameter.
+	ReplayDumpPath string `codec:"replay_dump_path"`
+
+	// PredictAsScores makes pymlstate_predict return a `data.Map` from a class
+	// name to its score instead of an array of scores. Names are ClassNames,
+	// or indices written as strings such as "0" when only NumClasses is
+	// given. Predictions whose length differs from the number of classes
+	// result in an error. It cannot be used with the "protobuf" format. This
+	// is an optional parameter and its default value is false.
+	PredictAsScores bool `codec:"predict_as_scores"`
+
+	// ClassNames is a list of class names in the order of scores. This is an
+	// optional parameter.
+	ClassNames []string `codec:"class_names"`
+
+	// NumClasses is the number of classes. It must be equal to the length of
+	// ClassNames when both are given. This is an optional parameter.
+	NumClasses int `codec:"num_classes"`
+
+	// SaveBest makes the state save itself to SaveModelPath each time the
+	// metric named SaveBestMetric in a result of fit improves, so that the
+	// file always has the best model. fit must return a `dict` having the
+	// metric, e.g. a validation accuracy computed by the Python class, or a
+	// tuple named by MetricsPositions. Status reports the best value and the
+	// number of batches at which it was achieved. This is an optional
+	// parameter and its default value is false.
+	SaveBest bool `codec:"save_best"`
+
+	// SaveBestMetric is the name of the metric monitored by SaveBest. This is
+	// an optional parameter and its default value is "val_accuracy".
+	SaveBestMetric string `codec:"save_best_metric"`
+
+	// SaveBestMode is "max" when a larger value of the metric is better and
+	// "min" otherwise. This is an optional parameter and its default value is
+	// "max".
+	SaveBestMode string `codec:"save_best_mode"`
+
+	// SaveModelPath is the path of the file to which SaveBest saves the
+	// state. The file has the same format as SAVE STATE. It's required when
+	// SaveBest is true.
+	SaveModelPath string `codec:"save_model_path"`
+
+	// DedupKey is a path to the field of tuples identifying them. When it's
+	// given, Write skips tuples whose key is the same as one of the last
+	// DedupWindow tuples, e.g. ones redelivered by retries. The number of
+	// skipped tuples is reported by Status. This is an optional parameter.
+	DedupKey string `codec:"dedup_key"`
+
+	// DedupWindow is the number of recent keys remembered by DedupKey. A
+	// larger window detects duplicates delivered later at the cost of memory
+	// proportional to it. This is an optional parameter and its default value
+	// is 1000.
+	DedupWindow int `codec:"dedup_window"`
+
+	// OnInvalidMetrics is how to handle a fit result having a non-numeric
+	// metric, e.g. a loss returned as a string by a buggy class. Metrics are
+	// values of a result returned as a map, or as an array named by
+	// MetricsPositions. "warn" logs a warning naming the metric and its type
+	// and continues, and "error" makes fit fail. Note that the model has
+	// already been trained with the batch in either case. This is an optional
+	// parameter and its default value is "warn".
+	OnInvalidMetrics string `codec:"on_invalid_metrics"`
+
+	// Outputs is a map from a logical output name to a method of the Python
+	// instance, e.g. {"embedding": "embed", "proba": "predict_proba"}. Each
+	// method is called in the same way as `predict` when the name is given
+	// to pymlstate_predict, so that a model having several inference heads
+	// can be served by one state. The class must have all methods when the
+	// instance is created. This is an optional parameter.
+	Outputs map[string]string `codec:"outputs"`
+
+	// NormalizeProba is true when probabilities returned by `predict_proba`
+	// are clamped to [0, 1] and renormalized to sum up to 1 before they're
+	// used by UDFs such as pymlstate_predict_topk, so that consumers
+	// assuming a valid distribution are safe. A rate-limited warning is
+	// logged when the change is significant since it may indicate a bug of
+	// the model. This is an optional parameter and its default value is
+	// false, which keeps raw outputs.
+	NormalizeProba bool `codec:"normalize_proba"`
+
+	// IDField is a path to the field of data identifying a request. When it's
+	// given, pymlstate_predict returns a `data.Map` having the value of the
+	// field as "id" and the prediction as "prediction" so that results can
+	// be joined back to requests. Unlike TraceField, the id is carried in
+	// the result rather than in logs. This is an optional parameter.
+	IDField string `codec:"id_field"`
+
+	// IDRequired is true when pymlstate_predict fails for data not having
+	// IDField. Otherwise, the id is null for such data. This is an optional
+	// parameter and its default value is false.
+	IDRequired bool `codec:"id_required"`
 }
 
-// New creates `core.SharedState` for multiple layer classification.
+// New creates `core.SharedState` for multiple layer classification. When the
+// module doesn't have the class, the returned error lists classes the module
+// defines.
 func New(baseParams *pystate.BaseParams, mlParams *MLParams, params data.Map) (*State, error) {
-	b, err := pystate.NewBase(baseParams, params)
-	if err != nil {
+	bp := *baseParams
+	s := &State{
+		bucket:       make([]data.Value, 0, mlParams.BatchSize),
+		baseParams:   &bp,
+		createParams: params,
+	}
+	if err := s.setParams(mlParams); err != nil {
 		return nil, err
 	}
 
-	s := &State{
-		base:   b,
-		params: *mlParams,
-		bucket: make([]data.Value, 0, mlParams.BatchSize),
+	if err := acquireStateSlot(); err != nil {
+		return nil, err
+	}
+	if mlParams.LazyInit {
+		bp := *baseParams
+		s.lazyBaseParams = &bp
+		s.lazyParams = params
+		s.slotHeld = true
+		return s, nil
+	}
+
+	b, err := newBase(baseParams, params)
+	if err != nil {
+		releaseStateSlot()
+		return nil, err
+	}
+	if err := checkSparseSupport(b, mlParams.SparseThreshold); err != nil {
+		b.Terminate(nil)
+		releaseStateSlot()
+		return nil, err
 	}
+	if err := checkOutputs(baseParams, mlParams.Outputs); err != nil {
+		b.Terminate(nil)
+		releaseStateSlot()
+		return nil, err
+	}
+	if mlParams.DoubleBuffer {
+		if s.serving, err = newServing(b, baseParams, params); err != nil {
+			b.Terminate(nil)
+			releaseStateSlot()
+			return nil, err
+		}
+	}
+	err = s.warmup(b)
+	if err == nil && s.serving != nil {
+		err = s.warmup(s.serving)
+	}
+	if err != nil {
+		if s.serving != nil {
+			s.serving.Terminate(nil)
+		}
+		b.Terminate(nil)
+		releaseStateSlot()
+		return nil, err
+	}
+	s.base = b
+	s.slotHeld = true
 	return s, nil
 }
 
-// Terminate terminates this state.
+// setParams sets MLParams and fields derived from it.
+func (s *State) setParams(p *MLParams) error {
+	paths, err := compileFeatureOrder(p.FeatureOrder)
+	if err != nil {
+		return err
+	}
+	var tracePath data.Path
+	if p.TraceField != "" {
+		if tracePath, err = data.CompilePath(p.TraceField); err != nil {
+			return err
+		}
+	}
+	if p.CheckpointInterval > 0 {
+		if err := validateCheckpoint(p.CheckpointInterval, p.CheckpointKeep,
+			p.CheckpointPath); err != nil {
+			return err
+		}
+	}
+	metricPaths := make([]data.Path, len(p.Metrics))
+	for i, m := range p.Metrics {
+		if metricPaths[i], err = data.CompilePath(m); err != nil {
+			return fmt.Errorf("invalid metric path '%v': %v", m, err)
+		}
+	}
+	retryErrors, err := compileRetryErrors(p.RetryErrors)
+	if err != nil {
+		return err
+	}
+	if p.DoubleBuffer && p.LazyInit {
+		return fmt.Errorf("double_buffer cannot be used with lazy_init")
+	}
+	var idPath data.Path
+	if p.IDField != "" {
+		if idPath, err = data.CompilePath(p.IDField); err != nil {
+			return err
+		}
+	}
+	var dedupPath data.Path
+	if p.DedupKey != "" {
+		if p.DedupWindow <= 0 {
+			return fmt.Errorf("dedup_window must be greater than 0")
+		}
+		if dedupPath, err = data.CompilePath(p.DedupKey); err != nil {
+			return err
+		}
+	}
+	s.params = *p
+	if p.DoubleBuffer {
+		s.params.AsyncFit = true
+	}
+	if p.DeferFit && p.MaxBucketSize == 0 {
+		s.params.MaxBucketSize = defaultDeferredMaxBucketSize
+	}
+	s.featurePaths = paths
+	s.tracePath = tracePath
+	s.idPath = idPath
+	s.metricPaths = metricPaths
+	s.retryErrors = retryErrors
+	if s.params.PredictionHistorySize <= 0 {
+		s.params.PredictionHistorySize = defaultPredictionHistorySize
+	}
+	if size := s.params.PredictionHistorySize; s.history == nil || len(s.history.entries) != size {
+		s.history = newPredictionHistory(size)
+	}
+	if !p.DriftMonitor {
+		s.drift = nil
+	} else if s.drift == nil || s.drift.window != p.DriftWindow {
+		s.drift = newDriftMonitor(p.DriftWindow)
+	}
+	s.dedupPath = dedupPath
+	if p.DedupKey == "" {
+		s.dedup = nil
+	} else if s.dedup == nil || len(s.dedup.keys) != p.DedupWindow {
+		s.dedup = newRecentKeys(p.DedupWindow)
+	}
+	if p.ReplayBuffer <= 0 {
+		s.replay = nil
+	} else if s.replay == nil || len(s.replay.batches) != p.ReplayBuffer {
+		s.replay = newReplayBuffer(p.ReplayBuffer)
+	}
+	if p.FitEventBuffer <= 0 {
+		s.events = nil
+	} else if s.events == nil || s.events.limit != p.FitEventBuffer {
+		s.events = newFitEvents(p.FitEventBuffer)
+	}
+	if p.EarlyStoppingPatience <= 0 {
+		s.early = nil
+	} else if s.early == nil || s.early.patience != p.EarlyStoppingPatience ||
+		s.early.minDelta != p.EarlyStoppingMinDelta {
+		s.early = newEarlyStopping(p.EarlyStoppingPatience, p.EarlyStoppingMinDelta)
+	}
+	if !p.Feedback {
+		s.feedback = nil
+	} else if s.feedback == nil || s.feedback.key != p.FeedbackKey {
+		s.feedback = newFeedback(p.FeedbackKey)
+	}
+	return nil
+}
+
+// Terminate terminates this state. While a Python call which timed out is
+// still running, the state is terminated immediately but the Python instance
+// is released after the call returns so that it isn't released under the
+// call. Remaining tuples aren't trained in that case.
 func (s *State) Terminate(ctx *core.Context) error {
+	s.stopAsyncFit()
 	s.rwm.Lock()
 	defer s.rwm.Unlock()
-	if err := s.base.Terminate(ctx); err != nil {
-		return err
+	if s.initialized() {
+		if err := s.checkTermination(); err != nil {
+			return err
+		}
+		if s.timeouts.checkOutstanding() != nil {
+			s.terminateAfterOutstanding(ctx)
+		} else if err := s.terminateBase(ctx); err != nil {
+			return err
+		}
+	} else if s.lazyBaseParams == nil {
+		return errTerminated
+	}
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+		s.flushTimer = nil
 	}
 	// Don't set s.base = nil because it's used for the termination detection.
+	s.lazyBaseParams = nil
+	s.lazyParams = nil
 	s.bucket = nil
+	if s.slotHeld {
+		releaseStateSlot()
+		s.slotHeld = false
+	}
 	return nil
 }
 
-// Write stores a tuple to its bucket and calls "fit" function every
-// "batch_train_size" times.
+// terminateAfterOutstanding terminates the state while a call which timed out
+// is still running. Python instances are released by the call when it
+// returns. The caller must hold the write lock.
+func (s *State) terminateAfterOutstanding(ctx *core.Context) {
+	s.initM.Lock()
+	s.terminated = true
+	s.initM.Unlock()
+
+	b, serving := s.base, s.serving
+	release := func() {
+		if serving != nil {
+			if err := serving.Terminate(ctx); err != nil {
+				ctx.ErrLog(err).Error("pymlstate cannot terminate the serving instance")
+			}
+		}
+		if err := b.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Error("pymlstate cannot terminate the Python instance")
+		}
+	}
+	if !s.timeouts.afterOutstanding(release) {
+		// The call returned in the meantime.
+		release()
+		return
+	}
+	ctx.Log().Warn("pymlstate is terminated while a Python call which timed " +
+		"out is still running, so the instance will be released after it returns")
+}
+
+// terminateBase trains the model with remaining tuples when
+// flush_on_terminate is true and releases Python instances. The caller must
+// hold the write lock.
+func (s *State) terminateBase(ctx *core.Context) error {
+	if s.params.FlushOnTerminate && len(s.bucket) > 0 {
+		if _, err := s.fit(ctx, s.bucket); err != nil {
+			ctx.ErrLog(err).WithField("bucket_size", len(s.bucket)).
+				Error("pymlstate's training of remaining tuples on termination failed")
+		}
+		s.bucket = s.bucket[:0]
+	}
+	if s.serving != nil {
+		if err := s.serving.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Error("pymlstate cannot terminate the serving instance")
+		}
+	}
+	return s.base.Terminate(ctx)
+}
+
+// Write stores a tuple to its bucket and calls "fit" function, or the method
+// given by fit_method, every "batch_train_size" times. When async_fit is true,
+// a full bucket is pushed to the fit queue and trained by another goroutine.
 func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
+	q, batch, err := s.write(ctx, t)
+	if err != nil || batch == nil {
+		return err
+	}
+	// The batch is pushed without holding the lock because the fit
+	// goroutine needs the read lock to consume the queue.
+	q.push(ctx, batch)
+	return nil
+}
+
+// write is the internal implementation of Write. When async_fit is true and
+// the bucket becomes full, it returns the batch which should be pushed to the
+// returned queue instead of training the model.
+func (s *State) write(ctx *core.Context, t *core.Tuple) (*fitQueue, []data.Value, error) {
 	s.rwm.Lock()
 	defer s.rwm.Unlock()
-	if err := s.base.CheckTermination(); err != nil {
-		return err
+	if err := s.checkTermination(); err != nil {
+		return nil, nil, err
+	}
+	if s.quiesced {
+		return nil, nil, errQuiesced
+	}
+	if s.isDuplicate(t.Data) {
+		s.skippedDup++
+		return nil, nil, nil
 	}
 
 	dataSet, err := t.Data.Get(datPath)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	dataSet, rejected := s.preprocessSamples(dataSet)
+	s.skippedNaN += int64(rejected)
+	if dataSet == nil {
+		return nil, nil, nil
+	}
+
+	if !s.checkFeatureDim(dataSet) {
+		s.skippedDim++
+		l := ctx.Log().WithField("expected_feature_dim", s.expectedDim)
+		if id, ok := s.traceID(t.Data); ok {
+			l = l.WithField("trace_id", id)
+		}
+		l.Warn("pymlstate skipped a tuple having a different feature dimension")
+		return nil, nil, nil
+	}
+
+	if s.paused {
+		s.bufferWhilePaused(dataSet)
+		return nil, nil, nil
+	}
+	if s.early != nil && s.early.isStopped() {
+		s.earlyStoppedTuples++
+		return nil, nil, nil
+	}
+	if s.params.DeferFit {
+		started := len(s.bucket) == 0
+		s.buffer(dataSet)
+		if started {
+			s.rescheduleFlush(ctx)
+		}
+		return nil, nil, nil
 	}
 
 	if s.params.BatchSize > 1 {
 		s.bucket = append(s.bucket, dataSet)
-		if len(s.bucket) < s.params.BatchSize {
-			return nil
+		if s.params.MaxBatchBytes > 0 {
+			if len(s.bucket) == 1 {
+				s.bucketBytes = 0
+			}
+			s.bucketBytes += estimateSize(dataSet)
+		}
+		if len(s.bucket) < s.params.BatchSize && !s.bucketTooLarge() {
+			if len(s.bucket) == 1 && s.params.MaxFlushInterval > 0 {
+				s.scheduleFlush(ctx)
+			}
+			return nil, nil, nil
 		}
 	} else {
 		if dataSet.Type() == data.TypeArray {
@@ -91,41 +962,329 @@ func (s *State) Write(ctx *core.Context, t *core.Tuple) error {
 		}
 	}
 
+	if s.params.AsyncFit && !s.asyncStopped {
+		return s.takeBatch(ctx)
+	}
+
 	_, err = s.fit(ctx, s.bucket)
 	prevBucketSize := len(s.bucket)
-	s.bucket = s.bucket[:0] // clear slice but keep capacity
+	if err == nil {
+		s.recordFeatureDim(ctx, s.bucket)
+	}
+	if s.params.BatchSize > 1 {
+		s.bucket = s.bucket[:0] // clear slice but keep capacity
+	} else {
+		// The bucket shares the array of the tuple, which may be read by
+		// other streams. It must not be reused by appending tuples to it,
+		// e.g. while paused.
+		s.bucket = nil
+	}
 	if err != nil {
-		ctx.ErrLog(err).WithField("bucket_size", prevBucketSize).
-			Error("pymlstate's training via Write (INSERT INTO) failed")
-		return err
+		l := ctx.ErrLog(err).WithField("bucket_size", prevBucketSize)
+		if id, ok := s.traceID(t.Data); ok {
+			l = l.WithField("trace_id", id)
+		}
+		l.Error("pymlstate's training via Write (INSERT INTO) failed")
+		return nil, nil, err
 	}
 
-	return nil
+	return nil, nil, nil
+}
+
+// fitMethod returns the name of the method called by fit. Empty FitMethod,
+// e.g. of a state saved before fit_method was introduced, means "fit".
+func (s *State) fitMethod() string {
+	if s.params.FitMethod == "" {
+		return "fit"
+	}
+	return s.params.FitMethod
+}
+
+// predictMethod returns the name of the method called by Predict. Empty
+// PredictMethod means "predict".
+func (s *State) predictMethod() string {
+	if s.params.PredictMethod == "" {
+		return "predict"
+	}
+	return s.params.PredictMethod
+}
+
+// traceID returns the trace ID in v. It returns false when trace_field isn't
+// given or v doesn't have the field.
+func (s *State) traceID(v data.Value) (string, bool) {
+	if s.tracePath == nil {
+		return "", false
+	}
+	m, err := data.AsMap(v)
+	if err != nil {
+		return "", false
+	}
+	id, err := m.Get(s.tracePath)
+	if err != nil {
+		return "", false
+	}
+	str, err := data.ToString(id)
+	if err != nil {
+		return "", false
+	}
+	return str, true
+}
+
+func (s *State) formatPrediction(v data.Value) (data.Value, error) {
+	s.rwm.RLock()
+	p := s.params
+	s.rwm.RUnlock()
+	return formatPrediction(&p, v)
+}
+
+// Flush trains the model with tuples remaining in the bucket and returns the
+// result of fit. It returns `data.Null` without calling fit when the bucket is
+// empty. When async_fit is true, batches already in the fit queue are trained
+// before the remaining tuples, and Flush returns after all of them are
+// trained.
+func (s *State) Flush(ctx *core.Context) (data.Value, error) {
+	s.drainFitQueue()
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.checkTermination(); err != nil {
+		return nil, err
+	}
+	if len(s.bucket) == 0 {
+		return data.Null{}, nil
+	}
+
+	res, err := s.fit(ctx, s.bucket)
+	s.bucket = s.bucket[:0]
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Status returns the current status of the state.
+func (s *State) Status() data.Map {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	st := data.Map{
+		"batch_train_size":     data.Int(s.params.BatchSize),
+		"bucket_size":          data.Int(len(s.bucket)),
+		"skipped_nan_tuples":   data.Int(s.skippedNaN),
+		"paused":               data.Bool(s.paused),
+		"dropped_tuples":       data.Int(s.dropped),
+		"expected_feature_dim": data.Int(s.expectedDim),
+		"skipped_dim_tuples":   data.Int(s.skippedDim),
+		"fit_on_write":         data.Bool(!s.params.DeferFit),
+		"quiesced":             data.Bool(s.quiesced),
+		"initialized":          data.Bool(s.initialized()),
+		"skipped_dup_tuples":   data.Int(s.skippedDup),
+		"timed_flushes":        data.Int(s.timedFlushes),
+	}
+	if s.serving != nil {
+		for k, v := range s.weightSync.status() {
+			st[k] = v
+		}
+	}
+	if s.early != nil {
+		st["early_stopped_tuples"] = data.Int(s.earlyStoppedTuples)
+		for k, v := range s.early.status() {
+			st[k] = v
+		}
+	}
+	if s.events != nil {
+		st["dropped_fit_events"] = data.Int(s.events.droppedEvents())
+	}
+	if s.fitQueue != nil {
+		st["fit_queue_length"] = data.Int(s.fitQueue.len())
+		st["overflow_dropped_tuples"] = data.Int(s.fitQueue.droppedTuples())
+	}
+	for k, v := range s.stats.status() {
+		st[k] = v
+	}
+	for k, v := range s.timeouts.status() {
+		st[k] = v
+	}
+	st["retries"] = data.Int(atomic.LoadInt64(&s.retries))
+	if s.drift != nil {
+		for k, v := range s.drift.status() {
+			st[k] = v
+		}
+	}
+	if s.params.SaveBest {
+		for k, v := range s.best.status() {
+			st[k] = v
+		}
+	}
+	if s.params.CheckpointInterval > 0 {
+		for k, v := range s.checkpoint.status() {
+			st[k] = v
+		}
+	}
+	return st
 }
 
 // Fit receives `data.Array` type but it assumes `[]data.Map` type
-// for passing arguments to `fit` method.
+// for passing arguments to `fit` method. When bucket is empty, it returns
+// `data.Null` without calling `fit` method.
 func (s *State) Fit(ctx *core.Context, bucket []data.Value) (data.Value, error) {
 	s.rwm.RLock()
 	defer s.rwm.RUnlock()
-	return s.fit(ctx, bucket)
+	if len(bucket) == 0 {
+		return data.Null{}, nil
+	}
+	return s.fitWith(ctx, s.fitMethod(), bucket)
+}
+
+// PartialFit incrementally trains the model with bucket by calling
+// `partial_fit` method regardless of partial_fit parameter. When bucket is
+// empty, it returns `data.Null` without calling the method.
+func (s *State) PartialFit(ctx *core.Context, bucket []data.Value) (data.Value, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	if len(bucket) == 0 {
+		return data.Null{}, nil
+	}
+	return s.fitWith(ctx, "partial_fit", bucket)
 }
 
-// fit is the internal implementation of Fit. fit doesn't acquire the lock nor
-// check s.ins == nil. RLock is sufficient when calling this method because
-// this method itself doesn't change any field of State. Although the model
-// will be updated by the data, the model is protected by Python's GIL. So,
-// this method doesn't require a write lock.
+// fit trains the model with tuples written via Write. It calls `partial_fit`
+// when partial_fit parameter is true, and the method given by fit_method
+// otherwise.
 func (s *State) fit(ctx *core.Context, bucket []data.Value) (data.Value, error) {
-	return s.base.Call("fit", data.Array(bucket))
+	method := s.fitMethod()
+	if s.params.PartialFit {
+		method = "partial_fit"
+	}
+	return s.fitWith(ctx, method, bucket)
+}
+
+// fitWith is the internal implementation of Fit. It trains the model by
+// calling method. fitWith doesn't acquire the lock nor check s.ins == nil.
+// RLock is sufficient when calling this method because this method itself
+// doesn't change any field of State. The model updated by the data is
+// protected by modelM, which call holds exclusively.
+func (s *State) fitWith(ctx *core.Context, method string, bucket []data.Value) (data.Value, error) {
+	var replayIdx int64
+	if s.replay != nil {
+		replayIdx = s.replay.add(bucket)
+	}
+	bucket, arg, err := s.convertSamples(bucket)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	res, err := s.callWithRetry(func() (data.Value, error) {
+		return s.timeouts.callWithTimeout(s.params.FitTimeout, &s.timeouts.fit, method,
+			func() (data.Value, error) {
+				return s.call(method, arg)
+			})
+	})
+	elapsed := time.Since(start)
+	if err != nil {
+		s.stats.recordFailure(elapsed)
+		if s.replay != nil {
+			s.replay.dump(ctx, s.params.ReplayDumpPath, replayIdx, err)
+		}
+		return nil, err
+	}
+	metrics := namedMetrics(s.params.MetricsPositions, res)
+	if err := s.checkMetrics(ctx, metrics); err != nil {
+		return nil, err
+	}
+	step := s.stats.record(metrics, len(bucket), elapsed)
+	if s.serving != nil {
+		s.syncServing(ctx)
+	}
+	if len(s.metricPaths) > 0 {
+		s.extractMetrics(ctx, metrics)
+	}
+	earlyStopped := false
+	if s.early != nil {
+		earlyStopped = s.observeEarlyStopping(ctx, metrics, step)
+	}
+	if s.events != nil {
+		s.events.add(metrics, step, len(bucket), elapsed, earlyStopped)
+	}
+	if s.params.SaveBest {
+		s.saveIfBest(ctx, metrics, step)
+	}
+	if s.params.CheckpointInterval > 0 {
+		s.checkpointIfDue(ctx)
+	}
+	if s.drift != nil {
+		s.drift.observeTraining(bucket)
+	}
+	return res, nil
 }
 
 // Predict applies the model to the data. It returns a result returned from
 // Python script.
 func (s *State) Predict(ctx *core.Context, dt data.Value) (data.Value, error) {
+	return s.predict(ctx, dt, -1)
+}
+
+// predict is the implementation of Predict. timeout overrides
+// predict_timeout unless it's negative.
+func (s *State) predict(ctx *core.Context, dt data.Value, timeout time.Duration) (
+	data.Value, error) {
 	s.rwm.RLock()
 	defer s.rwm.RUnlock()
-	return s.base.Call("predict", dt)
+	if timeout < 0 {
+		timeout = s.params.PredictTimeout
+	}
+	traceID, traced := s.traceID(dt)
+	if s.feedback != nil {
+		var err error
+		if dt, err = s.feedback.apply(dt); err != nil {
+			return nil, err
+		}
+	}
+	dt, err := s.convertInput(dt)
+	if err != nil {
+		return nil, err
+	}
+	if s.drift != nil {
+		s.drift.observePrediction(dt)
+	}
+	res, err := s.callWithRetry(func() (data.Value, error) {
+		return s.timeouts.callWithTimeout(timeout, &s.timeouts.predict,
+			s.predictMethod(), func() (data.Value, error) {
+				return s.callServing(s.predictMethod(), s.sparsify(dt))
+			})
+	})
+	if traced {
+		if err != nil {
+			ctx.ErrLog(err).WithField("trace_id", traceID).
+				Warn("pymlstate's prediction failed")
+		} else {
+			ctx.Log().WithField("trace_id", traceID).
+				Debug("pymlstate predicted")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.feedback != nil {
+		s.feedback.record(res)
+	}
+	return res, nil
+}
+
+// CallMethod calls the given method of the Python instance with args and
+// returns its result as it is. Each argument is passed as a separate
+// positional argument. It's used to call methods pymlstate doesn't know.
+// Because the method may update the model, it takes the write lock and is
+// bounded by fit_timeout in the same way as fit. Its timeouts are counted as
+// fit timeouts.
+func (s *State) CallMethod(ctx *core.Context, method string, args ...data.Value) (data.Value, error) {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.checkTermination(); err != nil {
+		return nil, err
+	}
+	return s.timeouts.callWithTimeout(s.params.FitTimeout, &s.timeouts.fit, method,
+		func() (data.Value, error) {
+			return s.call(method, args...)
+		})
 }
 
 // Save saves the model of the state. pystate calls `save` method and
@@ -133,16 +1292,53 @@ func (s *State) Predict(ctx *core.Context, dt data.Value) (data.Value, error) {
 func (s *State) Save(ctx *core.Context, w io.Writer, params data.Map) error {
 	s.rwm.RLock()
 	defer s.rwm.RUnlock()
-	if err := s.base.CheckTermination(); err != nil {
+	return s.save(ctx, w, params)
+}
+
+func (s *State) save(ctx *core.Context, w io.Writer, params data.Map) error {
+	if err := s.checkTermination(); err != nil {
+		return err
+	}
+	if err := s.timeouts.checkOutstanding(); err != nil {
 		return err
 	}
 
 	if err := s.saveState(w); err != nil {
 		return err
 	}
+	s.modelM.RLock()
+	defer s.modelM.RUnlock()
 	return s.base.Save(ctx, w, params)
 }
 
+// SaveBytes returns the serialized model of the state in memory. The format
+// is same as the one written by Save, so it can be loaded by LOAD STATE. It
+// returns an error when the size exceeds save_max_bytes.
+func (s *State) SaveBytes(ctx *core.Context) ([]byte, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	w := &limitedBuffer{limit: s.params.SaveMaxBytes}
+	if err := s.save(ctx, w, data.Map{}); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+// limitedBuffer is a bytes.Buffer which refuses to grow beyond the limit. The
+// limit is disabled when it's 0.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && b.buf.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("serialized model exceeds save_max_bytes (%v bytes)",
+			b.limit)
+	}
+	return b.buf.Write(p)
+}
+
 const (
 	pyMLStateFormatVersion uint8 = 1
 )
@@ -185,13 +1381,16 @@ func (s *State) saveState(w io.Writer) error {
 func (s *State) Load(ctx *core.Context, r io.Reader, params data.Map) error {
 	s.rwm.Lock()
 	defer s.rwm.Unlock()
-	if err := s.base.CheckTermination(); err != nil {
+	if err := s.checkTermination(); err != nil {
 		return err
 	}
 	return s.load(ctx, r, params)
 }
 
 func (s *State) load(ctx *core.Context, r io.Reader, params data.Map) error {
+	if err := s.timeouts.checkOutstanding(); err != nil {
+		return err
+	}
 	var formatVersion uint8
 	if err := binary.Read(r, binary.LittleEndian, &formatVersion); err != nil {
 		return err
@@ -234,52 +1433,153 @@ func (s *State) loadMLParamsAndDataV1(ctx *core.Context, r io.Reader, params dat
 		return err
 	}
 
+	var rest []byte
+	if saved.DoubleBuffer {
+		// Both instances are loaded from the same data.
+		if rest, err = ioutil.ReadAll(r); err != nil {
+			return err
+		}
+		r = bytes.NewReader(rest)
+	}
+
 	if s.base == nil { // loading for the first time
+		if err := acquireStateSlot(); err != nil {
+			return err
+		}
 		s.base, err = pystate.LoadBase(ctx, r, params)
 		if err != nil {
+			releaseStateSlot()
 			return err
 		}
+		s.slotHeld = true
 
 	} else {
 		if err := s.base.Load(ctx, r, params); err != nil {
 			return err
 		}
 	}
-	s.params = saved
-	return nil
+	if err := s.setParams(&saved); err != nil {
+		return err
+	}
+	if saved.DoubleBuffer {
+		if err := s.loadServing(ctx, rest, params); err != nil {
+			return err
+		}
+	} else if s.serving != nil {
+		if err := s.serving.Terminate(ctx); err != nil {
+			ctx.ErrLog(err).Error("pymlstate cannot terminate the serving instance")
+		}
+		s.serving = nil
+	}
+	return checkSparseSupport(s.base, s.params.SparseThreshold)
 }
 
 // Fit trains the model. It applies tuples that bucket has in a batch manner.
 // The return value of this function depends on the implementation of Python
 // UDS.
 func Fit(ctx *core.Context, stateName string, bucket []data.Value) (data.Value, error) {
-	s, err := lookupState(ctx, stateName)
+	m, err := lookupModel(ctx, stateName)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.Fit(ctx, bucket)
+	return m.Fit(ctx, bucket)
+}
+
+// PartialFit incrementally trains the model of the state with bucket by
+// calling `partial_fit` method. See State.PartialFit for details.
+func PartialFit(ctx *core.Context, stateName string, bucket []data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.PartialFit(ctx, bucket)
 }
 
 // Predict applies the model to the given data and returns estimated values.
 // The format of the return value depends on each Python UDS.
-func Predict(ctx *core.Context, stateName string, dt data.Value) (data.Value, error) {
+//
+// When an output name is given, the method of the output defined in outputs
+// parameter is applied instead of `predict`, and its result is returned as it
+// is. See State.PredictOutput for details. In either case, the result is
+// returned with the id of the data when id_field is given.
+func Predict(ctx *core.Context, stateName string, dt data.Value, output ...string) (
+	data.Value, error) {
+	if len(output) > 1 {
+		return nil, fmt.Errorf("only one output can be given")
+	}
+	m, err := lookupModel(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	if len(output) == 1 {
+		s, ok := m.(*State)
+		if !ok {
+			return nil, fmt.Errorf("state '%v' doesn't support outputs", stateName)
+		}
+		res, err := s.PredictOutput(ctx, dt, output[0])
+		if err != nil {
+			return nil, err
+		}
+		return m.attachID(dt, res)
+	}
+
+	res, err := m.Predict(ctx, dt)
+	if err != nil {
+		return nil, err
+	}
+	if res, err = m.formatPrediction(res); err != nil {
+		return nil, err
+	}
+	return m.attachID(dt, res)
+}
+
+// Status returns the status of the state.
+func Status(ctx *core.Context, stateName string) (data.Value, error) {
+	m, err := lookupModel(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Status(), nil
+}
+
+// SaveBytes returns the serialized model of the state as a `data.Blob` so
+// that it can be written to any storage by a sink.
+func SaveBytes(ctx *core.Context, stateName string) (data.Value, error) {
 	s, err := lookupState(ctx, stateName)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.Predict(ctx, dt)
+	b, err := s.SaveBytes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return data.Blob(b), nil
 }
 
-// Flush pymlstate bucket. A return value is always nil.
+// Flush trains the model with tuples remaining in the bucket and returns the
+// whole result of the Python fit method for them. It returns NULL when the
+// bucket is empty.
 func Flush(ctx *core.Context, stateName string) (data.Value, error) {
 	s, err := lookupState(ctx, stateName)
 	if err != nil {
 		return nil, err
 	}
-	s.bucket = s.bucket[:0]
-	return nil, nil
+	return s.Flush(ctx)
+}
+
+// CallMethod calls the given method of the Python instance of the state with
+// args, e.g. pymlstate_call("state", "method", arg1, arg2). Methods taking no
+// argument can also be called. See State.CallMethod for details.
+func CallMethod(ctx *core.Context, stateName string, method string, args ...data.Value) (
+	data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.CallMethod(ctx, method, args...)
 }
 
 func lookupState(ctx *core.Context, stateName string) (*State, error) {
@@ -294,3 +1594,26 @@ func lookupState(ctx *core.Context, stateName string) (*State, error) {
 
 	return nil, fmt.Errorf("state '%v' isn't a State", stateName)
 }
+
+// model is implemented by both State and RoutedState so that UDFs can handle
+// them in the same way.
+type model interface {
+	Fit(ctx *core.Context, bucket []data.Value) (data.Value, error)
+	Predict(ctx *core.Context, dt data.Value) (data.Value, error)
+	Status() data.Map
+	formatPrediction(v data.Value) (data.Value, error)
+	attachID(dt, res data.Value) (data.Value, error)
+}
+
+func lookupModel(ctx *core.Context, stateName string) (model, error) {
+	st, err := ctx.SharedStates.Get(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if m, ok := st.(model); ok {
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("state '%v' isn't a State nor a RoutedState", stateName)
+}
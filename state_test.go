@@ -1,10 +1,12 @@
 package pymlstate
 
 import (
+	"bytes"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/sensorbee/py.v0/pystate"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
 	"testing"
 )
 
@@ -28,6 +30,17 @@ func TestPyMLStateFitAndPredict(t *testing.T) {
 		})
 		err = ctx.SharedStates.Add("pystate_test", "py", s)
 		So(err, ShouldBeNil)
+		Convey("When call fit with an empty bucket", func() {
+			ac, err := Fit(ctx, "pystate_test", []data.Value{})
+			Convey("Then fit function should not be called", func() {
+				So(err, ShouldBeNil)
+				So(ac, ShouldResemble, data.Null{})
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, 0)
+			})
+		})
+
 		Convey("When call fit", func() {
 			bu := []data.Value{
 				data.String("a"), data.String("b"),
@@ -46,6 +59,31 @@ func TestPyMLStateFitAndPredict(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("When call an arbitrary method", func() {
+			ac, err := CallMethod(ctx, "pystate_test", "saliency",
+				data.Array{data.Int(-1), data.Int(2)})
+			Convey("Then the method should be called with the argument", func() {
+				So(err, ShouldBeNil)
+				So(ac, ShouldResemble, data.Array{data.Int(1), data.Int(2)})
+			})
+		})
+
+		Convey("When call a method with several arguments", func() {
+			ac, err := CallMethod(ctx, "pystate_test", "add", data.Int(1), data.Int(2))
+			Convey("Then each argument should be passed separately", func() {
+				So(err, ShouldBeNil)
+				So(ac, ShouldEqual, data.Int(3))
+			})
+		})
+
+		Convey("When call a method without arguments", func() {
+			ac, err := CallMethod(ctx, "pystate_test", "confirm_to_call_fit")
+			Convey("Then the method should be called", func() {
+				So(err, ShouldBeNil)
+				So(ac, ShouldEqual, data.Int(0))
+			})
+		})
 	})
 }
 
@@ -104,24 +142,328 @@ func TestPyMLStateWrite(t *testing.T) {
 }
 
 func TestPyMLStateFlush(t *testing.T) {
-	Convey("Given a context set dummy state", t, func() {
-		bu := []data.Value{data.String("a"), data.String("b")}
-		cc := &core.ContextConfig{}
-		ctx := core.NewContext(cc)
-		s := &State{
-			bucket: bu,
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a context set pymlstate for flush test", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "MetricsClass",
 		}
+		s, err := New(baseParams, &MLParams{BatchSize: 3}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
 		stateName := "test_state_for_flush"
-		err := ctx.SharedStates.Add(stateName, stateName, s)
+		err = ctx.SharedStates.Add(stateName, stateName, s)
 		So(err, ShouldBeNil)
-		So(len(s.bucket), ShouldEqual, 2)
-		Convey("When call flush", func() {
+
+		Convey("When call flush with an empty bucket", func() {
 			ac, err := Flush(ctx, stateName)
-			So(ac, ShouldBeNil)
-			So(err, ShouldBeNil)
+			Convey("Then it should return null without calling fit", func() {
+				So(err, ShouldBeNil)
+				So(ac, ShouldResemble, data.Null{})
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When call flush with a partial bucket", func() {
+			for i := 0; i < 2; i++ {
+				tu := &core.Tuple{
+					Data: data.Map{
+						"data": data.String("a"),
+					},
+				}
+				So(s.Write(ctx, tu), ShouldBeNil)
+			}
+			So(len(s.bucket), ShouldEqual, 2)
+			ac, err := Flush(ctx, stateName)
+			Convey("Then the whole fit result should be returned", func() {
+				So(err, ShouldBeNil)
+				So(ac, ShouldResemble, data.Map{
+					"loss":     data.Float(0.5),
+					"accuracy": data.Float(0.8),
+					"count":    data.Int(2),
+				})
+			})
 			Convey("Then state bucket should be empty", func() {
 				So(len(s.bucket), ShouldEqual, 0)
 			})
 		})
 	})
 }
+
+func TestPyMLStateSaveBytes(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate for save bytes test", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		mlParams := &MLParams{
+			BatchSize: 5,
+		}
+
+		s, err := New(baseParams, mlParams, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+		Convey("When save the state as bytes", func() {
+			b, err := s.SaveBytes(ctx)
+			So(err, ShouldBeNil)
+			Convey("Then the bytes should be loaded as a state", func() {
+				sc := StateCreator{}
+				s2, err := sc.LoadState(ctx, bytes.NewReader(b), data.Map{})
+				So(err, ShouldBeNil)
+				defer s2.Terminate(ctx)
+				ps2, ok := s2.(*State)
+				So(ok, ShouldBeTrue)
+				So(ps2.params.BatchSize, ShouldEqual, 5)
+			})
+		})
+
+		Convey("When save the state with too small save_max_bytes", func() {
+			s.params.SaveMaxBytes = 1
+			_, err := s.SaveBytes(ctx)
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestTraceID(t *testing.T) {
+	Convey("Given a state with trace_field", t, func() {
+		s := &State{}
+		So(s.setParams(&MLParams{BatchSize: 1, TraceField: "meta.id"}), ShouldBeNil)
+
+		Convey("When get the trace ID of data having the field", func() {
+			id, ok := s.traceID(data.Map{
+				"meta": data.Map{"id": data.Int(42)},
+			})
+			Convey("Then it should be returned as a string", func() {
+				So(ok, ShouldBeTrue)
+				So(id, ShouldEqual, "42")
+			})
+		})
+
+		Convey("When get the trace ID of data not having the field", func() {
+			_, ok := s.traceID(data.Map{"data": data.Int(1)})
+			Convey("Then it should not be found", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a state without trace_field", t, func() {
+		s := &State{}
+		So(s.setParams(&MLParams{BatchSize: 1}), ShouldBeNil)
+
+		Convey("When get the trace ID", func() {
+			_, ok := s.traceID(data.Map{"id": data.Int(1)})
+			Convey("Then it should not be found", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestPyMLStateConcurrentWriteAndPredict(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 3}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When write, fit, and predict concurrently", func() {
+			const n = 30
+			errs := make(chan error, 3*n)
+			wg := sync.WaitGroup{}
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < n; i++ {
+					errs <- s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(i)}})
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < n; i++ {
+					_, err := s.Fit(ctx, []data.Value{data.Int(i)})
+					errs <- err
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < n; i++ {
+					_, err := s.Predict(ctx, data.Int(i))
+					errs <- err
+				}
+			}()
+			wg.Wait()
+			close(errs)
+
+			Convey("Then all calls should succeed", func() {
+				for err := range errs {
+					So(err, ShouldBeNil)
+				}
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, data.Int(n/3+n))
+			})
+		})
+	})
+}
+
+func TestPyMLStateSerializesModelCalls(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with async_fit", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "OverlapClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize: 1,
+			AsyncFit:  true,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When write, fit, and predict concurrently", func() {
+			const n = 20
+			wg := sync.WaitGroup{}
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < n; i++ {
+					s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(i)}})
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < n; i++ {
+					s.Fit(ctx, []data.Value{data.Int(i)})
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < n; i++ {
+					s.Predict(ctx, data.Int(i))
+				}
+			}()
+			wg.Wait()
+			_, err := s.Flush(ctx)
+			So(err, ShouldBeNil)
+
+			Convey("Then fit should never run concurrently with other calls", func() {
+				cnt, err := s.base.Call("count_overlaps")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, data.Int(0))
+			})
+		})
+	})
+}
+
+func TestPyMLStateMethodNames(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with fit_method and predict_method", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "PartialClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:     1,
+			FitMethod:     "partial_fit",
+			PredictMethod: "forward",
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When fit and predict", func() {
+			fr, err := s.Fit(ctx, []data.Value{data.Int(1)})
+			So(err, ShouldBeNil)
+			pr, err := s.Predict(ctx, data.Int(1))
+			So(err, ShouldBeNil)
+
+			Convey("Then the configured methods should be called", func() {
+				So(fr, ShouldEqual, data.String("partial_fit called"))
+				So(pr, ShouldEqual, data.String("forward called"))
+			})
+		})
+	})
+}
+
+func TestPyMLStatePartialFit(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with partial_fit", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "PartialClass",
+		}
+		s, err := New(baseParams, &MLParams{
+			BatchSize:  1,
+			PartialFit: true,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+		counts := func() data.Value {
+			c, err := s.base.Call("counts")
+			So(err, ShouldBeNil)
+			return c
+		}
+
+		Convey("When write a tuple", func() {
+			So(s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(1)}}), ShouldBeNil)
+
+			Convey("Then partial_fit should be called", func() {
+				So(counts(), ShouldResemble, data.Array{data.Int(0), data.Int(1)})
+			})
+		})
+
+		Convey("When fit is called", func() {
+			res, err := s.Fit(ctx, []data.Value{data.Int(1)})
+			So(err, ShouldBeNil)
+
+			Convey("Then fit should be called for a full retrain", func() {
+				So(res, ShouldEqual, data.String("fit called"))
+				So(counts(), ShouldResemble, data.Array{data.Int(1), data.Int(0)})
+			})
+		})
+
+		Convey("When partial fit is called", func() {
+			res, err := s.PartialFit(ctx, []data.Value{data.Int(1)})
+			So(err, ShouldBeNil)
+
+			Convey("Then partial_fit should be called", func() {
+				So(res, ShouldEqual, data.String("partial_fit called"))
+				So(counts(), ShouldResemble, data.Array{data.Int(0), data.Int(1)})
+			})
+		})
+	})
+}
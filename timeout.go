@@ -0,0 +1,144 @@
+package pymlstate
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errOutstandingCall is returned while a Python call which timed out is still
+// running in the background.
+var errOutstandingCall = errors.New("a Python call which timed out is still running")
+
+// timeouts has the numbers of Python calls which timed out. outstanding is
+// the number of calls which timed out but haven't returned yet. These fields
+// are updated atomically. idle has functions called when all outstanding
+// calls have returned, and it's protected by m.
+type timeouts struct {
+	fit         int64
+	predict     int64
+	outstanding int64
+
+	m    sync.Mutex
+	idle []func()
+}
+
+type callResult struct {
+	res data.Value
+	err error
+}
+
+// timeoutError is returned when a Python call doesn't return in time.
+type timeoutError struct {
+	method  string
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("'%v' didn't finish in %v", e.method, e.timeout)
+}
+
+// callWithTimeout calls f and returns its result. When f doesn't return in
+// timeout, it returns *timeoutError and increments cnt atomically. f
+// continues to run in the background and its result is discarded. Until it
+// returns, the call is counted as outstanding and callWithTimeout fails
+// without calling f so that calls don't pile up behind the hung one. A timeout
+// of 0 or less means no deadline.
+//
+// The call isn't interrupted by raising an exception in its thread with
+// PyThreadState_SetAsyncExc. pystate doesn't expose the thread state of a
+// call, and the exception is only raised between Python bytecodes, so it
+// cannot interrupt calls hung in native code such as numpy, a deep learning
+// framework, or a blocking I/O, which are the usual causes of a timeout.
+func (t *timeouts) callWithTimeout(timeout time.Duration, cnt *int64, method string,
+	f func() (data.Value, error)) (data.Value, error) {
+	if err := t.checkOutstanding(); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		return f()
+	}
+
+	var (
+		m         sync.Mutex
+		done      bool
+		abandoned bool
+	)
+	ch := make(chan callResult, 1)
+	go func() {
+		res, err := f()
+		m.Lock()
+		done = true
+		idle := abandoned && atomic.AddInt64(&t.outstanding, -1) == 0
+		m.Unlock()
+		ch <- callResult{res, err}
+		if idle {
+			t.runIdle()
+		}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r.res, r.err
+	case <-timer.C:
+	}
+
+	m.Lock()
+	if done {
+		// f returned right at the deadline.
+		m.Unlock()
+		r := <-ch
+		return r.res, r.err
+	}
+	abandoned = true
+	atomic.AddInt64(&t.outstanding, 1)
+	m.Unlock()
+	atomic.AddInt64(cnt, 1)
+	return nil, &timeoutError{method: method, timeout: timeout}
+}
+
+// checkOutstanding returns an error while a call which timed out is still
+// running. Operations which must not run concurrently with fit or predict on
+// the same Python instance, such as Save and Load, call it after
+// acquiring the lock of the state.
+func (t *timeouts) checkOutstanding() error {
+	if atomic.LoadInt64(&t.outstanding) > 0 {
+		return errOutstandingCall
+	}
+	return nil
+}
+
+// afterOutstanding registers f to be called when all calls which timed out
+// have returned. It returns false without registering f when no call is
+// outstanding.
+func (t *timeouts) afterOutstanding(f func()) bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+	if atomic.LoadInt64(&t.outstanding) == 0 {
+		return false
+	}
+	t.idle = append(t.idle, f)
+	return true
+}
+
+func (t *timeouts) runIdle() {
+	t.m.Lock()
+	fs := t.idle
+	t.idle = nil
+	t.m.Unlock()
+	for _, f := range fs {
+		f()
+	}
+}
+
+func (t *timeouts) status() data.Map {
+	return data.Map{
+		"fit_timeouts":                data.Int(atomic.LoadInt64(&t.fit)),
+		"predict_timeouts":            data.Int(atomic.LoadInt64(&t.predict)),
+		"outstanding_timed_out_calls": data.Int(atomic.LoadInt64(&t.outstanding)),
+	}
+}
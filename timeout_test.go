@@ -0,0 +1,180 @@
+package pymlstate
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func TestCallWithTimeout(t *testing.T) {
+	Convey("Given a call with a timeout", t, func() {
+		var cnt int64
+		to := &timeouts{}
+
+		Convey("When the call returns in time", func() {
+			res, err := to.callWithTimeout(time.Second, &cnt, "predict", func() (data.Value, error) {
+				return data.Int(1), nil
+			})
+
+			Convey("Then its result should be returned", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.Int(1))
+				So(cnt, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the call fails in time", func() {
+			_, err := to.callWithTimeout(time.Second, &cnt, "predict", func() (data.Value, error) {
+				return nil, errors.New("failure")
+			})
+
+			Convey("Then its error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "failure")
+				So(cnt, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the call doesn't return in time", func() {
+			done := make(chan struct{})
+			Reset(func() {
+				close(done)
+			})
+			_, err := to.callWithTimeout(10*time.Millisecond, &cnt, "predict", func() (data.Value, error) {
+				<-done
+				return data.Int(1), nil
+			})
+
+			Convey("Then it should time out", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "predict")
+				So(cnt, ShouldEqual, 1)
+			})
+
+			Convey("Then the call should be outstanding until it returns", func() {
+				So(to.checkOutstanding(), ShouldEqual, errOutstandingCall)
+				_, err := to.callWithTimeout(time.Second, &cnt, "predict", func() (data.Value, error) {
+					return data.Int(2), nil
+				})
+				So(err, ShouldEqual, errOutstandingCall)
+
+				done <- struct{}{}
+				for i := 0; i < 100 && to.checkOutstanding() != nil; i++ {
+					time.Sleep(10 * time.Millisecond)
+				}
+				So(to.checkOutstanding(), ShouldBeNil)
+				So(to.status()["outstanding_timed_out_calls"], ShouldEqual, data.Int(0))
+			})
+
+			Convey("Then a function registered by afterOutstanding should be called after it returns", func() {
+				called := make(chan struct{})
+				So(to.afterOutstanding(func() { close(called) }), ShouldBeTrue)
+				done <- struct{}{}
+				ok := false
+				select {
+				case <-called:
+					ok = true
+				case <-time.After(time.Second):
+				}
+				So(ok, ShouldBeTrue)
+				So(to.checkOutstanding(), ShouldBeNil)
+				So(to.afterOutstanding(func() {}), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the timeout is 0", func() {
+			res, err := to.callWithTimeout(0, &cnt, "fit", func() (data.Value, error) {
+				time.Sleep(10 * time.Millisecond)
+				return data.Int(1), nil
+			})
+
+			Convey("Then it should wait for the call", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldEqual, data.Int(1))
+			})
+		})
+	})
+}
+
+func TestPyMLStateTerminateWithOutstandingCall(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate having a prediction which timed out", t, func() {
+		s, err := New(&pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}, &MLParams{
+			BatchSize:          1,
+			PredictBatchMethod: "slow_predict_batch",
+			PredictTimeout:     10 * time.Millisecond,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+		_, err = s.PredictBatch(ctx, []data.Value{data.Int(1)})
+		So(err, ShouldNotBeNil)
+		So(s.timeouts.checkOutstanding(), ShouldEqual, errOutstandingCall)
+
+		Convey("When call other methods of the Python instance", func() {
+			_, err := s.CallMethod(ctx, "confirm_to_call_fit")
+
+			Convey("Then they should fail immediately", func() {
+				So(err, ShouldEqual, errOutstandingCall)
+			})
+		})
+
+		Convey("When terminate it", func() {
+			err := s.Terminate(ctx)
+
+			Convey("Then it should succeed without waiting for the call", func() {
+				So(err, ShouldBeNil)
+				_, err := s.Predict(ctx, data.Int(1))
+				So(err, ShouldNotBeNil)
+				So(s.Terminate(ctx), ShouldNotBeNil)
+			})
+
+			Convey("Then the Python instance should be released after the call returns", func() {
+				for i := 0; i < 100 && s.base.CheckTermination() == nil; i++ {
+					time.Sleep(10 * time.Millisecond)
+				}
+				So(s.base.CheckTermination(), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestPyMLStateCallMethodWithTimeout(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate with fit_timeout", t, func() {
+		s, err := New(&pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}, &MLParams{
+			BatchSize:  1,
+			FitTimeout: 10 * time.Millisecond,
+		}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When call a method which doesn't return in time", func() {
+			_, err := s.CallMethod(ctx, "slow_predict_batch", data.Array{data.Int(1)})
+
+			Convey("Then it should time out", func() {
+				So(err, ShouldNotBeNil)
+				_, ok := err.(*timeoutError)
+				So(ok, ShouldBeTrue)
+				So(s.Status()["fit_timeouts"], ShouldEqual, data.Int(1))
+			})
+		})
+	})
+}
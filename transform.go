@@ -0,0 +1,45 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// Transform applies `transform` method of the model to the data and returns
+// the transformed feature vector as an array of floats. The data is converted
+// in the same way as Predict.
+func (s *State) Transform(ctx *core.Context, dt data.Value) (data.Value, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	dt, err := s.convertInput(dt)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := s.callOptionalServing("transformation", "transform", s.sparsify(dt))
+	if err != nil {
+		return nil, err
+	}
+	vec, err := toFloatVector(v)
+	if err != nil {
+		return nil, fmt.Errorf("transform must return an array of numbers: %v", err)
+	}
+	res := make(data.Array, len(vec))
+	for i, f := range vec {
+		res[i] = data.Float(f)
+	}
+	return res, nil
+}
+
+// Transform returns the feature vector of the given data computed by the
+// model, so that autoencoders and embedding models can be used as feature
+// extractors in a topology. The Python class must define `transform` method.
+func Transform(ctx *core.Context, stateName string, dt data.Value) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Transform(ctx, dt)
+}
@@ -0,0 +1,55 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateTransform(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate having transform", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When transform data", func() {
+			res, err := s.Transform(ctx, data.Int(3))
+
+			Convey("Then the feature vector should be returned", func() {
+				So(err, ShouldBeNil)
+				So(res, ShouldResemble, data.Array{data.Float(3), data.Float(6)})
+			})
+		})
+	})
+
+	Convey("Given a pymlstate not having transform", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "PartialClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When transform data", func() {
+			_, err := s.Transform(ctx, data.Int(3))
+			Convey("Then it should fail as not supported", func() {
+				So(isNotSupported(err), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,127 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"time"
+)
+
+var _ core.Updater = &State{}
+
+// Update changes parameters of the state at runtime without losing the
+// trained model. It's called by UPDATE STATE and accepts the following
+// parameters:
+//
+// batch_train_size: the new batch size. When the bucket already has tuples
+// as many as the new size, they're trained immediately unless the state is
+// paused or fit_on_write is false.
+//
+// max_flush_interval: the new max_flush_interval in seconds. It's applied
+// to buckets started after the update.
+//
+// model_params: a map passed to `set_params` method of the Python instance
+// as a dict, e.g. to change the learning rate. The class must have the
+// method when it's given.
+//
+// Other parameters result in an error. Nothing is changed when an error
+// occurs before the update is applied.
+func (s *State) Update(ctx *core.Context, params data.Map) error {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	if err := s.checkTermination(); err != nil {
+		return err
+	}
+
+	p := s.params
+	var modelParams data.Map
+	for k, v := range params {
+		switch k {
+		case "batch_train_size":
+			bs, err := data.AsInt(v)
+			if err != nil {
+				return err
+			}
+			if bs <= 0 {
+				return fmt.Errorf("batch_train_size must be greater than 0")
+			}
+			p.BatchSize = int(bs)
+		case "max_flush_interval":
+			sec, err := data.ToFloat(v)
+			if err != nil {
+				return err
+			}
+			if sec < 0 {
+				return fmt.Errorf("max_flush_interval must not be negative")
+			}
+			p.MaxFlushInterval = time.Duration(sec * float64(time.Second))
+		case "model_params":
+			m, err := data.AsMap(v)
+			if err != nil {
+				return fmt.Errorf("model_params must be a map: %v", err)
+			}
+			modelParams = m
+		default:
+			return fmt.Errorf("%v cannot be updated", k)
+		}
+	}
+
+	if modelParams != nil {
+		if _, err := s.callOptional("runtime parameter update", "set_params",
+			modelParams); err != nil {
+			return err
+		}
+	}
+	if err := s.setParams(&p); err != nil {
+		return err
+	}
+	if s.paused {
+		return nil
+	}
+	if s.params.DeferFit {
+		s.rescheduleFlush(ctx)
+		return nil
+	}
+	return s.fitFullBatches(ctx)
+}
+
+// SetParams passes params to `set_params` method of the Python instance as a
+// dict so that hyperparameters such as a learning rate can be tuned while the
+// state is running. Unlike Update, it doesn't change parameters of the state
+// itself.
+func (s *State) SetParams(ctx *core.Context, params data.Map) error {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	_, err := s.callOptional("runtime parameter update", "set_params", params)
+	return err
+}
+
+// GetParams returns the result of `get_params` method of the Python instance.
+func (s *State) GetParams(ctx *core.Context) (data.Value, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	return s.callOptional("parameter inspection", "get_params")
+}
+
+// SetParams passes params to `set_params` method of the Python instance of the
+// state. It returns NULL. See State.SetParams for details.
+func SetParams(ctx *core.Context, stateName string, params data.Map) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SetParams(ctx, params); err != nil {
+		return nil, err
+	}
+	return data.Null{}, nil
+}
+
+// GetParams returns parameters of the model of the state returned by
+// `get_params` method of the Python instance.
+func GetParams(ctx *core.Context, stateName string) (data.Value, error) {
+	s, err := lookupState(ctx, stateName)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetParams(ctx)
+}
@@ -0,0 +1,91 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateUpdate(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given a pymlstate having tuples in its bucket", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 10}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+		for i := 0; i < 3; i++ {
+			So(s.Write(ctx, &core.Tuple{Data: data.Map{"data": data.Int(i)}}), ShouldBeNil)
+		}
+
+		Convey("When update batch_train_size", func() {
+			So(s.Update(ctx, data.Map{"batch_train_size": data.Int(2)}), ShouldBeNil)
+			Convey("Then full batches should be trained immediately", func() {
+				st := s.Status()
+				So(st["batch_train_size"], ShouldEqual, data.Int(2))
+				So(st["bucket_size"], ShouldEqual, data.Int(1))
+				cnt, err := s.base.Call("confirm_to_call_fit")
+				So(err, ShouldBeNil)
+				So(cnt, ShouldEqual, data.Int(1))
+			})
+		})
+
+		Convey("When update an unknown parameter", func() {
+			err := s.Update(ctx, data.Map{
+				"batch_train_size": data.Int(2),
+				"module_name":      data.String("foo"),
+			})
+			Convey("Then it should fail without changing anything", func() {
+				So(err, ShouldNotBeNil)
+				So(s.Status()["batch_train_size"], ShouldEqual, data.Int(10))
+			})
+		})
+
+		Convey("When update model_params of a class without set_params", func() {
+			err := s.Update(ctx, data.Map{"model_params": data.Map{"lr": data.Float(0.5)}})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(isNotSupported(err), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given a pymlstate having set_params", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "KwargsClass",
+		}
+		s, err := New(baseParams, &MLParams{BatchSize: 1}, data.Map{})
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.Terminate(ctx)
+		})
+
+		Convey("When update model_params", func() {
+			So(s.Update(ctx, data.Map{"model_params": data.Map{"lr": data.Float(0.5)}}), ShouldBeNil)
+			Convey("Then they should be passed to the Python instance", func() {
+				v, err := s.Predict(ctx, data.Int(1))
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, data.Float(0.5))
+			})
+		})
+
+		Convey("When set params directly", func() {
+			So(s.SetParams(ctx, data.Map{"lr": data.Float(0.01)}), ShouldBeNil)
+			Convey("Then get params should return them", func() {
+				v, err := s.GetParams(ctx)
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, data.Map{"lr": data.Float(0.01)})
+			})
+		})
+	})
+}
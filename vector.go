@@ -0,0 +1,50 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// toFloatVector converts a numeric value or an array of numeric values to a
+// float64 slice. A scalar is converted to a slice having one element.
+func toFloatVector(v data.Value) ([]float64, error) {
+	if v.Type() != data.TypeArray {
+		f, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		return []float64{f}, nil
+	}
+
+	arr, _ := data.AsArray(v)
+	vec := make([]float64, len(arr))
+	for i, e := range arr {
+		f, err := data.ToFloat(e)
+		if err != nil {
+			return nil, fmt.Errorf("element %v isn't numeric: %v", i, err)
+		}
+		vec[i] = f
+	}
+	return vec, nil
+}
+
+func fromFloatVector(vec []float64) data.Array {
+	arr := make(data.Array, len(vec))
+	for i, f := range vec {
+		arr[i] = data.Float(f)
+	}
+	return arr
+}
+
+// argmax returns the index of the largest element. When multiple elements
+// have the same largest value, the lowest index is returned. It returns -1
+// for an empty slice.
+func argmax(vec []float64) int {
+	idx := -1
+	for i, f := range vec {
+		if idx < 0 || f > vec[idx] {
+			idx = i
+		}
+	}
+	return idx
+}
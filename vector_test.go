@@ -0,0 +1,50 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestToFloatVector(t *testing.T) {
+	Convey("Given numeric values", t, func() {
+		Convey("When convert a scalar", func() {
+			v, err := toFloatVector(data.Int(3))
+			Convey("Then it should be a vector having one element", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, []float64{3})
+			})
+		})
+
+		Convey("When convert an array", func() {
+			v, err := toFloatVector(data.Array{data.Int(1), data.Float(0.5)})
+			Convey("Then it should be converted element-wise", func() {
+				So(err, ShouldBeNil)
+				So(v, ShouldResemble, []float64{1, 0.5})
+			})
+		})
+
+		Convey("When convert an array having a non numeric value", func() {
+			_, err := toFloatVector(data.Array{data.Int(1), data.Map{}})
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestArgmax(t *testing.T) {
+	Convey("Given vectors", t, func() {
+		Convey("When elements tie on the largest value", func() {
+			Convey("Then the lowest index should be returned", func() {
+				So(argmax([]float64{0.1, 0.4, 0.4, 0.1}), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the vector is empty", func() {
+			Convey("Then -1 should be returned", func() {
+				So(argmax([]float64{}), ShouldEqual, -1)
+			})
+		})
+	})
+}
@@ -0,0 +1,23 @@
+package pymlstate
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/py.v0/pystate"
+)
+
+// warmup applies the model of b to warmup_sample so that caches such as CUDA
+// contexts and JIT-compiled functions are initialized before the first real
+// tuple arrives. The sample is converted in the same way as Predict.
+func (s *State) warmup(b *pystate.Base) error {
+	if s.params.WarmupSample == nil {
+		return nil
+	}
+	dt, err := s.convertInput(s.params.WarmupSample)
+	if err != nil {
+		return fmt.Errorf("cannot convert warmup_sample: %v", err)
+	}
+	if _, err := b.Call(s.predictMethod(), s.sparsify(dt)); err != nil {
+		return fmt.Errorf("warm-up prediction failed: %v", err)
+	}
+	return nil
+}
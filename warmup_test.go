@@ -0,0 +1,67 @@
+package pymlstate
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/py.v0/pystate"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestPyMLStateWarmup(t *testing.T) {
+	cc := &core.ContextConfig{}
+	ctx := core.NewContext(cc)
+	Convey("Given parameters with warmup_sample", t, func() {
+		baseParams := &pystate.BaseParams{
+			ModulePath: "./",
+			ModuleName: "_test_pymlstate",
+			ClassName:  "TestClass",
+		}
+
+		Convey("When create a pymlstate whose predict succeeds", func() {
+			s, err := New(baseParams, &MLParams{
+				BatchSize:    1,
+				WarmupSample: data.Array{data.Float(0)},
+			}, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+
+			Convey("Then it should be created", func() {
+				So(s.initialized(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When create a pymlstate whose predict fails", func() {
+			_, err := New(baseParams, &MLParams{
+				BatchSize:     1,
+				WarmupSample:  data.Array{data.Float(0)},
+				PredictMethod: "no_such_method",
+			}, data.Map{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When create a lazy pymlstate whose predict fails", func() {
+			s, err := New(baseParams, &MLParams{
+				BatchSize:     1,
+				LazyInit:      true,
+				WarmupSample:  data.Array{data.Float(0)},
+				PredictMethod: "no_such_method",
+			}, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Terminate(ctx)
+			})
+
+			Convey("Then the first use should fail", func() {
+				_, err := s.Predict(ctx, data.Int(1))
+				So(err, ShouldNotBeNil)
+				So(s.initialized(), ShouldBeFalse)
+			})
+		})
+	})
+}